@@ -1,24 +1,32 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"notes/internal/config"
-	"notes/internal/handlers/note/delete"
-	"notes/internal/handlers/note/get"
-	"notes/internal/handlers/note/getall"
-	noteSave "notes/internal/handlers/note/save"
-	"notes/internal/handlers/note/update"
-	"notes/internal/handlers/user/login"
-	userSave "notes/internal/handlers/user/save"
+	"notes/internal/migrator"
+	"notes/internal/models"
+	"notes/internal/purger"
+	"notes/internal/router"
+	"notes/internal/storage"
+	"notes/internal/storage/memory"
 	"notes/internal/storage/postgres"
+	"notes/internal/storage/sqlite"
+	"notes/internal/tracing"
 	"notes/pkg/logger/handlers/slogpretty"
 	"notes/pkg/logger/sl"
 	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
 
-	"github.com/go-chi/chi"
-	"github.com/go-chi/chi/middleware"
-	JWTMiddleware "notes/internal/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 const (
@@ -33,28 +41,57 @@ func main() {
 
 	log.Info("starting notes service", slog.String("env", cfg.Env))
 	log.Debug("debug log enabled")
-	storage, err := postgres.New(cfg.StoragePath)
+	store, err := newStorage(cfg)
 	if err != nil {
 		log.Error("failed to init storage", sl.Err(err))
 		os.Exit(1)
 	}
-	_ = storage
-	router := chi.NewRouter()
-	router.Use(middleware.RequestID)
-	router.Use(middleware.Logger)
-	router.Use(middleware.Recoverer)
-	router.Use(middleware.URLFormat)
-	router.Post("/users/register", userSave.New(log, storage))
-	router.Post("/users/login", login.New(log, storage))
-
-	router.Route("/users/{id}/notes", func(r chi.Router) {
-		r.Use(JWTMiddleware.JWT)
-		r.Post("/", noteSave.New(log, storage))
-		r.Get("/", getall.New(log, storage))
-		r.Get("/{note_id}", get.New(log, storage))
-		r.Put("/{note_id}", update.New(log, storage))
-		r.Delete("/{note_id}", delete.New(log, storage))
-	})
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(log, cfg, store, os.Args[2:]); err != nil {
+			log.Error("failed to migrate", sl.Err(err))
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "role" {
+		if err := runRole(store, os.Args[2:]); err != nil {
+			log.Error("failed to set role", sl.Err(err))
+			os.Exit(1)
+		}
+		return
+	}
+	if cfg.AutoMigrate {
+		if err := runMigrate(log, cfg, store, []string{"up"}); err != nil {
+			log.Error("failed to apply migrations", sl.Err(err))
+			os.Exit(1)
+		}
+	}
+	// Prepare fills the statements of the storage, so it runs before the
+	// purger and the router share it.
+	if s, ok := store.(sqlStorage); ok {
+		if err := s.Prepare(context.Background()); err != nil {
+			log.Error("failed to prepare statements", sl.Err(err))
+			os.Exit(1)
+		}
+		prometheus.MustRegister(collectors.NewDBStatsCollector(s.DB(), "notes"))
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
+	if err != nil {
+		log.Error("failed to init tracing", sl.Err(err))
+		os.Exit(1)
+	}
+
+	purgerDone := make(chan struct{})
+	go func() {
+		defer close(purgerDone)
+		purger.Run(ctx, log, store, cfg.Trash.PurgeInterval, cfg.Trash.Retention)
+	}()
+
+	var shuttingDown atomic.Bool
+	router := router.New(log, cfg, store, &shuttingDown)
 
 	log.Info("starting server", slog.String("address", cfg.Address))
 	srv := &http.Server{
@@ -64,10 +101,116 @@ func main() {
 		WriteTimeout: cfg.HTTPServer.Timeout,
 		IdleTimeout:  cfg.HTTPServer.IdleTimeout,
 	}
-	if err := srv.ListenAndServe(); err != nil {
-		log.Error("failed to start server")
+	serverErr := make(chan error, 2)
+	go func() {
+		serverErr <- srv.ListenAndServe()
+	}()
+
+	var metricsSrv *http.Server
+	if cfg.HTTPServer.MetricsAddress != "" {
+		log.Info("starting metrics server", slog.String("address", cfg.HTTPServer.MetricsAddress))
+		metricsRouter := http.NewServeMux()
+		metricsRouter.Handle("/metrics", promhttp.Handler())
+		metricsSrv = &http.Server{
+			Addr:        cfg.HTTPServer.MetricsAddress,
+			Handler:     metricsRouter,
+			ReadTimeout: cfg.HTTPServer.Timeout,
+			IdleTimeout: cfg.HTTPServer.IdleTimeout,
+		}
+		go func() {
+			serverErr <- metricsSrv.ListenAndServe()
+		}()
+	}
+
+	select {
+	case err := <-serverErr:
+		log.Error("failed to start server", sl.Err(err))
+		os.Exit(1)
+	case <-ctx.Done():
+	}
+
+	// Fail readiness probes first and keep serving for the drain period, so
+	// that load balancers stop routing here before the listener closes.
+	shuttingDown.Store(true)
+	log.Info("draining", slog.Duration("period", cfg.HTTPServer.DrainPeriod))
+	time.Sleep(cfg.HTTPServer.DrainPeriod)
+
+	log.Info("shutting down server", slog.Duration("timeout", cfg.HTTPServer.ShutdownTimeout))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.HTTPServer.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Error("failed to drain connections", sl.Err(err))
+	}
+	if metricsSrv != nil {
+		if err := metricsSrv.Shutdown(shutdownCtx); err != nil {
+			log.Error("failed to stop metrics server", sl.Err(err))
+		}
 	}
+	<-purgerDone
+	if err := store.Close(); err != nil {
+		log.Error("failed to close storage", sl.Err(err))
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Error("failed to flush traces", sl.Err(err))
+	}
+	log.Info("server stopped")
+}
+
+// newStorage opens the backend selected by the storage_driver option.
+func newStorage(cfg *config.Config) (storage.Store, error) {
+	opts := storage.Options{
+		QueryTimeout:    cfg.QueryTimeout,
+		MaxOpenConns:    cfg.Pool.MaxOpenConns,
+		MaxIdleConns:    cfg.Pool.MaxIdleConns,
+		ConnMaxLifetime: cfg.Pool.ConnMaxLifetime,
+		ConnMaxIdleTime: cfg.Pool.ConnMaxIdleTime,
+	}
+	switch cfg.StorageDriver {
+	case config.StorageDriverPostgres:
+		return postgres.New(cfg.StoragePath, opts)
+	case config.StorageDriverSQLite:
+		return sqlite.New(cfg.StoragePath, opts)
+	case config.StorageDriverMemory:
+		return memory.New(), nil
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.StorageDriver)
+	}
+}
+
+// sqlStorage is implemented by the storage drivers backed by database/sql.
+type sqlStorage interface {
+	DB() *sql.DB
+	Prepare(ctx context.Context) error
+}
 
+// runMigrate runs a migrate subcommand (up, down, status or redo) against the storage.
+func runMigrate(log *slog.Logger, cfg *config.Config, store storage.Store, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: notes migrate up|down|status|redo")
+	}
+	s, ok := store.(sqlStorage)
+	if !ok {
+		return fmt.Errorf("storage driver %q has no migrations", cfg.StorageDriver)
+	}
+	m, err := migrator.New(log, s.DB(), cfg.StorageDriver)
+	if err != nil {
+		return err
+	}
+	return m.Run(context.Background(), args[0], os.Stdout)
+}
+
+// runRole gives a user a role from the command line, which is how the first
+// admin is made.
+func runRole(store storage.Store, args []string) error {
+	if len(args) != 2 || !models.ValidRole(args[1]) {
+		return fmt.Errorf("usage: notes role <username> user|admin|readonly")
+	}
+	ctx := context.Background()
+	u, err := store.GetUserByUsername(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	return store.SetUserRole(ctx, u.ID, args[1])
 }
 
 func setupLogger(env string) *slog.Logger {
@@ -84,7 +227,9 @@ func setupLogger(env string) *slog.Logger {
 			slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}),
 		)
 	}
-	return log
+	// Records logged with the context of a request or a purge carry its
+	// trace id.
+	return slog.New(sl.NewTraceHandler(log.Handler()))
 }
 
 func setupPrettySlog() *slog.Logger {
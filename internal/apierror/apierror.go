@@ -0,0 +1,183 @@
+// Package apierror is the catalogue of errors the API responds with. Every
+// entry has a stable code that clients can branch on and the HTTP status it
+// is served with; errors are rendered as RFC 7807 problem documents.
+package apierror
+
+import (
+	"errors"
+	"net/http"
+	"notes/internal/storage"
+	"notes/pkg/api/etag"
+	"notes/pkg/api/response"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Error is an entry of the catalogue.
+type Error struct {
+	Status int
+	Code   string
+	Title  string
+}
+
+var (
+	InvalidRequest       = &Error{http.StatusBadRequest, "invalid_request", "Request body is malformed"}
+	InvalidParameter     = &Error{http.StatusBadRequest, "invalid_parameter", "Request parameter is invalid"}
+	InvalidCursor        = &Error{http.StatusBadRequest, "invalid_cursor", "Pagination cursor is invalid"}
+	ValidationFailed     = &Error{http.StatusUnprocessableEntity, "validation_failed", "Request validation failed"}
+	InvalidPatch         = &Error{http.StatusUnprocessableEntity, "invalid_patch", "Patch cannot be applied"}
+	UnsupportedMediaType = &Error{http.StatusUnsupportedMediaType, "unsupported_media_type", "Content type is not supported"}
+	PayloadTooLarge      = &Error{http.StatusRequestEntityTooLarge, "payload_too_large", "Request body is too large"}
+
+	Unauthorized        = &Error{http.StatusUnauthorized, "unauthorized", "Authentication is required"}
+	InvalidToken        = &Error{http.StatusUnauthorized, "invalid_token", "Access token is invalid"}
+	SessionRevoked      = &Error{http.StatusUnauthorized, "session_revoked", "Session has been revoked"}
+	InvalidCredentials  = &Error{http.StatusUnauthorized, "invalid_credentials", "Username or password is invalid"}
+	InvalidRefreshToken = &Error{http.StatusUnauthorized, "invalid_refresh_token", "Refresh token is invalid"}
+	RefreshTokenExpired = &Error{http.StatusUnauthorized, "refresh_token_expired", "Refresh token has expired"}
+	RefreshTokenRevoked = &Error{http.StatusUnauthorized, "refresh_token_revoked", "Refresh token has been revoked"}
+	RefreshTokenReused  = &Error{http.StatusUnauthorized, "refresh_token_reused", "Refresh token has already been used"}
+	Forbidden           = &Error{http.StatusForbidden, "forbidden", "Access is forbidden"}
+	AccountLocked       = &Error{http.StatusForbidden, "account_locked", "Account is locked"}
+
+	RouteNotFound    = &Error{http.StatusNotFound, "route_not_found", "Route not found"}
+	MethodNotAllowed = &Error{http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed"}
+	UserNotFound     = &Error{http.StatusNotFound, "user_not_found", "User not found"}
+	NoteNotFound     = &Error{http.StatusNotFound, "note_not_found", "Note not found"}
+	RevisionNotFound = &Error{http.StatusNotFound, "revision_not_found", "Revision not found"}
+	NotebookNotFound = &Error{http.StatusNotFound, "notebook_not_found", "Notebook not found"}
+	ShareNotFound    = &Error{http.StatusNotFound, "share_not_found", "Share not found"}
+	LinkNotFound     = &Error{http.StatusNotFound, "link_not_found", "Link not found"}
+
+	UserExists           = &Error{http.StatusConflict, "user_exists", "Username is already taken"}
+	TitleExists          = &Error{http.StatusConflict, "title_exists", "Note title already exists"}
+	NotebookCycle        = &Error{http.StatusConflict, "notebook_cycle", "Notebook cannot be nested into itself"}
+	LastAdmin            = &Error{http.StatusConflict, "last_admin", "The last admin cannot be removed"}
+	ShareWithOwner       = &Error{http.StatusUnprocessableEntity, "share_with_owner", "Note cannot be shared with its owner"}
+	VersionMismatch      = &Error{http.StatusPreconditionFailed, "version_mismatch", "Note was modified by someone else"}
+	PreconditionRequired = &Error{http.StatusPreconditionRequired, "precondition_required", "If-Match header is required"}
+
+	LinkExpired          = &Error{http.StatusGone, "link_expired", "Link has expired"}
+	LinkPasswordRequired = &Error{http.StatusUnauthorized, "link_password_required", "Link is password protected"}
+	InvalidLinkPassword  = &Error{http.StatusForbidden, "invalid_link_password", "Link password is invalid"}
+
+	Internal    = &Error{http.StatusInternalServerError, "internal_error", "Internal server error"}
+	Unavailable = &Error{http.StatusServiceUnavailable, "unavailable", "Service is unavailable"}
+)
+
+// All returns every entry of the catalogue.
+func All() []*Error {
+	return []*Error{
+		InvalidRequest, InvalidParameter, InvalidCursor, ValidationFailed, InvalidPatch, UnsupportedMediaType, PayloadTooLarge,
+		Unauthorized, InvalidToken, SessionRevoked, InvalidCredentials,
+		InvalidRefreshToken, RefreshTokenExpired, RefreshTokenRevoked, RefreshTokenReused, Forbidden, AccountLocked,
+		RouteNotFound, MethodNotAllowed, UserNotFound, NoteNotFound, RevisionNotFound, NotebookNotFound, ShareNotFound, LinkNotFound,
+		UserExists, TitleExists, NotebookCycle, LastAdmin, ShareWithOwner, VersionMismatch, PreconditionRequired,
+		LinkExpired, LinkPasswordRequired, InvalidLinkPassword,
+		Internal, Unavailable,
+	}
+}
+
+// storageErrors maps the errors of the storage layer to their entries.
+var storageErrors = []struct {
+	err   error
+	entry *Error
+}{
+	{storage.ErrNoteNotFound, NoteNotFound},
+	{storage.ErrTitleExists, TitleExists},
+	{storage.ErrUserNotFound, UserNotFound},
+	{storage.ErrUserExists, UserExists},
+	{storage.ErrForbidden, Forbidden},
+	{storage.ErrLastAdmin, LastAdmin},
+	{storage.ErrVersionMismatch, VersionMismatch},
+	{storage.ErrRevisionNotFound, RevisionNotFound},
+	{storage.ErrNotebookNotFound, NotebookNotFound},
+	{storage.ErrNotebookCycle, NotebookCycle},
+	{storage.ErrShareNotFound, ShareNotFound},
+	{storage.ErrShareWithOwner, ShareWithOwner},
+	{storage.ErrLinkNotFound, LinkNotFound},
+	{storage.ErrLinkExpired, LinkExpired},
+	{storage.ErrLinkPasswordRequired, LinkPasswordRequired},
+	{storage.ErrInvalidLinkPassword, InvalidLinkPassword},
+	{storage.ErrTokenNotFound, InvalidRefreshToken},
+	{storage.ErrTokenExpired, RefreshTokenExpired},
+	{storage.ErrTokenRevoked, RefreshTokenRevoked},
+	{storage.ErrTokenReused, RefreshTokenReused},
+	{storage.ErrInvalidCursor, InvalidCursor},
+}
+
+// FromStorage returns the entry for an error of the storage layer, or
+// Internal for errors that are not in the catalogue.
+func FromStorage(err error) *Error {
+	for _, e := range storageErrors {
+		if errors.Is(err, e.err) {
+			return e.entry
+		}
+	}
+	return Internal
+}
+
+// Problem builds the problem document of e for the request. Detail explains
+// this occurrence of the error.
+func (e *Error) Problem(r *http.Request, detail string) response.Problem {
+	return response.Problem{
+		Type:     "urn:notes:problem:" + e.Code,
+		Title:    e.Title,
+		Status:   e.Status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+		Code:     e.Code,
+	}
+}
+
+// Render writes e as a problem document.
+func Render(w http.ResponseWriter, r *http.Request, e *Error, detail string) {
+	response.RenderProblem(w, e.Status, e.Problem(r, detail))
+}
+
+// RenderValidation writes ValidationFailed with the details of every field
+// the validator rejected.
+func RenderValidation(w http.ResponseWriter, r *http.Request, errs validator.ValidationErrors) {
+	RenderFields(w, r, response.ValidationError(errs))
+}
+
+// RenderFields writes ValidationFailed with the given field details, for
+// checks the validator tags cannot express.
+func RenderFields(w http.ResponseWriter, r *http.Request, fields []response.FieldError) {
+	RenderErrors(w, r, ValidationFailed, "request validation failed", fields)
+}
+
+// RenderParam writes InvalidParameter for a path or query parameter that
+// does not parse, with its field details when err is a response.FieldError.
+func RenderParam(w http.ResponseWriter, r *http.Request, err error) {
+	var field response.FieldError
+	if errors.As(err, &field) {
+		RenderErrors(w, r, InvalidParameter, field.Detail, []response.FieldError{field})
+		return
+	}
+	Render(w, r, InvalidParameter, err.Error())
+}
+
+// ConflictResponse is the problem document of a version mismatch, extended
+// with the version the note is at now.
+type ConflictResponse struct {
+	response.Problem
+	CurrentVersion int `json:"current_version"`
+}
+
+// RenderConflict writes VersionMismatch with the version the note is at now,
+// which is also sent as the ETag for the client to retry against.
+func RenderConflict(w http.ResponseWriter, r *http.Request, version int) {
+	w.Header().Set("ETag", etag.Format(version))
+	response.RenderProblem(w, VersionMismatch.Status, ConflictResponse{
+		Problem:        VersionMismatch.Problem(r, "note was modified by someone else"),
+		CurrentVersion: version,
+	})
+}
+
+// RenderErrors writes e with per-field details.
+func RenderErrors(w http.ResponseWriter, r *http.Request, e *Error, detail string, fields []response.FieldError) {
+	p := e.Problem(r, detail)
+	p.Errors = fields
+	response.RenderProblem(w, p.Status, p)
+}
@@ -8,16 +8,75 @@ import (
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
+const (
+	StorageDriverPostgres = "postgres"
+	StorageDriverSQLite   = "sqlite"
+	StorageDriverMemory   = "memory"
+)
+
+const (
+	TracingExporterNone   = "none"
+	TracingExporterStdout = "stdout"
+	TracingExporterOTLP   = "otlp"
+)
+
 type Config struct {
-	Env         string `yaml:"env" env-default:"local"`
-	StoragePath string `yaml:"storage_path" env-requiered:"true"`
-	HTTPServer  `yaml:"http_server"`
+	Env           string `yaml:"env" env-default:"local"`
+	StorageDriver string `yaml:"storage_driver" env-default:"postgres"`
+	StoragePath   string `yaml:"storage_path" env-requiered:"true"`
+	AutoMigrate   bool   `yaml:"auto_migrate" env-default:"false"`
+	// QueryTimeout bounds every storage call, so that a stuck query fails
+	// instead of holding a connection past the request. Keep it below
+	// http_server.timeout, or the request times out first.
+	QueryTimeout time.Duration `yaml:"query_timeout" env-default:"3s"`
+	HTTPServer   `yaml:"http_server"`
+	Trash        `yaml:"trash"`
+	Auth         `yaml:"auth"`
+	Tracing      `yaml:"tracing"`
+	Pool         `yaml:"pool"`
 }
 
 type HTTPServer struct {
-	Address     string        `yaml:"address" env-default:"localhost:8085"`
-	Timeout     time.Duration `yaml:"timeout" env-default:"4s"`
-	IdleTimeout time.Duration `yaml:"idle_timeout" env-default:"60s"`
+	Address         string        `yaml:"address" env-default:"localhost:8085"`
+	Timeout         time.Duration `yaml:"timeout" env-default:"4s"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout" env-default:"60s"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env-default:"10s"`
+	// DrainPeriod is how long the server keeps serving after a shutdown
+	// signal while /readyz already fails, so load balancers can take the
+	// instance out of rotation.
+	DrainPeriod time.Duration `yaml:"drain_period" env-default:"5s"`
+	// MetricsAddress moves /metrics to a separate listener, e.g. an internal
+	// port; when empty it is served by the main router.
+	MetricsAddress string `yaml:"metrics_address"`
+	// MaxBodySize caps request bodies, in bytes; larger ones are rejected
+	// with 413 before they reach the handlers.
+	MaxBodySize int64 `yaml:"max_body_size" env-default:"1048576"`
+}
+
+// Pool configures the connection pool of the postgres and sqlite drivers.
+type Pool struct {
+	MaxOpenConns    int           `yaml:"max_open_conns" env-default:"25"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env-default:"25"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env-default:"30m"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env-default:"5m"`
+}
+
+type Trash struct {
+	Retention time.Duration `yaml:"retention" env-default:"720h"`
+	// PurgeInterval is how often the trash is purged; zero disables purging.
+	PurgeInterval time.Duration `yaml:"purge_interval" env-default:"1h"`
+}
+
+type Tracing struct {
+	Exporter    string  `yaml:"exporter" env-default:"none"`
+	Endpoint    string  `yaml:"endpoint" env-default:"localhost:4318"`
+	Insecure    bool    `yaml:"insecure" env-default:"false"`
+	SampleRatio float64 `yaml:"sample_ratio" env-default:"1"`
+}
+
+type Auth struct {
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl" env-default:"15m"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" env-default:"720h"`
 }
 
 func Load() *Config {
@@ -0,0 +1,19 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/ilyakaznacheev/cleanenv"
+)
+
+// TestDefaultTimeouts checks that a query gives up before the request it
+// serves does, so the handler still gets to report the failure.
+func TestDefaultTimeouts(t *testing.T) {
+	var cfg Config
+	if err := cleanenv.ReadEnv(&cfg); err != nil {
+		t.Fatalf("read defaults: %v", err)
+	}
+	if cfg.QueryTimeout <= 0 || cfg.QueryTimeout >= cfg.HTTPServer.Timeout {
+		t.Errorf("query_timeout %s must be positive and below http_server.timeout %s", cfg.QueryTimeout, cfg.HTTPServer.Timeout)
+	}
+}
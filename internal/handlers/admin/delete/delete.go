@@ -0,0 +1,64 @@
+package delete
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"notes/internal/apierror"
+	JWTMiddleware "notes/internal/middleware"
+	"notes/internal/storage"
+	"notes/pkg/api/param"
+	"notes/pkg/api/response"
+	"notes/pkg/logger/sl"
+)
+
+type UserDeleter interface {
+	DeleteUser(ctx context.Context, userID int) error
+}
+
+// New deletes a user together with their notes, notebooks, shares, links and
+// sessions. Admins cannot delete themselves, and the last admin cannot be
+// deleted.
+func New(log *slog.Logger, userDeleter UserDeleter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.admin.delete.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		userID, err := param.Int(r, "user_id")
+		if err != nil {
+			log.ErrorContext(r.Context(), "invalid user id", sl.Err(err))
+			apierror.RenderParam(w, r, err)
+			return
+		}
+		if userID == JWTMiddleware.GetUserID(r.Context()) {
+			log.WarnContext(r.Context(), "admin tried to delete own account", slog.Int("user_id", userID))
+			apierror.Render(w, r, apierror.Forbidden, "cannot delete own account")
+			return
+		}
+		err = userDeleter.DeleteUser(r.Context(), userID)
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.InfoContext(r.Context(), "user not found", slog.Int("user_id", userID))
+			apierror.Render(w, r, apierror.UserNotFound, "user not found")
+			return
+		}
+		if errors.Is(err, storage.ErrLastAdmin) {
+			log.WarnContext(r.Context(), "tried to delete the last admin", slog.Int("user_id", userID))
+			apierror.Render(w, r, apierror.LastAdmin, "cannot delete the last admin")
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to delete user", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to delete user")
+			return
+		}
+
+		log.InfoContext(r.Context(), "user successfully deleted", slog.Int("user_id", userID))
+		render.JSON(w, r, response.OK())
+	}
+}
@@ -0,0 +1,64 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"notes/internal/apierror"
+	JWTMiddleware "notes/internal/middleware"
+	"notes/internal/storage"
+	"notes/pkg/api/param"
+	"notes/pkg/api/response"
+	"notes/pkg/logger/sl"
+)
+
+type UserLocker interface {
+	SetUserLocked(ctx context.Context, userID int, locked bool) error
+}
+
+// New locks the account of a user when locked is true, logging them out and
+// keeping them from logging in again, and unlocks it otherwise. Admins
+// cannot lock themselves out, nor lock the last admin who can log in.
+func New(log *slog.Logger, userLocker UserLocker, locked bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.admin.lock.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		userID, err := param.Int(r, "user_id")
+		if err != nil {
+			log.ErrorContext(r.Context(), "invalid user id", sl.Err(err))
+			apierror.RenderParam(w, r, err)
+			return
+		}
+		if locked && userID == JWTMiddleware.GetUserID(r.Context()) {
+			log.WarnContext(r.Context(), "admin tried to lock own account", slog.Int("user_id", userID))
+			apierror.Render(w, r, apierror.Forbidden, "cannot lock own account")
+			return
+		}
+		err = userLocker.SetUserLocked(r.Context(), userID, locked)
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.InfoContext(r.Context(), "user not found", slog.Int("user_id", userID))
+			apierror.Render(w, r, apierror.UserNotFound, "user not found")
+			return
+		}
+		if errors.Is(err, storage.ErrLastAdmin) {
+			log.WarnContext(r.Context(), "tried to lock the last admin", slog.Int("user_id", userID))
+			apierror.Render(w, r, apierror.LastAdmin, "cannot lock the last admin")
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to lock user", sl.Err(err), slog.Bool("locked", locked))
+			apierror.Render(w, r, apierror.Internal, "failed to lock user")
+			return
+		}
+
+		log.InfoContext(r.Context(), "user lock successfully changed", slog.Int("user_id", userID), slog.Bool("locked", locked))
+		render.JSON(w, r, response.OK())
+	}
+}
@@ -0,0 +1,42 @@
+package logout
+
+import (
+	"context"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"notes/internal/apierror"
+	"notes/pkg/api/param"
+	"notes/pkg/api/response"
+	"notes/pkg/logger/sl"
+)
+
+type SessionsRevoker interface {
+	RevokeAllSessions(ctx context.Context, userID int) error
+}
+
+// New ends every session of a user, on all devices.
+func New(log *slog.Logger, sessionsRevoker SessionsRevoker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.admin.logout.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		userID, err := param.Int(r, "user_id")
+		if err != nil {
+			log.ErrorContext(r.Context(), "invalid user id", sl.Err(err))
+			apierror.RenderParam(w, r, err)
+			return
+		}
+		if err := sessionsRevoker.RevokeAllSessions(r.Context(), userID); err != nil {
+			log.ErrorContext(r.Context(), "failed to revoke sessions", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to logout user")
+			return
+		}
+		log.InfoContext(r.Context(), "user successfully logged out everywhere", slog.Int("user_id", userID))
+		render.JSON(w, r, response.OK())
+	}
+}
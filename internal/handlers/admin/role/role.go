@@ -0,0 +1,82 @@
+package role
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"log/slog"
+	"net/http"
+	"notes/internal/apierror"
+	JWTMiddleware "notes/internal/middleware"
+	"notes/internal/storage"
+	"notes/pkg/api/param"
+	"notes/pkg/api/response"
+	"notes/pkg/api/validate"
+	"notes/pkg/logger/sl"
+)
+
+type Request struct {
+	Role string `json:"role" validate:"required,oneof=user admin readonly"`
+}
+
+type RoleSetter interface {
+	SetUserRole(ctx context.Context, userID int, role string) error
+}
+
+// New changes the role of a user. The user is logged out, so that their next
+// token carries the new role. Admins cannot change their own role, and the
+// last admin keeps theirs.
+func New(log *slog.Logger, roleSetter RoleSetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.admin.role.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		userID, err := param.Int(r, "user_id")
+		if err != nil {
+			log.ErrorContext(r.Context(), "invalid user id", sl.Err(err))
+			apierror.RenderParam(w, r, err)
+			return
+		}
+		if userID == JWTMiddleware.GetUserID(r.Context()) {
+			log.WarnContext(r.Context(), "admin tried to change own role", slog.Int("user_id", userID))
+			apierror.Render(w, r, apierror.Forbidden, "cannot change own role")
+			return
+		}
+		var req Request
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.ErrorContext(r.Context(), "failed to decode request body", sl.Err(err))
+			apierror.Render(w, r, apierror.InvalidRequest, "failed to decode request body")
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			validateErr := err.(validator.ValidationErrors)
+			log.ErrorContext(r.Context(), "invalid request", sl.Err(err))
+			apierror.RenderValidation(w, r, validateErr)
+			return
+		}
+		err = roleSetter.SetUserRole(r.Context(), userID, req.Role)
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.InfoContext(r.Context(), "user not found", slog.Int("user_id", userID))
+			apierror.Render(w, r, apierror.UserNotFound, "user not found")
+			return
+		}
+		if errors.Is(err, storage.ErrLastAdmin) {
+			log.WarnContext(r.Context(), "tried to demote the last admin", slog.Int("user_id", userID))
+			apierror.Render(w, r, apierror.LastAdmin, "cannot demote the last admin")
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to set role", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to set role")
+			return
+		}
+
+		log.InfoContext(r.Context(), "role successfully changed", slog.Int("user_id", userID), slog.String("role", req.Role))
+		render.JSON(w, r, response.OK())
+	}
+}
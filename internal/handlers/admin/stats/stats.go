@@ -0,0 +1,50 @@
+package stats
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"notes/internal/apierror"
+	"notes/internal/models"
+	"notes/internal/storage"
+	"notes/pkg/api/param"
+	"notes/pkg/logger/sl"
+)
+
+type NoteCounter interface {
+	GetNoteCounts(ctx context.Context, userID int) (*models.NoteCounts, error)
+}
+
+// New reports how many notes a user has.
+func New(log *slog.Logger, noteCounter NoteCounter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.admin.stats.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		userID, err := param.Int(r, "user_id")
+		if err != nil {
+			log.ErrorContext(r.Context(), "invalid user id", sl.Err(err))
+			apierror.RenderParam(w, r, err)
+			return
+		}
+		counts, err := noteCounter.GetNoteCounts(r.Context(), userID)
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.InfoContext(r.Context(), "user not found", slog.Int("user_id", userID))
+			apierror.Render(w, r, apierror.UserNotFound, "user not found")
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to count notes", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to count notes")
+			return
+		}
+		log.InfoContext(r.Context(), "note counts were delivered successfully", slog.Int("user_id", userID))
+		render.JSON(w, r, counts)
+	}
+}
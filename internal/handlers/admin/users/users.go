@@ -0,0 +1,62 @@
+package users
+
+import (
+	"context"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"notes/internal/apierror"
+	"notes/internal/models"
+	"notes/pkg/api/param"
+	"notes/pkg/logger/sl"
+	"strings"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 100
+)
+
+type UsersGetter interface {
+	GetUsers(ctx context.Context, query string, limit, offset int) ([]models.UserInfo, error)
+}
+
+// New lists the users, optionally only those whose username contains ?q=.
+func New(log *slog.Logger, usersGetter UsersGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.admin.users.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		limit, err := param.QueryInt(r, "limit", defaultLimit)
+		if err != nil {
+			log.ErrorContext(r.Context(), "invalid limit", sl.Err(err))
+			apierror.RenderParam(w, r, err)
+			return
+		}
+		offset, err := param.QueryInt(r, "offset", 0)
+		if err != nil {
+			log.ErrorContext(r.Context(), "invalid offset", sl.Err(err))
+			apierror.RenderParam(w, r, err)
+			return
+		}
+		if limit <= 0 {
+			limit = defaultLimit
+		}
+		limit = min(limit, maxLimit)
+		offset = max(offset, 0)
+
+		query := strings.TrimSpace(r.URL.Query().Get("q"))
+		users, err := usersGetter.GetUsers(r.Context(), query, limit, offset)
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to get users", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to get users")
+			return
+		}
+		log.InfoContext(r.Context(), "users were delivered successfully", slog.Int("count", len(users)))
+		render.JSON(w, r, users)
+	}
+}
@@ -0,0 +1,86 @@
+// Package handlertest serves requests to a single handler the way the router
+// does, for the tests of the handlers.
+package handlertest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	JWTMiddleware "notes/internal/middleware"
+	"notes/pkg/api/response"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+)
+
+// Request is a request made to a handler by an authenticated caller.
+type Request struct {
+	Method string
+	Target string
+	Body   string
+	Header map[string]string
+
+	// Caller is the principal the request is made as. Its zero value makes
+	// an anonymous request.
+	Caller JWTMiddleware.Principal
+}
+
+// Serve mounts h at pattern, a route pattern such as
+// /users/{id}/notes/{note_id}, and serves req with it.
+func Serve(t testing.TB, pattern string, h http.Handler, req Request) *httptest.ResponseRecorder {
+	t.Helper()
+	router := chi.NewRouter()
+	router.With(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if req.Caller.UserID != 0 {
+				ctx := JWTMiddleware.WithUser(r.Context(), req.Caller.UserID, req.Caller.Role)
+				if req.Caller.OwnerID != 0 {
+					ctx = JWTMiddleware.WithPrincipal(ctx, req.Caller)
+				}
+				r = r.WithContext(ctx)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}).Handle(pattern, h)
+
+	var body io.Reader
+	if req.Body != "" {
+		body = strings.NewReader(req.Body)
+	}
+	r := httptest.NewRequestWithContext(t.Context(), req.Method, req.Target, body)
+	for name, value := range req.Header {
+		r.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+// Owner is the principal of a user acting on their own resources.
+func Owner(userID int) JWTMiddleware.Principal {
+	return JWTMiddleware.Principal{UserID: userID, OwnerID: userID}
+}
+
+// Decode decodes the JSON body of w into v.
+func Decode(t testing.TB, w *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("decode %s: %v", w.Body, err)
+	}
+}
+
+// Problem decodes the problem document of w and checks its status and code.
+func Problem(t testing.TB, w *httptest.ResponseRecorder, status int, code string) response.Problem {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("status = %d, want %d: %s", w.Code, status, w.Body)
+	}
+	var p response.Problem
+	Decode(t, w, &p)
+	if p.Code != code {
+		t.Fatalf("code = %q, want %q: %s", p.Code, code, w.Body)
+	}
+	return p
+}
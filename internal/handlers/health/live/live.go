@@ -0,0 +1,14 @@
+package live
+
+import (
+	"github.com/go-chi/render"
+	"net/http"
+	"notes/pkg/api/response"
+)
+
+// New answers liveness probes: the process is up and serving HTTP.
+func New() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render.JSON(w, r, response.OK())
+	}
+}
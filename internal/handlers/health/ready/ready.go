@@ -0,0 +1,41 @@
+package ready
+
+import (
+	"context"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"notes/internal/apierror"
+	"notes/pkg/api/response"
+	"notes/pkg/logger/sl"
+	"sync/atomic"
+	"time"
+)
+
+const pingTimeout = 2 * time.Second
+
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// New answers readiness probes. The service is ready while the storage answers
+// and shutdown has not started, so no new traffic is routed to a draining instance.
+func New(log *slog.Logger, pinger Pinger, shuttingDown *atomic.Bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.health.ready.New"
+		log := log.With(slog.String("op", op))
+
+		if shuttingDown.Load() {
+			apierror.Render(w, r, apierror.Unavailable, "shutting down")
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), pingTimeout)
+		defer cancel()
+		if err := pinger.Ping(ctx); err != nil {
+			log.ErrorContext(r.Context(), "storage is not reachable", sl.Err(err))
+			apierror.Render(w, r, apierror.Unavailable, "storage is not reachable")
+			return
+		}
+		render.JSON(w, r, response.OK())
+	}
+}
@@ -0,0 +1,76 @@
+package delete
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"notes/internal/apierror"
+	JWTMiddleware "notes/internal/middleware"
+	"notes/internal/storage"
+	"notes/pkg/api/param"
+	"notes/pkg/api/response"
+	"notes/pkg/logger/sl"
+)
+
+type LinkRevoker interface {
+	RevokeNoteLink(ctx context.Context, ownerID, noteID, linkID int) error
+}
+
+func New(log *slog.Logger, linkRevoker LinkRevoker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.link.delete.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		principal, ok := JWTMiddleware.GetPrincipal(r.Context())
+		if !ok {
+			log.ErrorContext(r.Context(), "unauthorized: no principal in context")
+			apierror.Render(w, r, apierror.Unauthorized, "unauthorized")
+			return
+		}
+		noteID, err := param.Int(r, "note_id")
+		if err != nil {
+			log.ErrorContext(r.Context(), "invalid note id", sl.Err(err))
+			apierror.RenderParam(w, r, err)
+			return
+		}
+		linkID, err := param.Int(r, "link_id")
+		if err != nil {
+			log.ErrorContext(r.Context(), "invalid link id", sl.Err(err))
+			apierror.RenderParam(w, r, err)
+			return
+		}
+		err = linkRevoker.RevokeNoteLink(r.Context(), principal.OwnerID, noteID, linkID)
+		if errors.Is(err, storage.ErrNoteNotFound) {
+			log.InfoContext(r.Context(), "note not found", slog.Int("note_id", noteID))
+			apierror.Render(w, r, apierror.NoteNotFound, "note not found")
+			return
+		}
+		if errors.Is(err, storage.ErrForbidden) {
+			log.WarnContext(r.Context(), "forbidden link access",
+				slog.Int("note_id", noteID),
+				slog.Int("user_id", principal.OwnerID),
+			)
+			apierror.Render(w, r, apierror.Forbidden, "forbidden access")
+			return
+		}
+		if errors.Is(err, storage.ErrLinkNotFound) {
+			log.InfoContext(r.Context(), "link not found", slog.Int("note_id", noteID), slog.Int("link_id", linkID))
+			apierror.Render(w, r, apierror.LinkNotFound, "link not found")
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to revoke link", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to revoke link")
+			return
+		}
+
+		log.InfoContext(r.Context(), "link successfully revoked", slog.Int("note_id", noteID), slog.Int("link_id", linkID))
+		render.JSON(w, r, response.OK())
+	}
+}
@@ -0,0 +1,64 @@
+package getall
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"notes/internal/apierror"
+	JWTMiddleware "notes/internal/middleware"
+	"notes/internal/models"
+	"notes/internal/storage"
+	"notes/pkg/api/param"
+	"notes/pkg/logger/sl"
+)
+
+type LinksGetter interface {
+	GetNoteLinks(ctx context.Context, ownerID, noteID int) ([]models.NoteLink, error)
+}
+
+func New(log *slog.Logger, linksGetter LinksGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.link.getall.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		principal, ok := JWTMiddleware.GetPrincipal(r.Context())
+		if !ok {
+			log.ErrorContext(r.Context(), "unauthorized: no principal in context")
+			apierror.Render(w, r, apierror.Unauthorized, "unauthorized")
+			return
+		}
+		noteID, err := param.Int(r, "note_id")
+		if err != nil {
+			log.ErrorContext(r.Context(), "invalid note id", sl.Err(err))
+			apierror.RenderParam(w, r, err)
+			return
+		}
+		links, err := linksGetter.GetNoteLinks(r.Context(), principal.OwnerID, noteID)
+		if errors.Is(err, storage.ErrNoteNotFound) {
+			log.InfoContext(r.Context(), "note not found", slog.Int("note_id", noteID))
+			apierror.Render(w, r, apierror.NoteNotFound, "note not found")
+			return
+		}
+		if errors.Is(err, storage.ErrForbidden) {
+			log.WarnContext(r.Context(), "forbidden link access",
+				slog.Int("note_id", noteID),
+				slog.Int("user_id", principal.OwnerID),
+			)
+			apierror.Render(w, r, apierror.Forbidden, "forbidden access")
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to get links", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to get links")
+			return
+		}
+		log.InfoContext(r.Context(), "links were delivered successfully", slog.Int("note_id", noteID))
+		render.JSON(w, r, links)
+	}
+}
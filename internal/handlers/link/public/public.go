@@ -0,0 +1,64 @@
+package public
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"notes/internal/apierror"
+	"notes/internal/models"
+	"notes/internal/storage"
+	"notes/pkg/auth"
+	"notes/pkg/logger/sl"
+)
+
+// PasswordHeader carries the password of a password-protected link.
+const PasswordHeader = "X-Link-Password"
+
+type PublicNoteGetter interface {
+	GetPublicNote(ctx context.Context, tokenHash, password string) (*models.PublicNote, error)
+}
+
+// New serves a note through a public link. It runs without authentication.
+func New(log *slog.Logger, publicNoteGetter PublicNoteGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.link.public.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		token := chi.URLParam(r, "token")
+		note, err := publicNoteGetter.GetPublicNote(r.Context(), auth.HashOpaqueToken(token), r.Header.Get(PasswordHeader))
+		if errors.Is(err, storage.ErrLinkNotFound) {
+			log.InfoContext(r.Context(), "link not found")
+			apierror.Render(w, r, apierror.LinkNotFound, "link not found")
+			return
+		}
+		if errors.Is(err, storage.ErrLinkExpired) {
+			log.InfoContext(r.Context(), "link expired")
+			apierror.Render(w, r, apierror.LinkExpired, "link expired")
+			return
+		}
+		if errors.Is(err, storage.ErrLinkPasswordRequired) {
+			log.InfoContext(r.Context(), "link password required")
+			apierror.Render(w, r, apierror.LinkPasswordRequired, "link password required")
+			return
+		}
+		if errors.Is(err, storage.ErrInvalidLinkPassword) {
+			log.WarnContext(r.Context(), "invalid link password")
+			apierror.Render(w, r, apierror.InvalidLinkPassword, "invalid link password")
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to get public note", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to get note")
+			return
+		}
+		log.InfoContext(r.Context(), "public note was delivered successfully")
+		render.JSON(w, r, note)
+	}
+}
@@ -0,0 +1,111 @@
+package save
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"log/slog"
+	"net/http"
+	"notes/internal/apierror"
+	JWTMiddleware "notes/internal/middleware"
+	"notes/internal/storage"
+	"notes/pkg/api/param"
+	"notes/pkg/api/response"
+	"notes/pkg/api/validate"
+	"notes/pkg/auth"
+	"notes/pkg/logger/sl"
+	"time"
+)
+
+type Request struct {
+	ExpiresAt *time.Time `json:"expires_at"`
+	Password  string     `json:"password" validate:"omitempty,min=6"`
+}
+
+type Response struct {
+	response.Response
+	ID    int    `json:"id"`
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+type LinkSaver interface {
+	SaveNoteLink(ctx context.Context, ownerID, noteID int, tokenHash, password string, expiresAt *time.Time) (int, error)
+}
+
+func New(log *slog.Logger, linkSaver LinkSaver) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.link.save.New"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		principal, ok := JWTMiddleware.GetPrincipal(r.Context())
+		if !ok {
+			log.ErrorContext(r.Context(), "unauthorized: no principal in context")
+			apierror.Render(w, r, apierror.Unauthorized, "unauthorized")
+			return
+		}
+		noteID, err := param.Int(r, "note_id")
+		if err != nil {
+			log.ErrorContext(r.Context(), "invalid note id", sl.Err(err))
+			apierror.RenderParam(w, r, err)
+			return
+		}
+		var req Request
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.ErrorContext(r.Context(), "failed to decode request body", sl.Err(err))
+			apierror.Render(w, r, apierror.InvalidRequest, "failed to decode request")
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			validateErr := err.(validator.ValidationErrors)
+			log.ErrorContext(r.Context(), "invalid request", sl.Err(err))
+			apierror.RenderValidation(w, r, validateErr)
+			return
+		}
+		if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+			log.ErrorContext(r.Context(), "link expiry in the past", slog.Time("expires_at", *req.ExpiresAt))
+			apierror.RenderFields(w, r, []response.FieldError{
+				{Field: "expires_at", Code: "future", Detail: "field expires_at must be in the future"},
+			})
+			return
+		}
+
+		token, err := auth.NewOpaqueToken()
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to generate link token", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to create link")
+			return
+		}
+		linkID, err := linkSaver.SaveNoteLink(r.Context(), principal.OwnerID, noteID, auth.HashOpaqueToken(token), req.Password, req.ExpiresAt)
+		if errors.Is(err, storage.ErrNoteNotFound) {
+			log.InfoContext(r.Context(), "note not found", slog.Int("note_id", noteID))
+			apierror.Render(w, r, apierror.NoteNotFound, "note not found")
+			return
+		}
+		if errors.Is(err, storage.ErrForbidden) {
+			log.WarnContext(r.Context(), "forbidden link attempt",
+				slog.Int("note_id", noteID),
+				slog.Int("user_id", principal.OwnerID),
+			)
+			apierror.Render(w, r, apierror.Forbidden, "forbidden access")
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to create link", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to create link")
+			return
+		}
+		log.InfoContext(r.Context(), "link successfully created", slog.Int("note_id", noteID), slog.Int("link_id", linkID))
+		render.Status(r, http.StatusCreated)
+		render.JSON(w, r, Response{
+			Response: response.OK(),
+			ID:       linkID,
+			Token:    token,
+			URL:      "/public/notes/" + token,
+		})
+	}
+}
@@ -1,94 +1,68 @@
 package delete
 
 import (
+	"context"
 	"errors"
-	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/render"
 	"log/slog"
 	"net/http"
+	"notes/internal/apierror"
+	"notes/internal/metrics"
 	JWTMiddleware "notes/internal/middleware"
 	"notes/internal/storage"
+	"notes/pkg/api/param"
 	"notes/pkg/api/response"
 	"notes/pkg/logger/sl"
-	"strconv"
 )
 
 type NoteDeleter interface {
-	DeleteNote(noteID, userID int) error
-}
-
-func GetUserID(r *http.Request) (int, bool) {
-	uid := JWTMiddleware.GetUserID(r.Context())
-	if uid == 0 {
-		return 0, false
-	}
-	return uid, true
+	DeleteNote(ctx context.Context, noteID, userID int) error
 }
 
 func New(log *slog.Logger, noteDeleter NoteDeleter) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.note.delete.New"
 
-		log = log.With(
+		log := log.With(
 			slog.String("op", op),
 			slog.String("request_id", middleware.GetReqID(r.Context())),
 		)
-		userIDFromToken, ok := GetUserID(r)
+		principal, ok := JWTMiddleware.GetPrincipal(r.Context())
 		if !ok {
-			log.Error("unauthorized: no user_id in context")
-			render.Status(r, http.StatusUnauthorized)
-			render.JSON(w, r, response.Error("unauthorized"))
-			return
-		}
-
-		strUserID := chi.URLParam(r, "id")
-		userIDFromURL, err := strconv.Atoi(strUserID)
-		if err != nil {
-			log.Error("invalid user id", sl.Err(err))
-			render.JSON(w, r, response.Error("invalid user id"))
-			return
-		}
-
-		if userIDFromToken != userIDFromURL {
-			log.Warn("user id mismatch",
-				slog.Int("token_id", userIDFromToken),
-				slog.Int("url_id", userIDFromURL),
-			)
-			render.Status(r, http.StatusForbidden)
-			render.JSON(w, r, response.Error("forbidden access"))
+			log.ErrorContext(r.Context(), "unauthorized: no principal in context")
+			apierror.Render(w, r, apierror.Unauthorized, "unauthorized")
 			return
 		}
 
-		strNoteID := chi.URLParam(r, "note_id")
-		noteID, err := strconv.Atoi(strNoteID)
+		noteID, err := param.Int(r, "note_id")
 		if err != nil {
-			log.Error("invalid note id", sl.Err(err))
-			render.JSON(w, r, response.Error("invalid note id"))
+			log.ErrorContext(r.Context(), "invalid note id", sl.Err(err))
+			apierror.RenderParam(w, r, err)
 			return
 		}
-		err = noteDeleter.DeleteNote(noteID, userIDFromToken)
+		err = noteDeleter.DeleteNote(r.Context(), noteID, principal.OwnerID)
 		if errors.Is(err, storage.ErrNoteNotFound) {
-			log.Info("note not found", slog.Int("note_id", noteID))
-			render.JSON(w, r, response.Error("note not found"))
+			log.InfoContext(r.Context(), "note not found", slog.Int("note_id", noteID))
+			apierror.Render(w, r, apierror.NoteNotFound, "note not found")
 			return
 		}
 		if errors.Is(err, storage.ErrForbidden) {
-			log.Warn("forbidden delete attempt",
+			log.WarnContext(r.Context(), "forbidden delete attempt",
 				slog.Int("note_id", noteID),
-				slog.Int("user_id", userIDFromToken),
+				slog.Int("user_id", principal.OwnerID),
 			)
-			render.Status(r, http.StatusForbidden)
-			render.JSON(w, r, response.Error("forbidden access"))
+			apierror.Render(w, r, apierror.Forbidden, "forbidden access")
 			return
 		}
 		if err != nil {
-			log.Error("failed to delete note", sl.Err(err))
-			render.JSON(w, r, response.Error("failed to delete note"))
+			log.ErrorContext(r.Context(), "failed to delete note", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to delete note")
 			return
 		}
 
-		log.Info("note successfully deleted", slog.Int("note_id", noteID))
+		log.InfoContext(r.Context(), "note successfully deleted", slog.Int("note_id", noteID))
+		metrics.NotesDeleted.Inc()
 		render.JSON(w, r, response.OK())
 	}
 }
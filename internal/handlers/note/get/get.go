@@ -1,79 +1,64 @@
 package get
 
 import (
+	"context"
 	"errors"
-	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/render"
 	"log/slog"
 	"net/http"
+	"notes/internal/apierror"
 	JWTMiddleware "notes/internal/middleware"
 	"notes/internal/models"
 	"notes/internal/storage"
-	"notes/pkg/api/response"
+	"notes/pkg/api/etag"
+	"notes/pkg/api/param"
 	"notes/pkg/logger/sl"
-	"strconv"
 )
 
 type NoteGetter interface {
-	GetNote(userID, noteID int) (*models.Note, error)
+	GetNote(ctx context.Context, userID, noteID int) (*models.Note, error)
 }
 
-func GetUserID(r *http.Request) (int, bool) {
-	uid := JWTMiddleware.GetUserID(r.Context())
-	if uid == 0 {
-		return 0, false
-	}
-	return uid, true
-}
 func New(log *slog.Logger, noteGetter NoteGetter) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.note.get.New"
 
-		log = log.With(
+		log := log.With(
 			slog.String("op", op),
 			slog.String("request_id", middleware.GetReqID(r.Context())),
 		)
-		userIDFromToken, ok := GetUserID(r)
+		principal, ok := JWTMiddleware.GetPrincipal(r.Context())
 		if !ok {
-			log.Error("unauthorized: no user_id in context")
-			render.Status(r, http.StatusUnauthorized)
-			render.JSON(w, r, response.Error("unauthorized"))
+			log.ErrorContext(r.Context(), "unauthorized: no principal in context")
+			apierror.Render(w, r, apierror.Unauthorized, "unauthorized")
 			return
 		}
-		strUserID := chi.URLParam(r, "id")
-		userIDFromURL, err := strconv.Atoi(strUserID)
+		noteID, err := param.Int(r, "note_id")
 		if err != nil {
-			log.Error("invalid user id", sl.Err(err))
-			render.JSON(w, r, response.Error("invalid user id"))
+			log.ErrorContext(r.Context(), "invalid note id", sl.Err(err))
+			apierror.RenderParam(w, r, err)
 			return
 		}
-		if userIDFromToken != userIDFromURL {
-			log.Warn("user id mismatch", slog.Int("token_id", userIDFromToken), slog.Int("url_id", userIDFromURL))
-			render.Status(r, http.StatusForbidden)
-			render.JSON(w, r, response.Error("forbidden access"))
-			return
-		}
-		strNoteID := chi.URLParam(r, "note_id")
-		noteID, err := strconv.Atoi(strNoteID)
-		if err != nil {
-			log.Error("invalid note id", sl.Err(err))
-			render.JSON(w, r, response.Error("invalid note id"))
-			return
-		}
-		note, err := noteGetter.GetNote(userIDFromToken, noteID)
+		note, err := noteGetter.GetNote(r.Context(), principal.OwnerID, noteID)
 		if errors.Is(err, storage.ErrNoteNotFound) {
-			log.Info("note not found", slog.Int("note_id", noteID))
-			render.JSON(w, r, response.Error("note not found"))
+			log.InfoContext(r.Context(), "note not found", slog.Int("note_id", noteID))
+			apierror.Render(w, r, apierror.NoteNotFound, "note not found")
 			return
 
 		}
 		if err != nil {
-			log.Error("failed to get note", sl.Err(err))
-			render.JSON(w, r, response.Error("failed to get note"))
+			log.ErrorContext(r.Context(), "failed to get note", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to get note")
+			return
+		}
+		w.Header().Set("ETag", etag.Format(note.Version))
+		if inm := r.Header.Get("If-None-Match"); inm != "" && etag.Match(inm, note.Version) {
+			log.InfoContext(r.Context(), "note not modified", slog.Int("note_id", noteID))
+			w.WriteHeader(http.StatusNotModified)
 			return
 		}
-		log.Info("note was delivered successfully", slog.Int("note_id", noteID))
+		log.InfoContext(r.Context(), "note was delivered successfully", slog.Int("note_id", noteID))
 		render.JSON(w, r, note)
 
 	}
@@ -0,0 +1,73 @@
+package get
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	JWTMiddleware "notes/internal/middleware"
+	"notes/internal/models"
+	"notes/pkg/logger/sl"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type stubGetter struct{}
+
+func (stubGetter) GetNote(ctx context.Context, userID, noteID int) (*models.Note, error) {
+	return &models.Note{ID: noteID, UserID: userID, Title: "note", Version: 1}, nil
+}
+
+// TestLogTraceID makes concurrent requests through one handler and checks
+// that the log lines of each carry its own trace id and no one else's.
+func TestLogTraceID(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(sl.NewTraceHandler(slog.NewJSONHandler(&buf, nil)))
+	router := chi.NewRouter()
+	router.Get("/users/{id}/notes/{note_id}", New(log, stubGetter{}))
+
+	traceIDs := []trace.TraceID{{1}, {2}}
+	var wg sync.WaitGroup
+	for _, id := range traceIDs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx := trace.ContextWithSpanContext(t.Context(), trace.NewSpanContext(trace.SpanContextConfig{
+				TraceID: id,
+				SpanID:  trace.SpanID{1},
+			}))
+			ctx = JWTMiddleware.WithPrincipal(ctx, JWTMiddleware.Principal{UserID: 1, OwnerID: 1})
+			r := httptest.NewRequestWithContext(ctx, http.MethodGet, "/users/1/notes/1", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != http.StatusOK {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+		}()
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(traceIDs) {
+		t.Fatalf("got %d log lines, want %d:\n%s", len(lines), len(traceIDs), buf.String())
+	}
+	seen := make(map[string]bool)
+	for _, line := range lines {
+		if n := strings.Count(line, `"trace_id"`); n != 1 {
+			t.Errorf("line has %d trace ids: %s", n, line)
+		}
+		for _, id := range traceIDs {
+			if strings.Contains(line, id.String()) {
+				seen[id.String()] = true
+			}
+		}
+	}
+	if len(seen) != len(traceIDs) {
+		t.Errorf("trace ids logged: %v, want one line per request", seen)
+	}
+}
@@ -1,96 +1,167 @@
 package getall
 
 import (
+	"context"
 	"errors"
-	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/render"
 	"log/slog"
 	"net/http"
+	"notes/internal/apierror"
 	JWTMiddleware "notes/internal/middleware"
 	"notes/internal/models"
 	"notes/internal/storage"
-	"notes/pkg/api/response"
+	"notes/pkg/api/param"
 	"notes/pkg/logger/sl"
 	"strconv"
+	"time"
 )
 
-type AllNoteGetter interface {
-	GetAllNotes(userID, limit, offset int, sort string) ([]models.Note, error)
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+)
+
+// Response is one page of notes. Cursors are opaque and are passed back
+// through ?cursor= to fetch the neighbouring page; total is only filled
+// when requested with ?total=true.
+type Response struct {
+	Items      []models.Note `json:"items"`
+	NextCursor *string       `json:"next_cursor"`
+	PrevCursor *string       `json:"prev_cursor"`
+	Total      *int          `json:"total,omitempty"`
 }
 
-func GetUserID(r *http.Request) (int, bool) {
-	uid := JWTMiddleware.GetUserID(r.Context())
-	if uid == 0 {
-		return 0, false
-	}
-	return uid, true
+type AllNoteGetter interface {
+	GetAllNotes(ctx context.Context, userID int, page storage.PageRequest, filter storage.NoteFilter) (*storage.NotePage, error)
 }
 
 func New(log *slog.Logger, allNoteGetter AllNoteGetter) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.note.getall.New"
 
-		log = log.With(
+		log := log.With(
 			slog.String("op", op),
 			slog.String("request_id", middleware.GetReqID(r.Context())),
 		)
-		userIDFromToken, ok := GetUserID(r)
+		principal, ok := JWTMiddleware.GetPrincipal(r.Context())
 		if !ok {
-			log.Error("unauthorized: no user_id in context")
-			render.Status(r, http.StatusUnauthorized)
-			render.JSON(w, r, response.Error("unauthorized"))
+			log.ErrorContext(r.Context(), "unauthorized: no principal in context")
+			apierror.Render(w, r, apierror.Unauthorized, "unauthorized")
 			return
 		}
-		strUserID := chi.URLParam(r, "id")
-		userIDFromURL, err := strconv.Atoi(strUserID)
+
+		page := storage.PageRequest{
+			Limit: defaultLimit,
+			Sort:  storage.SortDesc,
+		}
+		limit, err := param.QueryInt(r, "limit", defaultLimit)
 		if err != nil {
-			log.Error("invalid user id", sl.Err(err))
-			render.JSON(w, r, response.Error("invalid user id"))
+			log.ErrorContext(r.Context(), "invalid limit", sl.Err(err))
+			apierror.RenderParam(w, r, err)
 			return
 		}
-		if userIDFromToken != userIDFromURL {
-			log.Warn("user id mismatch",
-				slog.Int("token_id", userIDFromToken),
-				slog.Int("url_id", userIDFromURL),
-			)
-			render.Status(r, http.StatusForbidden)
-			render.JSON(w, r, response.Error("forbidden access"))
-			return
+		if limit > 0 {
+			page.Limit = min(limit, maxLimit)
 		}
-
-		limit := 3
-		offset := 0
-		sort := "desc"
-
-		if l := r.URL.Query().Get("limit"); l != "" {
-			if v, err := strconv.Atoi(l); err == nil && v > 0 {
-				limit = v
+		if s := r.URL.Query().Get("sort"); s == storage.SortAsc {
+			page.Sort = storage.SortAsc
+		}
+		page.SortBy = storage.SortByCreatedAt
+		if sb := r.URL.Query().Get("sort_by"); sb != "" {
+			if !storage.ValidSortBy(sb) {
+				log.ErrorContext(r.Context(), "invalid sort field", slog.String("sort_by", sb))
+				apierror.Render(w, r, apierror.InvalidParameter, "invalid sort_by, expected created_at, updated_at or title")
+				return
+			}
+			page.SortBy = sb
+		}
+		if c := r.URL.Query().Get("cursor"); c != "" {
+			cursor, err := storage.DecodeCursor(c)
+			if err != nil {
+				log.ErrorContext(r.Context(), "invalid cursor", sl.Err(err))
+				apierror.Render(w, r, apierror.InvalidCursor, "invalid cursor")
+				return
+			}
+			if cursor.Sort != page.Sort || cursor.SortBy != page.SortBy {
+				log.ErrorContext(r.Context(), "cursor sort mismatch", slog.String("cursor_sort", cursor.Sort), slog.String("sort", page.Sort))
+				apierror.Render(w, r, apierror.InvalidCursor, "cursor does not match sort order")
+				return
 			}
+			page.Cursor = &cursor
+		}
+		page.WithTotal = r.URL.Query().Get("total") == "true"
+		filter := storage.NoteFilter{
+			Tags: storage.NormalizeTags(r.URL.Query()["tag"]),
 		}
-		if o := r.URL.Query().Get("offset"); o != "" {
-			if v, err := strconv.Atoi(o); err == nil && v > 0 {
-				offset = v
+		if r.URL.Query().Get("notebook") != "" {
+			notebookID, err := param.QueryInt(r, "notebook", 0)
+			if err != nil {
+				log.ErrorContext(r.Context(), "invalid notebook id", sl.Err(err))
+				apierror.RenderParam(w, r, err)
+				return
 			}
+			filter.NotebookID = &notebookID
 		}
-		if s := r.URL.Query().Get("sort"); s == "asc" {
-			sort = "asc"
+		for name, dst := range map[string]**time.Time{
+			"created_after":  &filter.CreatedAfter,
+			"created_before": &filter.CreatedBefore,
+			"updated_since":  &filter.UpdatedSince,
+		} {
+			v := r.URL.Query().Get(name)
+			if v == "" {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				log.ErrorContext(r.Context(), "invalid time filter", slog.String("param", name), sl.Err(err))
+				apierror.Render(w, r, apierror.InvalidParameter, "invalid "+name+", expected RFC 3339 time")
+				return
+			}
+			*dst = &t
 		}
-
-		notes, err := allNoteGetter.GetAllNotes(userIDFromToken, limit, offset, sort)
-		if errors.Is(err, storage.ErrNoteNotFound) {
-			log.Info("notes not found")
-			render.JSON(w, r, response.Error("notes not found"))
+		filter.TitlePrefix = r.URL.Query().Get("title_prefix")
+		if hc := r.URL.Query().Get("has_content"); hc != "" {
+			hasContent, err := strconv.ParseBool(hc)
+			if err != nil {
+				log.ErrorContext(r.Context(), "invalid has_content", sl.Err(err))
+				apierror.Render(w, r, apierror.InvalidParameter, "invalid has_content, expected true or false")
+				return
+			}
+			filter.HasContent = &hasContent
+		}
+		switch r.URL.Query().Get("tag_mode") {
+		case "", "any":
+		case "all":
+			filter.MatchAllTags = true
+		default:
+			log.ErrorContext(r.Context(), "invalid tag mode", slog.String("tag_mode", r.URL.Query().Get("tag_mode")))
+			apierror.Render(w, r, apierror.InvalidParameter, "invalid tag mode")
 			return
+		}
 
+		notes, err := allNoteGetter.GetAllNotes(r.Context(), principal.OwnerID, page, filter)
+		if errors.Is(err, storage.ErrInvalidCursor) {
+			log.ErrorContext(r.Context(), "invalid cursor", sl.Err(err))
+			apierror.Render(w, r, apierror.InvalidCursor, "invalid cursor")
+			return
 		}
 		if err != nil {
-			log.Error("failed to get notes", sl.Err(err))
-			render.JSON(w, r, response.Error("failed to get notes"))
+			log.ErrorContext(r.Context(), "failed to get notes", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to get notes")
 			return
 		}
-		log.Info("notes was delivered successfully")
-		render.JSON(w, r, notes)
+		resp := Response{Items: notes.Notes, Total: notes.Total}
+		if notes.Next != nil {
+			next := notes.Next.Encode()
+			resp.NextCursor = &next
+		}
+		if notes.Prev != nil {
+			prev := notes.Prev.Encode()
+			resp.PrevCursor = &prev
+		}
+		log.InfoContext(r.Context(), "notes was delivered successfully", slog.Int("count", len(notes.Notes)))
+		render.JSON(w, r, resp)
 
 	}
 }
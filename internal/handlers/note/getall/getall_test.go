@@ -0,0 +1,48 @@
+package getall
+
+import (
+	"context"
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+	"notes/internal/apierror"
+	"notes/internal/handlers/handlertest"
+	"notes/internal/storage"
+	"notes/internal/storage/memory"
+	"notes/internal/storage/storagetest"
+	"testing"
+)
+
+// TestCursorKey checks that a cursor whose key does not fit its sort field
+// is a bad request rather than a failure of the storage.
+func TestCursorKey(t *testing.T) {
+	store := memory.New()
+	alice := storagetest.NewUser(t, store, "alice")
+	storagetest.NewNote(t, store, alice, "groceries", "milk")
+
+	cursor := base64.RawURLEncoding.EncodeToString([]byte(`{"k":"garbage","id":1,"f":"created_at","s":"desc"}`))
+	w := handlertest.Serve(t, "/users/{id}/notes", New(slog.New(slog.DiscardHandler), store), handlertest.Request{
+		Method: http.MethodGet,
+		Target: "/users/1/notes?cursor=" + cursor,
+		Caller: handlertest.Owner(alice),
+	})
+	handlertest.Problem(t, w, http.StatusBadRequest, apierror.InvalidCursor.Code)
+}
+
+// cursorRejecter fails every listing the way a store fails on a cursor it
+// cannot use.
+type cursorRejecter struct{}
+
+func (cursorRejecter) GetAllNotes(ctx context.Context, userID int, page storage.PageRequest, filter storage.NoteFilter) (*storage.NotePage, error) {
+	return nil, storage.ErrInvalidCursor
+}
+
+func TestStorageRejectsCursor(t *testing.T) {
+	cursor := storage.Cursor{Key: "groceries", ID: 1, SortBy: storage.SortByTitle, Sort: storage.SortAsc}
+	w := handlertest.Serve(t, "/users/{id}/notes", New(slog.New(slog.DiscardHandler), cursorRejecter{}), handlertest.Request{
+		Method: http.MethodGet,
+		Target: "/users/1/notes?sort_by=title&sort=asc&cursor=" + cursor.Encode(),
+		Caller: handlertest.Owner(1),
+	})
+	handlertest.Problem(t, w, http.StatusBadRequest, apierror.InvalidCursor.Code)
+}
@@ -0,0 +1,72 @@
+package move
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"notes/internal/apierror"
+	JWTMiddleware "notes/internal/middleware"
+	"notes/internal/storage"
+	"notes/pkg/api/param"
+	"notes/pkg/api/response"
+	"notes/pkg/logger/sl"
+)
+
+// Request moves a note into a notebook; a null notebook_id moves it to the root.
+type Request struct {
+	NotebookID *int `json:"notebook_id"`
+}
+
+type NoteMover interface {
+	MoveNote(ctx context.Context, userID, noteID int, notebookID *int) error
+}
+
+func New(log *slog.Logger, noteMover NoteMover) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.note.move.New"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		principal, ok := JWTMiddleware.GetPrincipal(r.Context())
+		if !ok {
+			log.ErrorContext(r.Context(), "unauthorized: no principal in context")
+			apierror.Render(w, r, apierror.Unauthorized, "unauthorized")
+			return
+		}
+		noteID, err := param.Int(r, "note_id")
+		if err != nil {
+			log.ErrorContext(r.Context(), "invalid note id", sl.Err(err))
+			apierror.RenderParam(w, r, err)
+			return
+		}
+		var req Request
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.ErrorContext(r.Context(), "failed to decode request body", sl.Err(err))
+			apierror.Render(w, r, apierror.InvalidRequest, "failed to decode request body")
+			return
+		}
+		err = noteMover.MoveNote(r.Context(), principal.OwnerID, noteID, req.NotebookID)
+		if errors.Is(err, storage.ErrNoteNotFound) {
+			log.InfoContext(r.Context(), "note not found", slog.Int("note_id", noteID))
+			apierror.Render(w, r, apierror.NoteNotFound, "note not found")
+			return
+		}
+		if errors.Is(err, storage.ErrNotebookNotFound) {
+			log.InfoContext(r.Context(), "notebook not found", slog.Any("notebook_id", req.NotebookID))
+			apierror.Render(w, r, apierror.NotebookNotFound, "notebook not found")
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to move note", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to move note")
+			return
+		}
+
+		log.InfoContext(r.Context(), "note successfully moved", slog.Int("note_id", noteID), slog.Any("notebook_id", req.NotebookID))
+		render.JSON(w, r, response.OK())
+	}
+}
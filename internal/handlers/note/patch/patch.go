@@ -0,0 +1,223 @@
+package patch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"notes/internal/apierror"
+	"notes/internal/metrics"
+	JWTMiddleware "notes/internal/middleware"
+	"notes/internal/models"
+	"notes/internal/storage"
+	"notes/pkg/api/etag"
+	"notes/pkg/api/param"
+	"notes/pkg/api/response"
+	"notes/pkg/logger/sl"
+	"slices"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+)
+
+const (
+	MergePatchContentType = "application/merge-patch+json"
+	JSONPatchContentType  = "application/json-patch+json"
+)
+
+// Document is the patchable representation of a note.
+type Document struct {
+	Title   string   `json:"title"`
+	Content string   `json:"content"`
+	Tags    []string `json:"tags"`
+}
+
+type NotePatcher interface {
+	GetNote(ctx context.Context, userID, noteID int) (*models.Note, error)
+	PatchNote(ctx context.Context, noteID, userID int, patch storage.NotePatch, expectedVersion int) (int, error)
+}
+
+// New applies a JSON Merge Patch (RFC 7386) or a JSON Patch (RFC 6902) to a note,
+// chosen by the Content-Type of the request. Only fields that the patch
+// actually changes are written. Patches longer than maxBodySize bytes are
+// rejected, unless it is zero.
+func New(log *slog.Logger, notePatcher NotePatcher, maxBodySize int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.note.patch.New"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		principal, ok := JWTMiddleware.GetPrincipal(r.Context())
+		if !ok {
+			log.ErrorContext(r.Context(), "unauthorized: no principal in context")
+			apierror.Render(w, r, apierror.Unauthorized, "unauthorized")
+			return
+		}
+		noteID, err := param.Int(r, "note_id")
+		if err != nil {
+			log.ErrorContext(r.Context(), "invalid note id", sl.Err(err))
+			apierror.RenderParam(w, r, err)
+			return
+		}
+		contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if contentType != MergePatchContentType && contentType != JSONPatchContentType {
+			log.ErrorContext(r.Context(), "unsupported patch content type", slog.String("content_type", contentType))
+			apierror.Render(w, r, apierror.UnsupportedMediaType, "content type must be "+MergePatchContentType+" or "+JSONPatchContentType)
+			return
+		}
+		reader := r.Body
+		if maxBodySize > 0 {
+			reader = http.MaxBytesReader(w, r.Body, maxBodySize)
+		}
+		body, err := io.ReadAll(reader)
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to read request body", sl.Err(err))
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				apierror.Render(w, r, apierror.PayloadTooLarge, fmt.Sprintf("patch must be at most %d bytes", tooLarge.Limit))
+				return
+			}
+			apierror.Render(w, r, apierror.InvalidRequest, "failed to read request body")
+			return
+		}
+
+		note, err := notePatcher.GetNote(r.Context(), principal.OwnerID, noteID)
+		if errors.Is(err, storage.ErrNoteNotFound) {
+			log.InfoContext(r.Context(), "note not found", slog.Int("note_id", noteID))
+			apierror.Render(w, r, apierror.NoteNotFound, "note not found")
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to get note", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to get note")
+			return
+		}
+		if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && !etag.MatchStrong(ifMatch, note.Version) {
+			log.InfoContext(r.Context(), "note version mismatch", slog.Int("note_id", noteID), slog.Int("current_version", note.Version))
+			apierror.RenderConflict(w, r, note.Version)
+			return
+		}
+
+		original, err := json.Marshal(Document{Title: note.Title, Content: note.Content, Tags: note.Tags})
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to encode note", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to patch note")
+			return
+		}
+		patched, err := apply(contentType, original, body)
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to apply patch", sl.Err(err))
+			apierror.Render(w, r, apierror.InvalidPatch, "invalid patch: "+err.Error())
+			return
+		}
+		doc, err := decode(patched)
+		if err != nil {
+			log.ErrorContext(r.Context(), "invalid patched note", sl.Err(err))
+			apierror.Render(w, r, apierror.InvalidPatch, err.Error())
+			return
+		}
+
+		var patch storage.NotePatch
+		if doc.Title != note.Title {
+			patch.Title = &doc.Title
+		}
+		if doc.Content != note.Content {
+			patch.Content = &doc.Content
+		}
+		tags := storage.NormalizeTags(doc.Tags)
+		if !sameTags(tags, note.Tags) {
+			patch.Tags = &tags
+		}
+		if patch == (storage.NotePatch{}) {
+			log.InfoContext(r.Context(), "patch changes nothing", slog.Int("note_id", noteID))
+			w.Header().Set("ETag", etag.Format(note.Version))
+			render.JSON(w, r, response.OK())
+			return
+		}
+
+		// The note is patched against the version read above, so a concurrent
+		// write in between is reported instead of being overwritten.
+		version, err := notePatcher.PatchNote(r.Context(), noteID, principal.OwnerID, patch, note.Version)
+		if errors.Is(err, storage.ErrVersionMismatch) {
+			log.InfoContext(r.Context(), "note version mismatch", slog.Int("note_id", noteID), slog.Int("current_version", version))
+			apierror.RenderConflict(w, r, version)
+			return
+		}
+		if errors.Is(err, storage.ErrNoteNotFound) {
+			log.InfoContext(r.Context(), "note not found", slog.Int("note_id", noteID))
+			apierror.Render(w, r, apierror.NoteNotFound, "note not found")
+			return
+		}
+		if errors.Is(err, storage.ErrForbidden) {
+			log.WarnContext(r.Context(), "forbidden patch attempt",
+				slog.Int("note_id", noteID),
+				slog.Int("user_id", principal.OwnerID),
+			)
+			apierror.Render(w, r, apierror.Forbidden, "forbidden access")
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to patch note", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to patch note")
+			return
+		}
+
+		log.InfoContext(r.Context(), "note successfully patched", slog.Int("note_id", noteID), slog.Int("version", version))
+		metrics.NotesUpdated.Inc()
+		w.Header().Set("ETag", etag.Format(version))
+		render.JSON(w, r, response.OK())
+	}
+}
+
+func apply(contentType string, original, body []byte) ([]byte, error) {
+	if contentType == MergePatchContentType {
+		return jsonpatch.MergePatch(original, body)
+	}
+	p, err := jsonpatch.DecodePatch(body)
+	if err != nil {
+		return nil, err
+	}
+	return p.Apply(original)
+}
+
+// decode turns the patched document back into a note, rejecting fields that
+// cannot be patched. Removed content and tags become empty; title is required.
+func decode(patched []byte) (Document, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(patched, &fields); err != nil {
+		return Document{}, errors.New("patched note is not an object")
+	}
+	for name := range fields {
+		switch name {
+		case "title", "content", "tags":
+		default:
+			return Document{}, errors.New("field " + name + " cannot be patched")
+		}
+	}
+	var doc Document
+	if err := json.Unmarshal(patched, &doc); err != nil {
+		return Document{}, errors.New("patched note has invalid field types")
+	}
+	if doc.Title == "" {
+		return Document{}, errors.New("field Title is a required field")
+	}
+	for _, t := range doc.Tags {
+		if len(t) > 64 {
+			return Document{}, errors.New("field Tags is not valid")
+		}
+	}
+	return doc, nil
+}
+
+func sameTags(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
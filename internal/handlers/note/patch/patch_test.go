@@ -0,0 +1,80 @@
+package patch
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"notes/internal/apierror"
+	"notes/internal/handlers/handlertest"
+	"notes/internal/storage/memory"
+	"notes/internal/storage/storagetest"
+	"strings"
+	"testing"
+)
+
+func TestPatch(t *testing.T) {
+	const maxBodySize = 1 << 10
+	tests := []struct {
+		name        string
+		contentType string
+		ifMatch     string
+		body        string
+		status      int
+		code        string
+	}{
+		{"merge patch", MergePatchContentType, "", `{"content":"milk, eggs"}`, http.StatusOK, ""},
+		{"json patch", JSONPatchContentType, "", `[{"op":"replace","path":"/content","value":"milk, eggs"}]`, http.StatusOK, ""},
+		{"current version", MergePatchContentType, `"1"`, `{"content":"milk, eggs"}`, http.StatusOK, ""},
+		{"version list", MergePatchContentType, `"4", "1"`, `{"content":"milk, eggs"}`, http.StatusOK, ""},
+		{"stale version", MergePatchContentType, `"4"`, `{"content":"milk, eggs"}`, http.StatusPreconditionFailed, apierror.VersionMismatch.Code},
+		{"weak version", MergePatchContentType, `W/"1"`, `{"content":"milk, eggs"}`, http.StatusPreconditionFailed, apierror.VersionMismatch.Code},
+		{"unsupported content type", "application/json", "", `{"content":"milk, eggs"}`, http.StatusUnsupportedMediaType, apierror.UnsupportedMediaType.Code},
+		{"unknown field", MergePatchContentType, "", `{"owner":2}`, http.StatusUnprocessableEntity, apierror.InvalidPatch.Code},
+		{"too large", MergePatchContentType, "", `{"content":"` + strings.Repeat("a", maxBodySize) + `"}`, http.StatusRequestEntityTooLarge, apierror.PayloadTooLarge.Code},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := memory.New()
+			userID := storagetest.NewUser(t, store, "alice")
+			noteID := storagetest.NewNote(t, store, userID, "groceries", "milk")
+
+			header := map[string]string{"Content-Type": tt.contentType}
+			if tt.ifMatch != "" {
+				header["If-Match"] = tt.ifMatch
+			}
+			w := handlertest.Serve(t, "/users/{id}/notes/{note_id}", New(slog.New(slog.DiscardHandler), store, maxBodySize), handlertest.Request{
+				Method: http.MethodPatch,
+				Target: fmt.Sprintf("/users/%d/notes/%d", userID, noteID),
+				Body:   tt.body,
+				Header: header,
+				Caller: handlertest.Owner(userID),
+			})
+
+			if tt.status != http.StatusOK {
+				handlertest.Problem(t, w, tt.status, tt.code)
+				if got := content(t, store, userID, noteID); got != "milk" {
+					t.Errorf("content = %q after a failed patch", got)
+				}
+				return
+			}
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+			}
+			if got := w.Header().Get("ETag"); got != `"2"` {
+				t.Errorf("ETag = %s, want \"2\"", got)
+			}
+			if got := content(t, store, userID, noteID); got != "milk, eggs" {
+				t.Errorf("content = %q, want %q", got, "milk, eggs")
+			}
+		})
+	}
+}
+
+func content(t *testing.T, store *memory.Storage, userID, noteID int) string {
+	t.Helper()
+	note, err := store.GetNote(t.Context(), userID, noteID)
+	if err != nil {
+		t.Fatalf("GetNote(%d): %v", noteID, err)
+	}
+	return note.Content
+}
@@ -1,89 +1,68 @@
 package save
 
 import (
+	"context"
 	"log/slog"
 	"net/http"
+	"notes/internal/apierror"
 
-	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/render"
 	"github.com/go-playground/validator/v10"
+	"notes/internal/metrics"
 	JWTMiddleware "notes/internal/middleware"
+	"notes/internal/storage"
 	"notes/pkg/api/response"
+	"notes/pkg/api/validate"
 	"notes/pkg/logger/sl"
-	"strconv"
 )
 
 type Request struct {
-	Title   string `json:"title" validate:"required"`
-	Content string `json:"content"`
+	Title   string   `json:"title" validate:"required"`
+	Content string   `json:"content"`
+	Tags    []string `json:"tags" validate:"dive,max=64"`
 }
 
 type NoteSaver interface {
-	SaveNote(userID int, title, content string) error
-}
-
-func GetUserID(r *http.Request) (int, bool) {
-	uid := JWTMiddleware.GetUserID(r.Context())
-	if uid == 0 {
-		return 0, false
-	}
-	return uid, true
+	SaveNote(ctx context.Context, userID int, title, content string, tags []string) error
 }
 
 func New(log *slog.Logger, noteSaver NoteSaver) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.note.save.New"
-		log = log.With(
+		log := log.With(
 			slog.String("op", op),
 			slog.String("request_id", middleware.GetReqID(r.Context())),
 		)
-		userIDFromToken, ok := GetUserID(r)
+		principal, ok := JWTMiddleware.GetPrincipal(r.Context())
 		if !ok {
-			log.Error("unauthorized: no user_id in context")
-			render.Status(r, http.StatusUnauthorized)
-			render.JSON(w, r, response.Error("unauthorized"))
-			return
-		}
-
-		strUserID := chi.URLParam(r, "id")
-		userIDFromURL, err := strconv.Atoi(strUserID)
-		if err != nil {
-			log.Error("invalid user id", sl.Err(err))
-			render.JSON(w, r, response.Error("invalid user id"))
-			return
-		}
-		if userIDFromToken != userIDFromURL {
-			log.Warn("user id mismatch",
-				slog.Int("token_id", userIDFromToken),
-				slog.Int("url_id", userIDFromURL),
-			)
-			render.Status(r, http.StatusForbidden)
-			render.JSON(w, r, response.Error("forbidden"))
+			log.ErrorContext(r.Context(), "unauthorized: no principal in context")
+			apierror.Render(w, r, apierror.Unauthorized, "unauthorized")
 			return
 		}
 		var req Request
-		err = render.DecodeJSON(r.Body, &req)
+		err := render.DecodeJSON(r.Body, &req)
 		if err != nil {
-			log.Error("failed to decode request body", sl.Err(err))
-			render.JSON(w, r, response.Error("failed to decode request"))
+			log.ErrorContext(r.Context(), "failed to decode request body", sl.Err(err))
+			apierror.Render(w, r, apierror.InvalidRequest, "failed to decode request")
 			return
 		}
-		log.Info("decoded request", slog.Any("request", req))
-		if err := validator.New().Struct(req); err != nil {
+		log.InfoContext(r.Context(), "decoded request", slog.Any("request", req))
+		if err := validate.Struct(req); err != nil {
 			validateErr := err.(validator.ValidationErrors)
-			log.Error("invalid request", sl.Err(err))
-			render.JSON(w, r, response.ValidationError(validateErr))
+			log.ErrorContext(r.Context(), "invalid request", sl.Err(err))
+			apierror.RenderValidation(w, r, validateErr)
 			return
 		}
 
-		err = noteSaver.SaveNote(userIDFromToken, req.Title, req.Content)
+		err = noteSaver.SaveNote(r.Context(), principal.OwnerID, req.Title, req.Content, storage.NormalizeTags(req.Tags))
 		if err != nil {
-			log.Error("failed to create note", sl.Err(err))
-			render.JSON(w, r, response.Error("failed to create note"))
+			log.ErrorContext(r.Context(), "failed to create note", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to create note")
 			return
 		}
-		log.Info("note successfully created", slog.String("title", req.Title))
+		log.InfoContext(r.Context(), "note successfully created", slog.String("title", req.Title))
+		metrics.NotesCreated.Inc()
 		render.Status(r, http.StatusCreated)
 		render.JSON(w, r, response.OK())
 	}
@@ -0,0 +1,74 @@
+package search
+
+import (
+	"context"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"notes/internal/apierror"
+	JWTMiddleware "notes/internal/middleware"
+	"notes/internal/models"
+	"notes/pkg/api/param"
+	"notes/pkg/logger/sl"
+	"strings"
+)
+
+const (
+	defaultLimit = 10
+	maxLimit     = 100
+)
+
+type NoteSearcher interface {
+	SearchNotes(ctx context.Context, userID int, query string, limit, offset int) ([]models.SearchResult, error)
+}
+
+func New(log *slog.Logger, noteSearcher NoteSearcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.note.search.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		principal, ok := JWTMiddleware.GetPrincipal(r.Context())
+		if !ok {
+			log.ErrorContext(r.Context(), "unauthorized: no principal in context")
+			apierror.Render(w, r, apierror.Unauthorized, "unauthorized")
+			return
+		}
+
+		query := strings.TrimSpace(r.URL.Query().Get("q"))
+		if query == "" {
+			log.ErrorContext(r.Context(), "empty search query")
+			apierror.Render(w, r, apierror.InvalidParameter, "search query is required")
+			return
+		}
+		limit, err := param.QueryInt(r, "limit", defaultLimit)
+		if err != nil {
+			log.ErrorContext(r.Context(), "invalid limit", sl.Err(err))
+			apierror.RenderParam(w, r, err)
+			return
+		}
+		offset, err := param.QueryInt(r, "offset", 0)
+		if err != nil {
+			log.ErrorContext(r.Context(), "invalid offset", sl.Err(err))
+			apierror.RenderParam(w, r, err)
+			return
+		}
+		if limit <= 0 {
+			limit = defaultLimit
+		}
+		limit = min(limit, maxLimit)
+		offset = max(offset, 0)
+
+		results, err := noteSearcher.SearchNotes(r.Context(), principal.OwnerID, query, limit, offset)
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to search notes", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to search notes")
+			return
+		}
+		log.InfoContext(r.Context(), "search results were delivered successfully", slog.Int("count", len(results)))
+		render.JSON(w, r, results)
+	}
+}
@@ -1,106 +1,128 @@
 package update
 
 import (
+	"context"
 	"errors"
-	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/render"
 	"github.com/go-playground/validator/v10"
 	"log/slog"
 	"net/http"
+	"notes/internal/apierror"
+	"notes/internal/metrics"
 	JWTMiddleware "notes/internal/middleware"
+	"notes/internal/models"
 	"notes/internal/storage"
+	"notes/pkg/api/etag"
+	"notes/pkg/api/param"
 	"notes/pkg/api/response"
+	"notes/pkg/api/validate"
 	"notes/pkg/logger/sl"
-	"strconv"
+	"slices"
 )
 
 type Request struct {
-	Title   string `json:"title" validate:"required"`
-	Content string `json:"content"`
+	Title   string   `json:"title" validate:"required"`
+	Content string   `json:"content"`
+	Tags    []string `json:"tags" validate:"dive,max=64"`
 }
 
 type NoteUpdater interface {
-	UpdateNote(noteID int, userID int, title, content string) error
-}
-
-func GetUserID(r *http.Request) (int, bool) {
-	uid := JWTMiddleware.GetUserID(r.Context())
-	if uid == 0 {
-		return 0, false
-	}
-	return uid, true
+	GetNote(ctx context.Context, userID, noteID int) (*models.Note, error)
+	UpdateNote(ctx context.Context, noteID int, userID int, title, content string, tags []string, expectedVersion int) (int, error)
 }
 
 func New(log *slog.Logger, noteUpdater NoteUpdater) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.note.update.New"
-		log = log.With(
+		log := log.With(
 			slog.String("op", op),
 			slog.String("request_id", middleware.GetReqID(r.Context())),
 		)
-		userIDFromToken, ok := GetUserID(r)
+		principal, ok := JWTMiddleware.GetPrincipal(r.Context())
 		if !ok {
-			log.Error("unauthorized: no user_id in context")
-			render.Status(r, http.StatusUnauthorized)
-			render.JSON(w, r, response.Error("unauthorized"))
+			log.ErrorContext(r.Context(), "unauthorized: no principal in context")
+			apierror.Render(w, r, apierror.Unauthorized, "unauthorized")
 			return
 		}
-		strUserID := chi.URLParam(r, "id")
-		userIDFromURL, err := strconv.Atoi(strUserID)
+		noteID, err := param.Int(r, "note_id")
 		if err != nil {
-			log.Error("invalid user id", sl.Err(err))
-			render.JSON(w, r, response.Error("invalid user id"))
+			log.ErrorContext(r.Context(), "invalid note id", sl.Err(err))
+			apierror.RenderParam(w, r, err)
 			return
 		}
-		if userIDFromToken != userIDFromURL {
-			log.Warn("user id mismatch", slog.Int("token_id", userIDFromToken), slog.Int("url_id", userIDFromURL))
-			render.Status(r, http.StatusForbidden)
-			render.JSON(w, r, response.Error("forbidden access"))
+		ifMatch := r.Header.Get("If-Match")
+		if ifMatch == "" {
+			log.WarnContext(r.Context(), "update without If-Match", slog.Int("note_id", noteID))
+			apierror.Render(w, r, apierror.PreconditionRequired, "If-Match header is required")
 			return
 		}
-		strNoteID := chi.URLParam(r, "note_id")
-		noteID, err := strconv.Atoi(strNoteID)
-		if err != nil {
-			log.Error("invalid note id", sl.Err(err))
-			render.JSON(w, r, response.Error("invalid note id"))
-			return
+		// "*" matches any version and a header without a usable tag matches
+		// none. Of a list of tags, the one of the current version is expected.
+		expectedVersion := -1
+		versions, wildcard := etag.List(ifMatch, true)
+		switch {
+		case wildcard:
+			expectedVersion = 0
+		case len(versions) == 1:
+			expectedVersion = versions[0]
+		case len(versions) > 1:
+			note, err := noteUpdater.GetNote(r.Context(), principal.OwnerID, noteID)
+			if errors.Is(err, storage.ErrNoteNotFound) {
+				log.InfoContext(r.Context(), "note not found", slog.Int("note_id", noteID))
+				apierror.Render(w, r, apierror.NoteNotFound, "note not found")
+				return
+			}
+			if err != nil {
+				log.ErrorContext(r.Context(), "failed to get note", sl.Err(err))
+				apierror.Render(w, r, apierror.Internal, "failed to update note")
+				return
+			}
+			if slices.Contains(versions, note.Version) {
+				expectedVersion = note.Version
+			}
 		}
 		var req Request
 		if err := render.DecodeJSON(r.Body, &req); err != nil {
-			log.Error("failed to decode request body", sl.Err(err))
-			render.JSON(w, r, response.Error("failed to decode request body"))
+			log.ErrorContext(r.Context(), "failed to decode request body", sl.Err(err))
+			apierror.Render(w, r, apierror.InvalidRequest, "failed to decode request body")
 			return
 		}
-		log.Info("decoded request", slog.Any("request", req))
-		if err := validator.New().Struct(req); err != nil {
+		log.InfoContext(r.Context(), "decoded request", slog.Any("request", req))
+		if err := validate.Struct(req); err != nil {
 			validateErr := err.(validator.ValidationErrors)
-			log.Error("invalid request", sl.Err(err))
-			render.JSON(w, r, response.ValidationError(validateErr))
+			log.ErrorContext(r.Context(), "invalid request", sl.Err(err))
+			apierror.RenderValidation(w, r, validateErr)
+			return
+		}
+		version, err := noteUpdater.UpdateNote(r.Context(), noteID, principal.OwnerID, req.Title, req.Content, storage.NormalizeTags(req.Tags), expectedVersion)
+		if errors.Is(err, storage.ErrVersionMismatch) {
+			log.InfoContext(r.Context(), "note version mismatch", slog.Int("note_id", noteID), slog.Int("current_version", version))
+			apierror.RenderConflict(w, r, version)
 			return
 		}
-		err = noteUpdater.UpdateNote(noteID, userIDFromToken, req.Title, req.Content)
 		if errors.Is(err, storage.ErrNoteNotFound) {
-			log.Info("note not found", slog.Int("note_id", noteID))
-			render.JSON(w, r, response.Error("note not found"))
+			log.InfoContext(r.Context(), "note not found", slog.Int("note_id", noteID))
+			apierror.Render(w, r, apierror.NoteNotFound, "note not found")
 			return
 		}
 		if errors.Is(err, storage.ErrForbidden) {
-			log.Warn("forbidden update attempt",
+			log.WarnContext(r.Context(), "forbidden update attempt",
 				slog.Int("note_id", noteID),
-				slog.Int("user_id", userIDFromToken),
+				slog.Int("user_id", principal.OwnerID),
 			)
-			render.Status(r, http.StatusForbidden)
-			render.JSON(w, r, response.Error("forbidden access"))
+			apierror.Render(w, r, apierror.Forbidden, "forbidden access")
 			return
 		}
 		if err != nil {
-			log.Error("failed to update note", sl.Err(err))
-			render.JSON(w, r, response.Error("failed to update note"))
+			log.ErrorContext(r.Context(), "failed to update note", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to update note")
 			return
 		}
 
-		log.Info("note successfully updated", slog.Int("note_id", noteID))
+		log.InfoContext(r.Context(), "note successfully updated", slog.Int("note_id", noteID), slog.Int("version", version))
+		metrics.NotesUpdated.Inc()
+		w.Header().Set("ETag", etag.Format(version))
 		render.JSON(w, r, response.OK())
 
 	}
@@ -0,0 +1,85 @@
+package update
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"notes/internal/apierror"
+	"notes/internal/handlers/handlertest"
+	"notes/internal/storage/memory"
+	"notes/internal/storage/storagetest"
+	"testing"
+)
+
+func TestIfMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		ifMatch string
+		status  int
+		code    string
+	}{
+		{"missing", "", http.StatusPreconditionRequired, apierror.PreconditionRequired.Code},
+		{"current", `"1"`, http.StatusOK, ""},
+		{"stale", `"5"`, http.StatusPreconditionFailed, apierror.VersionMismatch.Code},
+		{"list", `"7", "1"`, http.StatusOK, ""},
+		{"list without current", `"7", "8"`, http.StatusPreconditionFailed, apierror.VersionMismatch.Code},
+		{"wildcard", "*", http.StatusOK, ""},
+		{"weak", `W/"1"`, http.StatusPreconditionFailed, apierror.VersionMismatch.Code},
+		{"malformed", `"abc"`, http.StatusPreconditionFailed, apierror.VersionMismatch.Code},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := memory.New()
+			userID := storagetest.NewUser(t, store, "alice")
+			noteID := storagetest.NewNote(t, store, userID, "groceries", "milk")
+
+			header := map[string]string{"Content-Type": "application/json"}
+			if tt.ifMatch != "" {
+				header["If-Match"] = tt.ifMatch
+			}
+			w := handlertest.Serve(t, "/users/{id}/notes/{note_id}", New(slog.New(slog.DiscardHandler), store), handlertest.Request{
+				Method: http.MethodPut,
+				Target: fmt.Sprintf("/users/%d/notes/%d", userID, noteID),
+				Body:   `{"title":"groceries","content":"milk, eggs"}`,
+				Header: header,
+				Caller: handlertest.Owner(userID),
+			})
+
+			if tt.status != http.StatusOK {
+				handlertest.Problem(t, w, tt.status, tt.code)
+				if tt.status == http.StatusPreconditionFailed {
+					var res apierror.ConflictResponse
+					handlertest.Decode(t, w, &res)
+					if res.CurrentVersion != 1 || w.Header().Get("ETag") != `"1"` {
+						t.Errorf("current version %d, ETag %s, want 1", res.CurrentVersion, w.Header().Get("ETag"))
+					}
+				}
+				return
+			}
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+			}
+			if got := w.Header().Get("ETag"); got != `"2"` {
+				t.Errorf("ETag = %s, want \"2\"", got)
+			}
+		})
+	}
+}
+
+// TestNotOwner checks that resolving an If-Match list does not reveal the
+// notes of other users.
+func TestNotOwner(t *testing.T) {
+	store := memory.New()
+	alice := storagetest.NewUser(t, store, "alice")
+	bob := storagetest.NewUser(t, store, "bob")
+	noteID := storagetest.NewNote(t, store, alice, "groceries", "milk")
+
+	w := handlertest.Serve(t, "/users/{id}/notes/{note_id}", New(slog.New(slog.DiscardHandler), store), handlertest.Request{
+		Method: http.MethodPut,
+		Target: fmt.Sprintf("/users/%d/notes/%d", bob, noteID),
+		Body:   `{"title":"mine now"}`,
+		Header: map[string]string{"Content-Type": "application/json", "If-Match": `"7", "1"`},
+		Caller: handlertest.Owner(bob),
+	})
+	handlertest.Problem(t, w, http.StatusNotFound, apierror.NoteNotFound.Code)
+}
@@ -0,0 +1,69 @@
+package delete
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"notes/internal/apierror"
+	JWTMiddleware "notes/internal/middleware"
+	"notes/internal/storage"
+	"notes/pkg/api/param"
+	"notes/pkg/api/response"
+	"notes/pkg/logger/sl"
+)
+
+type NotebookDeleter interface {
+	DeleteNotebook(ctx context.Context, userID, notebookID int, recursive bool) error
+}
+
+// New deletes a notebook. ?mode=recursive also removes nested notebooks and
+// trashes their notes; the default ?mode=move moves its contents to the root.
+func New(log *slog.Logger, notebookDeleter NotebookDeleter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.notebook.delete.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		principal, ok := JWTMiddleware.GetPrincipal(r.Context())
+		if !ok {
+			log.ErrorContext(r.Context(), "unauthorized: no principal in context")
+			apierror.Render(w, r, apierror.Unauthorized, "unauthorized")
+			return
+		}
+		notebookID, err := param.Int(r, "notebook_id")
+		if err != nil {
+			log.ErrorContext(r.Context(), "invalid notebook id", sl.Err(err))
+			apierror.RenderParam(w, r, err)
+			return
+		}
+		recursive := false
+		switch mode := r.URL.Query().Get("mode"); mode {
+		case "", "move":
+		case "recursive":
+			recursive = true
+		default:
+			log.ErrorContext(r.Context(), "invalid delete mode", slog.String("mode", mode))
+			apierror.Render(w, r, apierror.InvalidParameter, "invalid delete mode")
+			return
+		}
+		err = notebookDeleter.DeleteNotebook(r.Context(), principal.OwnerID, notebookID, recursive)
+		if errors.Is(err, storage.ErrNotebookNotFound) {
+			log.InfoContext(r.Context(), "notebook not found", slog.Int("notebook_id", notebookID))
+			apierror.Render(w, r, apierror.NotebookNotFound, "notebook not found")
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to delete notebook", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to delete notebook")
+			return
+		}
+
+		log.InfoContext(r.Context(), "notebook successfully deleted", slog.Int("notebook_id", notebookID), slog.Bool("recursive", recursive))
+		render.JSON(w, r, response.OK())
+	}
+}
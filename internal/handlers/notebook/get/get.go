@@ -0,0 +1,56 @@
+package get
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"notes/internal/apierror"
+	JWTMiddleware "notes/internal/middleware"
+	"notes/internal/models"
+	"notes/internal/storage"
+	"notes/pkg/api/param"
+	"notes/pkg/logger/sl"
+)
+
+type NotebookGetter interface {
+	GetNotebook(ctx context.Context, userID, notebookID int) (*models.Notebook, error)
+}
+
+func New(log *slog.Logger, notebookGetter NotebookGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.notebook.get.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		principal, ok := JWTMiddleware.GetPrincipal(r.Context())
+		if !ok {
+			log.ErrorContext(r.Context(), "unauthorized: no principal in context")
+			apierror.Render(w, r, apierror.Unauthorized, "unauthorized")
+			return
+		}
+		notebookID, err := param.Int(r, "notebook_id")
+		if err != nil {
+			log.ErrorContext(r.Context(), "invalid notebook id", sl.Err(err))
+			apierror.RenderParam(w, r, err)
+			return
+		}
+		notebook, err := notebookGetter.GetNotebook(r.Context(), principal.OwnerID, notebookID)
+		if errors.Is(err, storage.ErrNotebookNotFound) {
+			log.InfoContext(r.Context(), "notebook not found", slog.Int("notebook_id", notebookID))
+			apierror.Render(w, r, apierror.NotebookNotFound, "notebook not found")
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to get notebook", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to get notebook")
+			return
+		}
+		log.InfoContext(r.Context(), "notebook was delivered successfully", slog.Int("notebook_id", notebookID))
+		render.JSON(w, r, notebook)
+	}
+}
@@ -0,0 +1,43 @@
+package getall
+
+import (
+	"context"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"notes/internal/apierror"
+	JWTMiddleware "notes/internal/middleware"
+	"notes/internal/models"
+	"notes/pkg/logger/sl"
+)
+
+type NotebooksGetter interface {
+	GetNotebooks(ctx context.Context, userID int) ([]models.Notebook, error)
+}
+
+func New(log *slog.Logger, notebooksGetter NotebooksGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.notebook.getall.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		principal, ok := JWTMiddleware.GetPrincipal(r.Context())
+		if !ok {
+			log.ErrorContext(r.Context(), "unauthorized: no principal in context")
+			apierror.Render(w, r, apierror.Unauthorized, "unauthorized")
+			return
+		}
+
+		notebooks, err := notebooksGetter.GetNotebooks(r.Context(), principal.OwnerID)
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to get notebooks", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to get notebooks")
+			return
+		}
+		log.InfoContext(r.Context(), "notebooks were delivered successfully", slog.Int("count", len(notebooks)))
+		render.JSON(w, r, notebooks)
+	}
+}
@@ -0,0 +1,75 @@
+package save
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"log/slog"
+	"net/http"
+	"notes/internal/apierror"
+	JWTMiddleware "notes/internal/middleware"
+	"notes/internal/storage"
+	"notes/pkg/api/response"
+	"notes/pkg/api/validate"
+	"notes/pkg/logger/sl"
+)
+
+type Request struct {
+	Name     string `json:"name" validate:"required,max=255"`
+	ParentID *int   `json:"parent_id"`
+}
+
+type Response struct {
+	response.Response
+	ID int `json:"id"`
+}
+
+type NotebookSaver interface {
+	SaveNotebook(ctx context.Context, userID int, name string, parentID *int) (int, error)
+}
+
+func New(log *slog.Logger, notebookSaver NotebookSaver) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.notebook.save.New"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		principal, ok := JWTMiddleware.GetPrincipal(r.Context())
+		if !ok {
+			log.ErrorContext(r.Context(), "unauthorized: no principal in context")
+			apierror.Render(w, r, apierror.Unauthorized, "unauthorized")
+			return
+		}
+		var req Request
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.ErrorContext(r.Context(), "failed to decode request body", sl.Err(err))
+			apierror.Render(w, r, apierror.InvalidRequest, "failed to decode request")
+			return
+		}
+		log.InfoContext(r.Context(), "decoded request", slog.Any("request", req))
+		if err := validate.Struct(req); err != nil {
+			validateErr := err.(validator.ValidationErrors)
+			log.ErrorContext(r.Context(), "invalid request", sl.Err(err))
+			apierror.RenderValidation(w, r, validateErr)
+			return
+		}
+
+		notebookID, err := notebookSaver.SaveNotebook(r.Context(), principal.OwnerID, req.Name, req.ParentID)
+		if errors.Is(err, storage.ErrNotebookNotFound) {
+			log.InfoContext(r.Context(), "parent notebook not found", slog.Any("parent_id", req.ParentID))
+			apierror.Render(w, r, apierror.NotebookNotFound, "parent notebook not found")
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to create notebook", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to create notebook")
+			return
+		}
+		log.InfoContext(r.Context(), "notebook successfully created", slog.Int("notebook_id", notebookID))
+		render.Status(r, http.StatusCreated)
+		render.JSON(w, r, Response{Response: response.OK(), ID: notebookID})
+	}
+}
@@ -0,0 +1,81 @@
+package update
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"log/slog"
+	"net/http"
+	"notes/internal/apierror"
+	JWTMiddleware "notes/internal/middleware"
+	"notes/internal/storage"
+	"notes/pkg/api/param"
+	"notes/pkg/api/response"
+	"notes/pkg/api/validate"
+	"notes/pkg/logger/sl"
+)
+
+type Request struct {
+	Name     string `json:"name" validate:"required,max=255"`
+	ParentID *int   `json:"parent_id"`
+}
+
+type NotebookUpdater interface {
+	UpdateNotebook(ctx context.Context, userID, notebookID int, name string, parentID *int) error
+}
+
+func New(log *slog.Logger, notebookUpdater NotebookUpdater) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.notebook.update.New"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		principal, ok := JWTMiddleware.GetPrincipal(r.Context())
+		if !ok {
+			log.ErrorContext(r.Context(), "unauthorized: no principal in context")
+			apierror.Render(w, r, apierror.Unauthorized, "unauthorized")
+			return
+		}
+		notebookID, err := param.Int(r, "notebook_id")
+		if err != nil {
+			log.ErrorContext(r.Context(), "invalid notebook id", sl.Err(err))
+			apierror.RenderParam(w, r, err)
+			return
+		}
+		var req Request
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.ErrorContext(r.Context(), "failed to decode request body", sl.Err(err))
+			apierror.Render(w, r, apierror.InvalidRequest, "failed to decode request body")
+			return
+		}
+		log.InfoContext(r.Context(), "decoded request", slog.Any("request", req))
+		if err := validate.Struct(req); err != nil {
+			validateErr := err.(validator.ValidationErrors)
+			log.ErrorContext(r.Context(), "invalid request", sl.Err(err))
+			apierror.RenderValidation(w, r, validateErr)
+			return
+		}
+		err = notebookUpdater.UpdateNotebook(r.Context(), principal.OwnerID, notebookID, req.Name, req.ParentID)
+		if errors.Is(err, storage.ErrNotebookNotFound) {
+			log.InfoContext(r.Context(), "notebook not found", slog.Int("notebook_id", notebookID), slog.Any("parent_id", req.ParentID))
+			apierror.Render(w, r, apierror.NotebookNotFound, "notebook not found")
+			return
+		}
+		if errors.Is(err, storage.ErrNotebookCycle) {
+			log.WarnContext(r.Context(), "notebook cycle", slog.Int("notebook_id", notebookID), slog.Any("parent_id", req.ParentID))
+			apierror.Render(w, r, apierror.NotebookCycle, "notebook cannot be nested into itself")
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to update notebook", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to update notebook")
+			return
+		}
+
+		log.InfoContext(r.Context(), "notebook successfully updated", slog.Int("notebook_id", notebookID))
+		render.JSON(w, r, response.OK())
+	}
+}
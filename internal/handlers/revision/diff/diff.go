@@ -0,0 +1,130 @@
+package diff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/pmezard/go-difflib/difflib"
+	"log/slog"
+	"net/http"
+	"notes/internal/apierror"
+	JWTMiddleware "notes/internal/middleware"
+	"notes/internal/models"
+	"notes/internal/storage"
+	"notes/pkg/api/param"
+	"notes/pkg/logger/sl"
+	"strconv"
+)
+
+type Response struct {
+	From int    `json:"from"`
+	To   string `json:"to"`
+	Diff string `json:"diff"`
+}
+
+type RevisionDiffer interface {
+	GetRevision(ctx context.Context, userID, noteID, revision int) (*models.Revision, error)
+	GetNote(ctx context.Context, userID, noteID int) (*models.Note, error)
+}
+
+// New renders a unified diff between revision ?from= and revision ?to=.
+// Without ?to= the diff is taken against the current state of the note.
+func New(log *slog.Logger, revisionDiffer RevisionDiffer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.revision.diff.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		principal, ok := JWTMiddleware.GetPrincipal(r.Context())
+		if !ok {
+			log.ErrorContext(r.Context(), "unauthorized: no principal in context")
+			apierror.Render(w, r, apierror.Unauthorized, "unauthorized")
+			return
+		}
+		noteID, err := param.Int(r, "note_id")
+		if err != nil {
+			log.ErrorContext(r.Context(), "invalid note id", sl.Err(err))
+			apierror.RenderParam(w, r, err)
+			return
+		}
+		if r.URL.Query().Get("from") == "" {
+			log.ErrorContext(r.Context(), "missing from revision")
+			apierror.RenderParam(w, r, param.Missing("from"))
+			return
+		}
+		from, err := param.QueryInt(r, "from", 0)
+		if err != nil {
+			log.ErrorContext(r.Context(), "invalid from revision", sl.Err(err))
+			apierror.RenderParam(w, r, err)
+			return
+		}
+
+		fromRev, err := revisionDiffer.GetRevision(r.Context(), principal.OwnerID, noteID, from)
+		if err != nil {
+			renderLookupError(w, r, log, noteID, err)
+			return
+		}
+		resp := Response{From: from, To: "current"}
+		var toTitle, toContent string
+		if r.URL.Query().Get("to") != "" {
+			to, err := param.QueryInt(r, "to", 0)
+			if err != nil {
+				log.ErrorContext(r.Context(), "invalid to revision", sl.Err(err))
+				apierror.RenderParam(w, r, err)
+				return
+			}
+			toRev, err := revisionDiffer.GetRevision(r.Context(), principal.OwnerID, noteID, to)
+			if err != nil {
+				renderLookupError(w, r, log, noteID, err)
+				return
+			}
+			resp.To = strconv.Itoa(to)
+			toTitle, toContent = toRev.Title, toRev.Content
+		} else {
+			note, err := revisionDiffer.GetNote(r.Context(), principal.OwnerID, noteID)
+			if err != nil {
+				renderLookupError(w, r, log, noteID, err)
+				return
+			}
+			toTitle, toContent = note.Title, note.Content
+		}
+
+		resp.Diff, err = difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(document(fromRev.Title, fromRev.Content)),
+			B:        difflib.SplitLines(document(toTitle, toContent)),
+			FromFile: "revision " + strconv.Itoa(from),
+			ToFile:   "revision " + resp.To,
+			Context:  3,
+		})
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to build diff", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to build diff")
+			return
+		}
+		log.InfoContext(r.Context(), "revision diff was delivered successfully", slog.Int("note_id", noteID))
+		render.JSON(w, r, resp)
+	}
+}
+
+// document lays out a note version as plain text so title changes show up in the diff.
+func document(title, content string) string {
+	return fmt.Sprintf("%s\n\n%s\n", title, content)
+}
+
+func renderLookupError(w http.ResponseWriter, r *http.Request, log *slog.Logger, noteID int, err error) {
+	switch {
+	case errors.Is(err, storage.ErrNoteNotFound):
+		log.InfoContext(r.Context(), "note not found", slog.Int("note_id", noteID))
+		apierror.Render(w, r, apierror.NoteNotFound, "note not found")
+	case errors.Is(err, storage.ErrRevisionNotFound):
+		log.InfoContext(r.Context(), "revision not found", slog.Int("note_id", noteID))
+		apierror.Render(w, r, apierror.RevisionNotFound, "revision not found")
+	default:
+		log.ErrorContext(r.Context(), "failed to get revision", sl.Err(err))
+		apierror.Render(w, r, apierror.Internal, "failed to get revision")
+	}
+}
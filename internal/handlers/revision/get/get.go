@@ -0,0 +1,67 @@
+package get
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"notes/internal/apierror"
+	JWTMiddleware "notes/internal/middleware"
+	"notes/internal/models"
+	"notes/internal/storage"
+	"notes/pkg/api/param"
+	"notes/pkg/logger/sl"
+)
+
+type RevisionGetter interface {
+	GetRevision(ctx context.Context, userID, noteID, revision int) (*models.Revision, error)
+}
+
+func New(log *slog.Logger, revisionGetter RevisionGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.revision.get.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		principal, ok := JWTMiddleware.GetPrincipal(r.Context())
+		if !ok {
+			log.ErrorContext(r.Context(), "unauthorized: no principal in context")
+			apierror.Render(w, r, apierror.Unauthorized, "unauthorized")
+			return
+		}
+		noteID, err := param.Int(r, "note_id")
+		if err != nil {
+			log.ErrorContext(r.Context(), "invalid note id", sl.Err(err))
+			apierror.RenderParam(w, r, err)
+			return
+		}
+		revision, err := param.Int(r, "rev")
+		if err != nil {
+			log.ErrorContext(r.Context(), "invalid revision", sl.Err(err))
+			apierror.RenderParam(w, r, err)
+			return
+		}
+		rev, err := revisionGetter.GetRevision(r.Context(), principal.OwnerID, noteID, revision)
+		if errors.Is(err, storage.ErrNoteNotFound) {
+			log.InfoContext(r.Context(), "note not found", slog.Int("note_id", noteID))
+			apierror.Render(w, r, apierror.NoteNotFound, "note not found")
+			return
+		}
+		if errors.Is(err, storage.ErrRevisionNotFound) {
+			log.InfoContext(r.Context(), "revision not found", slog.Int("note_id", noteID), slog.Int("revision", revision))
+			apierror.Render(w, r, apierror.RevisionNotFound, "revision not found")
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to get revision", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to get revision")
+			return
+		}
+		log.InfoContext(r.Context(), "revision was delivered successfully", slog.Int("note_id", noteID), slog.Int("revision", revision))
+		render.JSON(w, r, rev)
+	}
+}
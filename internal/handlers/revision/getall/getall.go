@@ -0,0 +1,56 @@
+package getall
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"notes/internal/apierror"
+	JWTMiddleware "notes/internal/middleware"
+	"notes/internal/models"
+	"notes/internal/storage"
+	"notes/pkg/api/param"
+	"notes/pkg/logger/sl"
+)
+
+type RevisionsGetter interface {
+	GetRevisions(ctx context.Context, userID, noteID int) ([]models.Revision, error)
+}
+
+func New(log *slog.Logger, revisionsGetter RevisionsGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.revision.getall.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		principal, ok := JWTMiddleware.GetPrincipal(r.Context())
+		if !ok {
+			log.ErrorContext(r.Context(), "unauthorized: no principal in context")
+			apierror.Render(w, r, apierror.Unauthorized, "unauthorized")
+			return
+		}
+		noteID, err := param.Int(r, "note_id")
+		if err != nil {
+			log.ErrorContext(r.Context(), "invalid note id", sl.Err(err))
+			apierror.RenderParam(w, r, err)
+			return
+		}
+		revisions, err := revisionsGetter.GetRevisions(r.Context(), principal.OwnerID, noteID)
+		if errors.Is(err, storage.ErrNoteNotFound) {
+			log.InfoContext(r.Context(), "note not found", slog.Int("note_id", noteID))
+			apierror.Render(w, r, apierror.NoteNotFound, "note not found")
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to get revisions", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to get revisions")
+			return
+		}
+		log.InfoContext(r.Context(), "revisions were delivered successfully", slog.Int("note_id", noteID))
+		render.JSON(w, r, revisions)
+	}
+}
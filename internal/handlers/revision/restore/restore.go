@@ -0,0 +1,75 @@
+package restore
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"notes/internal/apierror"
+	JWTMiddleware "notes/internal/middleware"
+	"notes/internal/storage"
+	"notes/pkg/api/param"
+	"notes/pkg/api/response"
+	"notes/pkg/logger/sl"
+)
+
+type RevisionRestorer interface {
+	RestoreRevision(ctx context.Context, userID, noteID, revision int) error
+}
+
+func New(log *slog.Logger, revisionRestorer RevisionRestorer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.revision.restore.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		principal, ok := JWTMiddleware.GetPrincipal(r.Context())
+		if !ok {
+			log.ErrorContext(r.Context(), "unauthorized: no principal in context")
+			apierror.Render(w, r, apierror.Unauthorized, "unauthorized")
+			return
+		}
+		noteID, err := param.Int(r, "note_id")
+		if err != nil {
+			log.ErrorContext(r.Context(), "invalid note id", sl.Err(err))
+			apierror.RenderParam(w, r, err)
+			return
+		}
+		revision, err := param.Int(r, "rev")
+		if err != nil {
+			log.ErrorContext(r.Context(), "invalid revision", sl.Err(err))
+			apierror.RenderParam(w, r, err)
+			return
+		}
+		err = revisionRestorer.RestoreRevision(r.Context(), principal.OwnerID, noteID, revision)
+		if errors.Is(err, storage.ErrNoteNotFound) {
+			log.InfoContext(r.Context(), "note not found", slog.Int("note_id", noteID))
+			apierror.Render(w, r, apierror.NoteNotFound, "note not found")
+			return
+		}
+		if errors.Is(err, storage.ErrRevisionNotFound) {
+			log.InfoContext(r.Context(), "revision not found", slog.Int("note_id", noteID), slog.Int("revision", revision))
+			apierror.Render(w, r, apierror.RevisionNotFound, "revision not found")
+			return
+		}
+		if errors.Is(err, storage.ErrForbidden) {
+			log.WarnContext(r.Context(), "forbidden restore attempt",
+				slog.Int("note_id", noteID),
+				slog.Int("user_id", principal.OwnerID),
+			)
+			apierror.Render(w, r, apierror.Forbidden, "forbidden access")
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to restore revision", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to restore revision")
+			return
+		}
+		log.InfoContext(r.Context(), "revision successfully restored", slog.Int("note_id", noteID), slog.Int("revision", revision))
+		render.JSON(w, r, response.OK())
+	}
+}
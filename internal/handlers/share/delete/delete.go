@@ -0,0 +1,76 @@
+package delete
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"notes/internal/apierror"
+	JWTMiddleware "notes/internal/middleware"
+	"notes/internal/storage"
+	"notes/pkg/api/param"
+	"notes/pkg/api/response"
+	"notes/pkg/logger/sl"
+)
+
+type NoteUnsharer interface {
+	UnshareNote(ctx context.Context, ownerID, noteID, userID int) error
+}
+
+func New(log *slog.Logger, noteUnsharer NoteUnsharer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.share.delete.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		principal, ok := JWTMiddleware.GetPrincipal(r.Context())
+		if !ok {
+			log.ErrorContext(r.Context(), "unauthorized: no principal in context")
+			apierror.Render(w, r, apierror.Unauthorized, "unauthorized")
+			return
+		}
+		noteID, err := param.Int(r, "note_id")
+		if err != nil {
+			log.ErrorContext(r.Context(), "invalid note id", sl.Err(err))
+			apierror.RenderParam(w, r, err)
+			return
+		}
+		shareUserID, err := param.Int(r, "user_id")
+		if err != nil {
+			log.ErrorContext(r.Context(), "invalid share user id", sl.Err(err))
+			apierror.RenderParam(w, r, err)
+			return
+		}
+		err = noteUnsharer.UnshareNote(r.Context(), principal.OwnerID, noteID, shareUserID)
+		if errors.Is(err, storage.ErrNoteNotFound) {
+			log.InfoContext(r.Context(), "note not found", slog.Int("note_id", noteID))
+			apierror.Render(w, r, apierror.NoteNotFound, "note not found")
+			return
+		}
+		if errors.Is(err, storage.ErrForbidden) {
+			log.WarnContext(r.Context(), "forbidden share attempt",
+				slog.Int("note_id", noteID),
+				slog.Int("user_id", principal.OwnerID),
+			)
+			apierror.Render(w, r, apierror.Forbidden, "forbidden access")
+			return
+		}
+		if errors.Is(err, storage.ErrShareNotFound) {
+			log.InfoContext(r.Context(), "share not found", slog.Int("note_id", noteID), slog.Int("share_user_id", shareUserID))
+			apierror.Render(w, r, apierror.ShareNotFound, "share not found")
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to unshare note", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to unshare note")
+			return
+		}
+
+		log.InfoContext(r.Context(), "note successfully unshared", slog.Int("note_id", noteID), slog.Int("share_user_id", shareUserID))
+		render.JSON(w, r, response.OK())
+	}
+}
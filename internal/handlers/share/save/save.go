@@ -0,0 +1,98 @@
+package save
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"log/slog"
+	"net/http"
+	"notes/internal/apierror"
+	JWTMiddleware "notes/internal/middleware"
+	"notes/internal/storage"
+	"notes/pkg/api/param"
+	"notes/pkg/api/response"
+	"notes/pkg/api/validate"
+	"notes/pkg/logger/sl"
+)
+
+type Request struct {
+	Username   string `json:"username" validate:"required"`
+	Permission string `json:"permission" validate:"required,oneof=read write"`
+}
+
+type NoteSharer interface {
+	ShareNote(ctx context.Context, ownerID, noteID int, username, permission string) error
+}
+
+func New(log *slog.Logger, noteSharer NoteSharer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.share.save.New"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		principal, ok := JWTMiddleware.GetPrincipal(r.Context())
+		if !ok {
+			log.ErrorContext(r.Context(), "unauthorized: no principal in context")
+			apierror.Render(w, r, apierror.Unauthorized, "unauthorized")
+			return
+		}
+		noteID, err := param.Int(r, "note_id")
+		if err != nil {
+			log.ErrorContext(r.Context(), "invalid note id", sl.Err(err))
+			apierror.RenderParam(w, r, err)
+			return
+		}
+		var req Request
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.ErrorContext(r.Context(), "failed to decode request body", sl.Err(err))
+			apierror.Render(w, r, apierror.InvalidRequest, "failed to decode request")
+			return
+		}
+		log.InfoContext(r.Context(), "decoded request", slog.Any("request", req))
+		if err := validate.Struct(req); err != nil {
+			validateErr := err.(validator.ValidationErrors)
+			log.ErrorContext(r.Context(), "invalid request", sl.Err(err))
+			apierror.RenderValidation(w, r, validateErr)
+			return
+		}
+
+		err = noteSharer.ShareNote(r.Context(), principal.OwnerID, noteID, req.Username, req.Permission)
+		if errors.Is(err, storage.ErrNoteNotFound) {
+			log.InfoContext(r.Context(), "note not found", slog.Int("note_id", noteID))
+			apierror.Render(w, r, apierror.NoteNotFound, "note not found")
+			return
+		}
+		if errors.Is(err, storage.ErrForbidden) {
+			log.WarnContext(r.Context(), "forbidden share attempt",
+				slog.Int("note_id", noteID),
+				slog.Int("user_id", principal.OwnerID),
+			)
+			apierror.Render(w, r, apierror.Forbidden, "forbidden access")
+			return
+		}
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.InfoContext(r.Context(), "user not found", slog.String("username", req.Username))
+			apierror.Render(w, r, apierror.UserNotFound, "user not found")
+			return
+		}
+		if errors.Is(err, storage.ErrShareWithOwner) {
+			log.InfoContext(r.Context(), "note shared with its owner", slog.Int("note_id", noteID))
+			apierror.Render(w, r, apierror.ShareWithOwner, "note cannot be shared with its owner")
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to share note", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to share note")
+			return
+		}
+		log.InfoContext(r.Context(), "note successfully shared",
+			slog.Int("note_id", noteID),
+			slog.String("username", req.Username),
+			slog.String("permission", req.Permission),
+		)
+		render.JSON(w, r, response.OK())
+	}
+}
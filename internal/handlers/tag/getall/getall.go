@@ -0,0 +1,43 @@
+package getall
+
+import (
+	"context"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"notes/internal/apierror"
+	JWTMiddleware "notes/internal/middleware"
+	"notes/internal/models"
+	"notes/pkg/logger/sl"
+)
+
+type TagGetter interface {
+	GetTags(ctx context.Context, userID int) ([]models.Tag, error)
+}
+
+func New(log *slog.Logger, tagGetter TagGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.tag.getall.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		principal, ok := JWTMiddleware.GetPrincipal(r.Context())
+		if !ok {
+			log.ErrorContext(r.Context(), "unauthorized: no principal in context")
+			apierror.Render(w, r, apierror.Unauthorized, "unauthorized")
+			return
+		}
+
+		tags, err := tagGetter.GetTags(r.Context(), principal.OwnerID)
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to get tags", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to get tags")
+			return
+		}
+		log.InfoContext(r.Context(), "tags were delivered successfully", slog.Int("count", len(tags)))
+		render.JSON(w, r, tags)
+	}
+}
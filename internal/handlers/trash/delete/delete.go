@@ -0,0 +1,57 @@
+package delete
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"notes/internal/apierror"
+	JWTMiddleware "notes/internal/middleware"
+	"notes/internal/storage"
+	"notes/pkg/api/param"
+	"notes/pkg/api/response"
+	"notes/pkg/logger/sl"
+)
+
+type NotePurger interface {
+	PurgeNote(ctx context.Context, userID, noteID int) error
+}
+
+func New(log *slog.Logger, notePurger NotePurger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.trash.delete.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		principal, ok := JWTMiddleware.GetPrincipal(r.Context())
+		if !ok {
+			log.ErrorContext(r.Context(), "unauthorized: no principal in context")
+			apierror.Render(w, r, apierror.Unauthorized, "unauthorized")
+			return
+		}
+		noteID, err := param.Int(r, "note_id")
+		if err != nil {
+			log.ErrorContext(r.Context(), "invalid note id", sl.Err(err))
+			apierror.RenderParam(w, r, err)
+			return
+		}
+		err = notePurger.PurgeNote(r.Context(), principal.OwnerID, noteID)
+		if errors.Is(err, storage.ErrNoteNotFound) {
+			log.InfoContext(r.Context(), "note not found in trash", slog.Int("note_id", noteID))
+			apierror.Render(w, r, apierror.NoteNotFound, "note not found in trash")
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to purge note", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to purge note")
+			return
+		}
+
+		log.InfoContext(r.Context(), "note successfully purged", slog.Int("note_id", noteID))
+		render.JSON(w, r, response.OK())
+	}
+}
@@ -1,13 +1,16 @@
 package login
 
 import (
+	"context"
 	"errors"
 	"log/slog"
 	"net/http"
+	"notes/internal/apierror"
+	"notes/internal/metrics"
 	"notes/internal/models"
+	"notes/internal/session"
 	"notes/internal/storage"
-	"notes/pkg/api/response"
-	"notes/pkg/auth"
+	"notes/pkg/api/validate"
 	"notes/pkg/logger/sl"
 
 	"github.com/go-chi/chi/middleware"
@@ -22,56 +25,64 @@ type Request struct {
 }
 
 type UserSignIn interface {
-	GetUserByUsername(username string) (*models.User, error)
+	GetUserByUsername(ctx context.Context, username string) (*models.User, error)
+	session.RefreshTokenSaver
 }
 
-func New(log *slog.Logger, userSignIn UserSignIn) http.HandlerFunc {
+func New(log *slog.Logger, userSignIn UserSignIn, issuer session.Issuer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.user.login.New"
 
-		log = log.With(
+		log := log.With(
 			slog.String("op", op),
 			slog.String("request_id", middleware.GetReqID(r.Context())),
 		)
 		var req Request
 		if err := render.DecodeJSON(r.Body, &req); err != nil {
-			log.Error("failed to decode request body", sl.Err(err))
-			render.JSON(w, r, response.Error("invalid request"))
+			log.ErrorContext(r.Context(), "failed to decode request body", sl.Err(err))
+			apierror.Render(w, r, apierror.InvalidRequest, "invalid request")
 			return
 		}
 
-		if err := validator.New().Struct(req); err != nil {
+		if err := validate.Struct(req); err != nil {
 			validateErr := err.(validator.ValidationErrors)
-			log.Error("validation failed", sl.Err(err))
-			render.JSON(w, r, response.ValidationError(validateErr))
+			log.ErrorContext(r.Context(), "validation failed", sl.Err(err))
+			apierror.RenderValidation(w, r, validateErr)
 			return
 		}
-		user, err := userSignIn.GetUserByUsername(req.Username)
+		user, err := userSignIn.GetUserByUsername(r.Context(), req.Username)
 		if errors.Is(err, storage.ErrUserNotFound) {
-			log.Warn("user not found", slog.String("username", req.Username))
-			render.JSON(w, r, response.Error("invalid username or password"))
+			log.WarnContext(r.Context(), "user not found", slog.String("username", req.Username))
+			metrics.Login(metrics.LoginFailure)
+			apierror.Render(w, r, apierror.InvalidCredentials, "invalid username or password")
 			return
 		}
 		if err != nil {
-			log.Error("failed to get user", sl.Err(err))
-			render.JSON(w, r, response.Error("failed to get user"))
+			log.ErrorContext(r.Context(), "failed to get user", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to get user")
 			return
 		}
 		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-			log.Warn("invalid password", slog.String("username", req.Username))
-			render.JSON(w, r, response.Error("invalid username or password"))
+			log.WarnContext(r.Context(), "invalid password", slog.String("username", req.Username))
+			metrics.Login(metrics.LoginFailure)
+			apierror.Render(w, r, apierror.InvalidCredentials, "invalid username or password")
 			return
 		}
-		token, err := auth.GenerateToken(user.ID, user.Username)
+		if user.LockedAt != nil {
+			log.WarnContext(r.Context(), "login to locked account", slog.String("username", req.Username))
+			metrics.Login(metrics.LoginFailure)
+			apierror.Render(w, r, apierror.AccountLocked, "account is locked")
+			return
+		}
+		tokens, err := issuer.Start(r.Context(), userSignIn, user.ID, user.Username, user.Role)
 		if err != nil {
-			log.Error("failed to generate jwt token", sl.Err(err))
-			render.JSON(w, r, response.Error("failed to generate token"))
+			log.ErrorContext(r.Context(), "failed to generate tokens", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to generate token")
 			return
 		}
-		log.Info("user successfully logged in", slog.String("username", req.Username))
+		log.InfoContext(r.Context(), "user successfully logged in", slog.String("username", req.Username))
+		metrics.Login(metrics.LoginSuccess)
 
-		render.JSON(w, r, map[string]string{
-			"token": token,
-		})
+		render.JSON(w, r, tokens)
 	}
 }
@@ -0,0 +1,44 @@
+package logout
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"notes/internal/apierror"
+	JWTMiddleware "notes/internal/middleware"
+	"notes/pkg/api/response"
+	"notes/pkg/logger/sl"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+)
+
+type SessionRevoker interface {
+	RevokeSession(ctx context.Context, userID int, sessionID string) error
+}
+
+// New ends the session of the access token the request was made with.
+func New(log *slog.Logger, sessionRevoker SessionRevoker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.user.logout.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		userID := JWTMiddleware.GetUserID(r.Context())
+		sessionID := JWTMiddleware.GetSessionID(r.Context())
+		if userID == 0 || sessionID == "" {
+			log.ErrorContext(r.Context(), "unauthorized: no session in context")
+			apierror.Render(w, r, apierror.Unauthorized, "unauthorized")
+			return
+		}
+		if err := sessionRevoker.RevokeSession(r.Context(), userID, sessionID); err != nil {
+			log.ErrorContext(r.Context(), "failed to revoke session", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to logout")
+			return
+		}
+		log.InfoContext(r.Context(), "user successfully logged out", slog.Int("user_id", userID))
+		render.JSON(w, r, response.OK())
+	}
+}
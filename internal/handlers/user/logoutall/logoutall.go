@@ -0,0 +1,43 @@
+package logoutall
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"notes/internal/apierror"
+	JWTMiddleware "notes/internal/middleware"
+	"notes/pkg/api/response"
+	"notes/pkg/logger/sl"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+)
+
+type SessionsRevoker interface {
+	RevokeAllSessions(ctx context.Context, userID int) error
+}
+
+// New ends every session of the user, on all devices.
+func New(log *slog.Logger, sessionsRevoker SessionsRevoker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.user.logoutall.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		userID := JWTMiddleware.GetUserID(r.Context())
+		if userID == 0 {
+			log.ErrorContext(r.Context(), "unauthorized: no user_id in context")
+			apierror.Render(w, r, apierror.Unauthorized, "unauthorized")
+			return
+		}
+		if err := sessionsRevoker.RevokeAllSessions(r.Context(), userID); err != nil {
+			log.ErrorContext(r.Context(), "failed to revoke sessions", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to logout")
+			return
+		}
+		log.InfoContext(r.Context(), "user successfully logged out everywhere", slog.Int("user_id", userID))
+		render.JSON(w, r, response.OK())
+	}
+}
@@ -0,0 +1,88 @@
+package refresh
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"notes/internal/apierror"
+	"notes/internal/models"
+	"notes/internal/session"
+	"notes/internal/storage"
+	"notes/pkg/api/validate"
+	"notes/pkg/auth"
+	"notes/pkg/logger/sl"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+)
+
+type Request struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type TokenRotator interface {
+	RotateRefreshToken(ctx context.Context, oldTokenHash, newTokenHash string, expiresAt time.Time) (*models.Session, error)
+}
+
+func New(log *slog.Logger, tokenRotator TokenRotator, issuer session.Issuer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.user.refresh.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		var req Request
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.ErrorContext(r.Context(), "failed to decode request body", sl.Err(err))
+			apierror.Render(w, r, apierror.InvalidRequest, "invalid request")
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			validateErr := err.(validator.ValidationErrors)
+			log.ErrorContext(r.Context(), "validation failed", sl.Err(err))
+			apierror.RenderValidation(w, r, validateErr)
+			return
+		}
+
+		refreshToken, err := auth.NewOpaqueToken()
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to generate refresh token", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to generate token")
+			return
+		}
+		sess, err := tokenRotator.RotateRefreshToken(r.Context(),
+			auth.HashOpaqueToken(req.RefreshToken),
+			auth.HashOpaqueToken(refreshToken),
+			issuer.RefreshExpiry(),
+		)
+		if errors.Is(err, storage.ErrTokenReused) {
+			log.WarnContext(r.Context(), "refresh token reuse detected, session revoked")
+			apierror.Render(w, r, apierror.RefreshTokenReused, "invalid refresh token")
+			return
+		}
+		if errors.Is(err, storage.ErrTokenNotFound) ||
+			errors.Is(err, storage.ErrTokenExpired) ||
+			errors.Is(err, storage.ErrTokenRevoked) {
+			log.InfoContext(r.Context(), "refresh rejected", sl.Err(err))
+			apierror.Render(w, r, apierror.FromStorage(err), "invalid refresh token")
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to rotate refresh token", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to refresh token")
+			return
+		}
+		accessToken, err := auth.GenerateToken(sess.UserID, sess.Username, sess.Role, sess.ID, issuer.AccessTokenTTL)
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to generate jwt token", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to generate token")
+			return
+		}
+		log.InfoContext(r.Context(), "tokens successfully refreshed", slog.Int("user_id", sess.UserID))
+		render.JSON(w, r, session.Tokens{AccessToken: accessToken, RefreshToken: refreshToken})
+	}
+}
@@ -1,12 +1,15 @@
 package save
 
 import (
+	"context"
 	"errors"
 	"log/slog"
 	"net/http"
+	"notes/internal/apierror"
+	"notes/internal/models"
+	"notes/internal/session"
 	"notes/internal/storage"
-	"notes/pkg/api/response"
-	"notes/pkg/auth"
+	"notes/pkg/api/validate"
 	"notes/pkg/logger/sl"
 
 	"github.com/go-chi/chi/middleware"
@@ -20,50 +23,51 @@ type Request struct {
 }
 
 type UserSaver interface {
-	SaveUser(username, password string) (int, error)
+	SaveUser(ctx context.Context, username, password string) (int, error)
+	session.RefreshTokenSaver
 }
 
-func New(log *slog.Logger, userSaver UserSaver) http.HandlerFunc {
+func New(log *slog.Logger, userSaver UserSaver, issuer session.Issuer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.user.save.New"
-		log = log.With(
+		log := log.With(
 			slog.String("op", op),
 			slog.String("request_id", middleware.GetReqID(r.Context())),
 		)
 		var req Request
 		err := render.DecodeJSON(r.Body, &req)
 		if err != nil {
-			log.Error("failed to decode request body", sl.Err(err))
-			render.JSON(w, r, response.Error("failed to decode request"))
+			log.ErrorContext(r.Context(), "failed to decode request body", sl.Err(err))
+			apierror.Render(w, r, apierror.InvalidRequest, "failed to decode request")
 			return
 		}
-		log.Info("decoded request", slog.Any("request", req))
-		if err := validator.New().Struct(req); err != nil {
+		log.InfoContext(r.Context(), "decoded request", slog.Any("request", req))
+		if err := validate.Struct(req); err != nil {
 			validateErr := err.(validator.ValidationErrors)
-			log.Error("invalid request", sl.Err(err))
-			render.JSON(w, r, response.ValidationError(validateErr))
+			log.ErrorContext(r.Context(), "invalid request", sl.Err(err))
+			apierror.RenderValidation(w, r, validateErr)
 			return
 		}
 
-		userID, err := userSaver.SaveUser(req.Username, req.Password)
+		userID, err := userSaver.SaveUser(r.Context(), req.Username, req.Password)
 		if errors.Is(err, storage.ErrUserExists) {
-			log.Info("username already exists", slog.String("username", req.Username))
-			render.JSON(w, r, response.Error("username already exists"))
+			log.InfoContext(r.Context(), "username already exists", slog.String("username", req.Username))
+			apierror.Render(w, r, apierror.UserExists, "username already exists")
 			return
 		}
 		if err != nil {
-			log.Error("failed to create user", sl.Err(err))
-			render.JSON(w, r, response.Error("failed to create user"))
+			log.ErrorContext(r.Context(), "failed to create user", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to create user")
 			return
 		}
-		token, err := auth.GenerateToken(userID, req.Username)
+		tokens, err := issuer.Start(r.Context(), userSaver, userID, req.Username, models.RoleUser)
 		if err != nil {
-			log.Error("failed to generate JWT", sl.Err(err))
-			render.JSON(w, r, response.Error("failed to generate token"))
+			log.ErrorContext(r.Context(), "failed to generate tokens", sl.Err(err))
+			apierror.Render(w, r, apierror.Internal, "failed to generate token")
 			return
 		}
-		log.Info("user successfully created", slog.String("username", req.Username))
+		log.InfoContext(r.Context(), "user successfully created", slog.String("username", req.Username))
 		render.Status(r, http.StatusCreated)
-		render.JSON(w, r, map[string]string{"token": token})
+		render.JSON(w, r, tokens)
 	}
 }
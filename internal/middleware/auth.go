@@ -3,36 +3,68 @@ package middleware
 import (
 	"context"
 	"net/http"
+	"notes/internal/apierror"
+	"notes/internal/models"
 	"notes/pkg/auth"
+	"slices"
 	"strings"
 )
 
 type key string
 
-const userKey key = "user"
-
-func JWT(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "missing authorization header", http.StatusUnauthorized)
-			return
-		}
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			http.Error(w, "invalid authorization header", http.StatusUnauthorized)
-			return
-		}
-		claims, err := auth.ParseToken(parts[1])
-		if err != nil {
-			http.Error(w, "invalid token", http.StatusUnauthorized)
-			return
-		}
-
-		ctx := context.WithValue(r.Context(), userKey, claims.UserID)
-		next.ServeHTTP(w, r.WithContext(ctx))
-
-	})
+const (
+	userKey    key = "user"
+	sessionKey key = "session"
+	roleKey    key = "role"
+)
+
+type SessionChecker interface {
+	IsSessionActive(ctx context.Context, sessionID string) (bool, error)
+}
+
+// JWT authenticates the request by its bearer access token and rejects tokens
+// whose session has been revoked through logout or refresh token reuse.
+func JWT(sessionChecker SessionChecker) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+			if authHeader == "" {
+				apierror.Render(w, r, apierror.Unauthorized, "missing authorization header")
+				return
+			}
+			parts := strings.Split(authHeader, " ")
+			if len(parts) != 2 || parts[0] != "Bearer" {
+				apierror.Render(w, r, apierror.Unauthorized, "invalid authorization header")
+				return
+			}
+			claims, err := auth.ParseToken(parts[1])
+			if err != nil {
+				apierror.Render(w, r, apierror.InvalidToken, "invalid token")
+				return
+			}
+			active, err := sessionChecker.IsSessionActive(r.Context(), claims.SessionID)
+			if err != nil {
+				apierror.Render(w, r, apierror.Internal, "failed to verify session")
+				return
+			}
+			if !active {
+				apierror.Render(w, r, apierror.SessionRevoked, "session revoked")
+				return
+			}
+
+			ctx := WithUser(r.Context(), claims.UserID, claims.Role)
+			ctx = context.WithValue(ctx, sessionKey, claims.SessionID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+
+		})
+	}
+}
+
+// WithUser returns a copy of ctx that carries the authenticated user and
+// their role, the way JWT hands them to the handlers.
+func WithUser(ctx context.Context, userID int, role string) context.Context {
+	ctx = context.WithValue(ctx, userKey, userID)
+	return context.WithValue(ctx, roleKey, role)
 }
 
 func GetUserID(ctx context.Context) int {
@@ -41,3 +73,36 @@ func GetUserID(ctx context.Context) int {
 	}
 	return 0
 }
+
+func GetSessionID(ctx context.Context) string {
+	if sid, ok := ctx.Value(sessionKey).(string); ok {
+		return sid
+	}
+	return ""
+}
+
+// GetRole returns the role carried by the access token. Tokens issued before
+// roles existed belong to regular users.
+func GetRole(ctx context.Context) string {
+	if role, ok := ctx.Value(roleKey).(string); ok && role != "" {
+		return role
+	}
+	return models.RoleUser
+}
+
+// RequireRole rejects callers whose role is not one of roles. It runs after JWT.
+func RequireRole(roles ...string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if GetUserID(r.Context()) == 0 {
+				apierror.Render(w, r, apierror.Unauthorized, "unauthorized")
+				return
+			}
+			if !slices.Contains(roles, GetRole(r.Context())) {
+				apierror.Render(w, r, apierror.Forbidden, "forbidden access")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"notes/internal/apierror"
+	"notes/internal/models"
+	"notes/pkg/api/param"
+)
+
+const principalKey key = "principal"
+
+// Principal is the caller of a /users/{id}/... route as resolved by
+// Authorize. Handlers act on the resources of OwnerID.
+type Principal struct {
+	// UserID is the authenticated user.
+	UserID int
+	// Role is the role of the authenticated user.
+	Role string
+	// OwnerID is the user named by the {id} route parameter.
+	OwnerID int
+}
+
+// Authorize resolves the principal of a route under /users/{id} and rejects
+// callers who are not that user, unless they are an admin. Read-only users
+// may only read. It runs after JWT.
+func Authorize(log *slog.Logger) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID := GetUserID(r.Context())
+			if userID == 0 {
+				apierror.Render(w, r, apierror.Unauthorized, "unauthorized")
+				return
+			}
+			ownerID, err := param.Int(r, "id")
+			if err != nil {
+				apierror.RenderParam(w, r, err)
+				return
+			}
+			role := GetRole(r.Context())
+			if role == models.RoleReadOnly && r.Method != http.MethodGet && r.Method != http.MethodHead {
+				log.WarnContext(r.Context(), "write by read-only user",
+					slog.String("path", r.URL.Path),
+					slog.String("method", r.Method),
+					slog.Int("token_id", userID),
+				)
+				apierror.Render(w, r, apierror.Forbidden, "read-only access")
+				return
+			}
+			if userID != ownerID && role != models.RoleAdmin {
+				log.WarnContext(r.Context(), "user id mismatch",
+					slog.String("path", r.URL.Path),
+					slog.Int("token_id", userID),
+					slog.Int("url_id", ownerID),
+				)
+				apierror.Render(w, r, apierror.Forbidden, "forbidden access")
+				return
+			}
+
+			ctx := WithPrincipal(r.Context(), Principal{UserID: userID, Role: role, OwnerID: ownerID})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// WithPrincipal returns a copy of ctx that carries p, the way Authorize
+// hands the principal to the handlers.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey, p)
+}
+
+// GetPrincipal returns the principal resolved by Authorize.
+func GetPrincipal(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey).(Principal)
+	return p, ok
+}
@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"notes/internal/models"
+	"testing"
+
+	"github.com/go-chi/chi"
+)
+
+func TestAuthorize(t *testing.T) {
+	tests := []struct {
+		name   string
+		userID int
+		role   string
+		method string
+		target string
+		status int
+	}{
+		{name: "owner", userID: 7, target: "/users/7/notes", status: http.StatusOK},
+		{name: "token without role", userID: 7, role: "", method: http.MethodPost, target: "/users/7/notes", status: http.StatusOK},
+		{name: "other user", userID: 7, target: "/users/8/notes", status: http.StatusForbidden},
+		{name: "admin on other user", userID: 7, role: models.RoleAdmin, method: http.MethodPost, target: "/users/8/notes", status: http.StatusOK},
+		{name: "read-only reads", userID: 7, role: models.RoleReadOnly, target: "/users/7/notes", status: http.StatusOK},
+		{name: "read-only writes", userID: 7, role: models.RoleReadOnly, method: http.MethodPost, target: "/users/7/notes", status: http.StatusForbidden},
+		{name: "invalid id", userID: 7, target: "/users/me/notes", status: http.StatusBadRequest},
+		{name: "unauthenticated", target: "/users/7/notes", status: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Principal
+			router := chi.NewRouter()
+			router.Route("/users/{id}/notes", func(r chi.Router) {
+				r.Use(func(next http.Handler) http.Handler {
+					return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						if tt.userID != 0 {
+							ctx := context.WithValue(r.Context(), userKey, tt.userID)
+							r = r.WithContext(context.WithValue(ctx, roleKey, tt.role))
+						}
+						next.ServeHTTP(w, r)
+					})
+				})
+				r.Use(Authorize(slog.New(slog.DiscardHandler)))
+				r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+					got, _ = GetPrincipal(r.Context())
+				})
+			})
+
+			w := httptest.NewRecorder()
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			router.ServeHTTP(w, httptest.NewRequest(method, tt.target, nil))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			want := Principal{UserID: tt.userID, Role: cmp.Or(tt.role, models.RoleUser), OwnerID: 8}
+			if tt.role != models.RoleAdmin {
+				want.OwnerID = tt.userID
+			}
+			if tt.status == http.StatusOK && got != want {
+				t.Errorf("principal = %+v", got)
+			}
+		})
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	tests := []struct {
+		name   string
+		userID int
+		role   string
+		status int
+	}{
+		{name: "admin", userID: 1, role: models.RoleAdmin, status: http.StatusOK},
+		{name: "user", userID: 1, role: models.RoleUser, status: http.StatusForbidden},
+		{name: "token without role", userID: 1, status: http.StatusForbidden},
+		{name: "unauthenticated", status: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+			r := httptest.NewRequest(http.MethodGet, "/admin/users", nil)
+			if tt.userID != 0 {
+				ctx := context.WithValue(r.Context(), userKey, tt.userID)
+				r = r.WithContext(context.WithValue(ctx, roleKey, tt.role))
+			}
+			w := httptest.NewRecorder()
+			RequireRole(models.RoleAdmin)(next).ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+}
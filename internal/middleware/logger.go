@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+// Logger logs every request once it has been served, with its status, size
+// and duration. It logs through log with the context of the request, so the
+// records carry its trace id like those of the handlers.
+func Logger(log *slog.Logger) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			start := time.Now()
+			defer func() {
+				log.InfoContext(r.Context(), "request served",
+					slog.String("method", r.Method),
+					slog.String("path", r.URL.Path),
+					slog.String("remote_addr", r.RemoteAddr),
+					slog.Int("status", ww.Status()),
+					slog.Int("bytes", ww.BytesWritten()),
+					slog.Duration("duration", time.Since(start)),
+					slog.String("request_id", middleware.GetReqID(r.Context())),
+				)
+			}()
+
+			next.ServeHTTP(ww, r)
+		})
+	}
+}
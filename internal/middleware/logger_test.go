@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"notes/pkg/logger/sl"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestLogger(t *testing.T) {
+	var logs bytes.Buffer
+	log := slog.New(sl.NewTraceHandler(slog.NewJSONHandler(&logs, nil)))
+	h := Logger(log)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("created"))
+	}))
+	traceID := trace.TraceID{1}
+	ctx := trace.ContextWithSpanContext(t.Context(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID,
+		SpanID:  trace.SpanID{1},
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequestWithContext(ctx, http.MethodPost, "/users/1/notes", nil))
+
+	var line struct {
+		Method  string `json:"method"`
+		Path    string `json:"path"`
+		Status  int    `json:"status"`
+		Bytes   int    `json:"bytes"`
+		TraceID string `json:"trace_id"`
+	}
+	if err := json.Unmarshal(logs.Bytes(), &line); err != nil {
+		t.Fatalf("decode %s: %v", logs.String(), err)
+	}
+	if line.Method != http.MethodPost || line.Path != "/users/1/notes" || line.Status != http.StatusCreated || line.Bytes != len("created") {
+		t.Errorf("got log line %s", logs.String())
+	}
+	if line.TraceID != traceID.String() {
+		t.Errorf("trace id = %q, want %q", line.TraceID, traceID)
+	}
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"notes/internal/apierror"
+	"runtime/debug"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+// Recoverer logs a panicking handler with its stack and answers with an
+// Internal problem document, unless the handler already started its
+// response. http.ErrAbortHandler is passed on to the server, which aborts the
+// response as the handler asked.
+func Recoverer(log *slog.Logger) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			defer func() {
+				rvr := recover()
+				if rvr == nil {
+					return
+				}
+				if rvr == http.ErrAbortHandler {
+					panic(rvr)
+				}
+				log.ErrorContext(r.Context(), "handler panicked",
+					slog.Any("panic", rvr),
+					slog.String("stack", string(debug.Stack())),
+					slog.String("request_id", middleware.GetReqID(r.Context())),
+				)
+				if ww.Status() == 0 {
+					apierror.Render(ww, r, apierror.Internal, "internal server error")
+				}
+			}()
+
+			next.ServeHTTP(ww, r)
+		})
+	}
+}
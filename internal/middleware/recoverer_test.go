@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"notes/internal/apierror"
+	"strings"
+	"testing"
+)
+
+func TestRecoverer(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		status  int
+		code    string
+	}{
+		{
+			name:    "panic",
+			handler: func(w http.ResponseWriter, r *http.Request) { panic("boom") },
+			status:  apierror.Internal.Status,
+			code:    apierror.Internal.Code,
+		},
+		{
+			name: "panic after answering",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusAccepted)
+				panic("boom")
+			},
+			status: http.StatusAccepted,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			rec := httptest.NewRecorder()
+			Recoverer(slog.New(slog.NewTextHandler(&logs, nil)))(tt.handler).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users/1/notes", nil))
+			checkProblem(t, rec, tt.status, tt.code)
+			if tt.code == "" && rec.Body.Len() != 0 {
+				t.Errorf("body = %s, want none after the handler answered", rec.Body)
+			}
+			if !strings.Contains(logs.String(), "panic=boom") {
+				t.Errorf("panic not logged: %s", logs.String())
+			}
+		})
+	}
+}
+
+func TestRecovererAbort(t *testing.T) {
+	defer func() {
+		if rvr := recover(); rvr != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler passed on", rvr)
+		}
+	}()
+	h := Recoverer(slog.New(slog.DiscardHandler))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic(http.ErrAbortHandler) }))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1/notes", nil))
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"notes/internal/apierror"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+// Timeout cancels the request context after timeout, like the chi middleware
+// of the same name. When the handler gave up on the cancelled context without
+// answering, the client gets an Unavailable problem document instead of a
+// bare 504.
+func Timeout(timeout time.Duration) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r.WithContext(ctx))
+			if ctx.Err() == context.DeadlineExceeded && ww.Status() == 0 {
+				apierror.Render(ww, r, apierror.Unavailable, "request timed out")
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"notes/internal/apierror"
+	"notes/pkg/api/response"
+	"testing"
+	"time"
+)
+
+func TestTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		status  int
+		code    string
+	}{
+		{
+			name:    "in time",
+			handler: func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) },
+			status:  http.StatusNoContent,
+		},
+		{
+			name:    "timed out",
+			handler: func(w http.ResponseWriter, r *http.Request) { <-r.Context().Done() },
+			status:  apierror.Unavailable.Status,
+			code:    apierror.Unavailable.Code,
+		},
+		{
+			name: "answered after timing out",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				<-r.Context().Done()
+				apierror.Render(w, r, apierror.Internal, "query cancelled")
+			},
+			status: apierror.Internal.Status,
+			code:   apierror.Internal.Code,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			Timeout(10*time.Millisecond)(tt.handler).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users/1/notes", nil))
+			checkProblem(t, rec, tt.status, tt.code)
+		})
+	}
+}
+
+// checkProblem checks the status of rec and, for a non-empty code, that its
+// body is a single problem document with that code.
+func checkProblem(t *testing.T, rec *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("status = %d, want %d", rec.Code, status)
+	}
+	if code == "" {
+		return
+	}
+	if got := rec.Header().Get("Content-Type"); got != response.ContentTypeProblem {
+		t.Errorf("Content-Type = %q, want %q", got, response.ContentTypeProblem)
+	}
+	var p response.Problem
+	dec := json.NewDecoder(rec.Body)
+	if err := dec.Decode(&p); err != nil || dec.More() {
+		t.Fatalf("body is not a single problem document: %v", err)
+	}
+	if p.Code != code || p.Status != status || p.Instance != "/users/1/notes" {
+		t.Errorf("problem = %+v, want code %q and status %d", p, code, status)
+	}
+}
@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS notebooks (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    parent_id INT REFERENCES notebooks(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS notebooks_user_id_parent_id_idx ON notebooks(user_id, parent_id);
+
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS notebook_id INT REFERENCES notebooks(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS notes_notebook_id_idx ON notes(notebook_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS notes_notebook_id_idx;
+ALTER TABLE notes DROP COLUMN IF EXISTS notebook_id;
+DROP TABLE IF EXISTS notebooks;
@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS note_links (
+    id SERIAL PRIMARY KEY,
+    note_id INT NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+    token_hash TEXT UNIQUE NOT NULL,
+    password TEXT,
+    expires_at TIMESTAMPTZ,
+    view_count INT NOT NULL DEFAULT 0,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS note_links_note_id_idx ON note_links(note_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS note_links;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+
+-- +goose Down
+ALTER TABLE notes DROP COLUMN IF EXISTS version;
@@ -0,0 +1,25 @@
+// Package migrations embeds the SQL migrations of the storage drivers, so the
+// binary can apply them without the files on disk.
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed *.sql
+var postgres embed.FS
+
+//go:embed sqlite/*.sql
+var sqlite embed.FS
+
+// Postgres returns the migrations of the postgres driver.
+func Postgres() fs.FS {
+	return postgres
+}
+
+// SQLite returns the migrations of the sqlite driver.
+func SQLite() fs.FS {
+	sub, _ := fs.Sub(sqlite, "sqlite")
+	return sub
+}
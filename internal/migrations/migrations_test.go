@@ -0,0 +1,132 @@
+package migrations
+
+import (
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// sqliteSnapshot is the migration that creates the SQLite schema in one go.
+// Every postgres migration after it needs a SQLite migration of the same
+// version.
+const sqliteSnapshot = "20251107100000"
+
+// postgresOnly are the columns SQLite does without: the search vector is
+// replaced by the notes_fts table.
+var postgresOnly = []string{"notes.search_vector"}
+
+var (
+	blockRe      = regexp.MustCompile(`(?s)-- \+goose StatementBegin.*?-- \+goose StatementEnd`)
+	commentRe    = regexp.MustCompile(`--[^\n]*`)
+	createRe     = regexp.MustCompile(`(?is)^CREATE TABLE (?:IF NOT EXISTS )?(\w+)\s*\((.*)\)$`)
+	addColumnRe  = regexp.MustCompile(`(?is)^ALTER TABLE (\w+) ADD COLUMN (?:IF NOT EXISTS )?(\w+)`)
+	dropColumnRe = regexp.MustCompile(`(?is)^ALTER TABLE (\w+) DROP COLUMN (?:IF EXISTS )?(\w+)`)
+	dropTableRe  = regexp.MustCompile(`(?is)^DROP TABLE (?:IF EXISTS )?(\w+)`)
+)
+
+// schema applies the up migrations of fsys, in version order, to a set of
+// table.column names.
+func schema(t *testing.T, fsys fs.FS) map[string]bool {
+	t.Helper()
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns := make(map[string]bool)
+	for _, name := range files {
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		up, _, _ := strings.Cut(string(b), "-- +goose Down")
+		up = commentRe.ReplaceAllString(blockRe.ReplaceAllString(up, ""), "")
+		for _, stmt := range strings.Split(up, ";") {
+			stmt = strings.Join(strings.Fields(stmt), " ")
+			if m := createRe.FindStringSubmatch(stmt); m != nil {
+				for _, def := range splitDefs(m[2]) {
+					col := strings.ToLower(strings.Fields(def)[0])
+					switch col {
+					case "primary", "unique", "foreign", "check", "constraint":
+						continue
+					}
+					columns[m[1]+"."+col] = true
+				}
+			} else if m := addColumnRe.FindStringSubmatch(stmt); m != nil {
+				columns[m[1]+"."+m[2]] = true
+			} else if m := dropColumnRe.FindStringSubmatch(stmt); m != nil {
+				delete(columns, m[1]+"."+m[2])
+			} else if m := dropTableRe.FindStringSubmatch(stmt); m != nil {
+				for c := range columns {
+					if strings.HasPrefix(c, m[1]+".") {
+						delete(columns, c)
+					}
+				}
+			}
+		}
+	}
+	return columns
+}
+
+// splitDefs splits the body of a CREATE TABLE at the commas outside
+// parentheses.
+func splitDefs(body string) []string {
+	var defs []string
+	depth, start := 0, 0
+	for i, r := range body {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				defs = append(defs, strings.TrimSpace(body[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(defs, strings.TrimSpace(body[start:]))
+}
+
+// TestSchemasMatch fails when the postgres and SQLite migrations drift apart
+// and end in different tables or columns.
+func TestSchemasMatch(t *testing.T) {
+	pg, lite := schema(t, Postgres()), schema(t, SQLite())
+	for c := range pg {
+		if !lite[c] && !slices.Contains(postgresOnly, c) {
+			t.Errorf("column %s is missing from the SQLite schema", c)
+		}
+	}
+	for c := range lite {
+		if !pg[c] {
+			t.Errorf("column %s is missing from the postgres schema", c)
+		}
+	}
+}
+
+// TestMigrationsPaired fails when a postgres migration made after the SQLite
+// snapshot has no SQLite counterpart of the same version.
+func TestMigrationsPaired(t *testing.T) {
+	pg, err := fs.Glob(Postgres(), "*.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lite, err := fs.Glob(SQLite(), "*.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions := make(map[string]bool)
+	for _, name := range lite {
+		version, _, _ := strings.Cut(path.Base(name), "_")
+		versions[version] = true
+	}
+	for _, name := range pg {
+		version, _, _ := strings.Cut(name, "_")
+		if version > sqliteSnapshot && !versions[version] {
+			t.Errorf("postgres migration %s has no SQLite migration of the same version", name)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+-- +goose Up
+-- The snapshot missed the column the postgres tags table has. SQLite cannot
+-- add a NOT NULL column without a constant default, so existing tags get the
+-- time of the migration.
+ALTER TABLE tags ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00';
+UPDATE tags SET created_at = CURRENT_TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE tags DROP COLUMN created_at;
@@ -0,0 +1,146 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"notes/internal/config"
+	"notes/internal/migrations"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+)
+
+// Migrator applies the embedded migrations of a storage driver.
+type Migrator struct {
+	log      *slog.Logger
+	provider *goose.Provider
+}
+
+// New prepares the migrations of the driver for db. On postgres every run holds
+// an advisory lock, so replicas starting together apply migrations one at a time.
+func New(log *slog.Logger, db *sql.DB, driver string) (*Migrator, error) {
+	const op = "migrator.New"
+	var (
+		provider *goose.Provider
+		err      error
+	)
+	switch driver {
+	case config.StorageDriverPostgres:
+		locker, lockErr := lock.NewPostgresSessionLocker()
+		if lockErr != nil {
+			return nil, fmt.Errorf("%s: session locker: %w", op, lockErr)
+		}
+		provider, err = goose.NewProvider(goose.DialectPostgres, db, migrations.Postgres(), goose.WithSessionLocker(locker))
+	case config.StorageDriverSQLite:
+		// SQLite serializes writers on the database file, no lock needed.
+		provider, err = goose.NewProvider(goose.DialectSQLite3, db, migrations.SQLite())
+	default:
+		return nil, fmt.Errorf("%s: driver %q has no migrations", op, driver)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return &Migrator{
+		log:      log.With(slog.String("driver", driver)),
+		provider: provider,
+	}, nil
+}
+
+func (m *Migrator) logResult(res *goose.MigrationResult) {
+	m.log.Info("migration applied",
+		slog.String("migration", res.Source.Path),
+		slog.String("direction", res.Direction),
+		slog.Duration("duration", res.Duration),
+	)
+}
+
+// Up applies all pending migrations.
+func (m *Migrator) Up(ctx context.Context) error {
+	const op = "migrator.Up"
+	results, err := m.provider.Up(ctx)
+	for _, res := range results {
+		m.logResult(res)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if len(results) == 0 {
+		m.log.Info("no pending migrations")
+	}
+	return nil
+}
+
+// Down rolls back the most recently applied migration.
+func (m *Migrator) Down(ctx context.Context) error {
+	const op = "migrator.Down"
+	res, err := m.provider.Down(ctx)
+	if errors.Is(err, goose.ErrNoNextVersion) {
+		m.log.Info("no migrations to roll back")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	m.logResult(res)
+	return nil
+}
+
+// Redo rolls back the most recently applied migration and applies it again.
+func (m *Migrator) Redo(ctx context.Context) error {
+	const op = "migrator.Redo"
+	res, err := m.provider.Down(ctx)
+	if errors.Is(err, goose.ErrNoNextVersion) {
+		m.log.Info("no migrations to redo")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s: down: %w", op, err)
+	}
+	m.logResult(res)
+	if res, err = m.provider.UpByOne(ctx); err != nil {
+		return fmt.Errorf("%s: up: %w", op, err)
+	}
+	m.logResult(res)
+	return nil
+}
+
+// Status writes the state of every migration to w.
+func (m *Migrator) Status(ctx context.Context, w io.Writer) error {
+	const op = "migrator.Status"
+	statuses, err := m.provider.Status(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "MIGRATION\tSTATE\tAPPLIED AT")
+	for _, st := range statuses {
+		appliedAt := "-"
+		if st.State == goose.StateApplied {
+			appliedAt = st.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", st.Source.Path, st.State, appliedAt)
+	}
+	return tw.Flush()
+}
+
+// Run executes one of the migrate subcommands: up, down, status or redo.
+func (m *Migrator) Run(ctx context.Context, command string, out io.Writer) error {
+	switch command {
+	case "up":
+		return m.Up(ctx)
+	case "down":
+		return m.Down(ctx)
+	case "redo":
+		return m.Redo(ctx)
+	case "status":
+		return m.Status(ctx, out)
+	default:
+		return fmt.Errorf("unknown migrate command %q, want up, down, status or redo", command)
+	}
+}
@@ -2,17 +2,116 @@ package models
 
 import "time"
 
+const (
+	PermissionRead  = "read"
+	PermissionWrite = "write"
+)
+
+// Roles of a user. Readonly users can read their notes but not change them;
+// admins can act on the notes of every user and use the admin API.
+const (
+	RoleUser     = "user"
+	RoleAdmin    = "admin"
+	RoleReadOnly = "readonly"
+)
+
+// ValidRole reports whether role is one of the known roles.
+func ValidRole(role string) bool {
+	return role == RoleUser || role == RoleAdmin || role == RoleReadOnly
+}
+
 type User struct {
-	ID        int       `json:"id"`
-	Username  string    `json:"username"`
-	Password  string    `json:"password"`
-	CreatedAt time.Time `json:"created_at"`
+	ID        int        `json:"id"`
+	Username  string     `json:"username"`
+	Password  string     `json:"password"`
+	Role      string     `json:"role"`
+	LockedAt  *time.Time `json:"locked_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// UserInfo is a user as shown by the admin API, without the password hash.
+type UserInfo struct {
+	ID        int        `json:"id"`
+	Username  string     `json:"username"`
+	Role      string     `json:"role"`
+	LockedAt  *time.Time `json:"locked_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// NoteCounts sums up the notes of a user for the admin API.
+type NoteCounts struct {
+	UserID  int `json:"user_id"`
+	Active  int `json:"active"`
+	Trashed int `json:"trashed"`
+	Shared  int `json:"shared"`
 }
 type Note struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	NotebookID *int       `json:"notebook_id"`
+	Title      string     `json:"title"`
+	Content    string     `json:"content"`
+	Tags       []string   `json:"tags"`
+	Version    int        `json:"version"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	DeletedAt  *time.Time `json:"deleted_at,omitempty"`
+}
+type Tag struct {
+	Name      string `json:"name"`
+	NoteCount int    `json:"note_count"`
+}
+type SearchResult struct {
+	Note
+	Rank           float64 `json:"rank"`
+	TitleHighlight string  `json:"title_highlight"`
+	Snippet        string  `json:"snippet"`
+}
+type Revision struct {
+	NoteID    int       `json:"note_id"`
+	Revision  int       `json:"revision"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+type Notebook struct {
 	ID        int       `json:"id"`
 	UserID    int       `json:"user_id"`
+	ParentID  *int      `json:"parent_id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+type NoteShare struct {
+	NoteID     int       `json:"note_id"`
+	UserID     int       `json:"user_id"`
+	Username   string    `json:"username"`
+	Permission string    `json:"permission"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+type SharedNote struct {
+	Note
+	Permission    string `json:"permission"`
+	OwnerUsername string `json:"owner_username"`
+}
+type NoteLink struct {
+	ID          int        `json:"id"`
+	NoteID      int        `json:"note_id"`
+	HasPassword bool       `json:"has_password"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	ViewCount   int        `json:"view_count"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+type PublicNote struct {
 	Title     string    `json:"title"`
 	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"created_at"`
+	Tags      []string  `json:"tags"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
+type Session struct {
+	ID       string `json:"id"`
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
@@ -0,0 +1,268 @@
+// Package openapi generates the OpenAPI 3.1 description of the API from the
+// endpoint table in operations.go and the request and response types of the
+// handlers.
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"notes/internal/apierror"
+	"notes/pkg/api/response"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type PathItem struct {
+	Get    *OperationObject `json:"get,omitempty"`
+	Put    *OperationObject `json:"put,omitempty"`
+	Post   *OperationObject `json:"post,omitempty"`
+	Delete *OperationObject `json:"delete,omitempty"`
+	Patch  *OperationObject `json:"patch,omitempty"`
+}
+
+type OperationObject struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary"`
+	Tags        []string              `json:"tags"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	Parameters  []*Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Errors      []string              `json:"x-error-codes,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Response struct {
+	Description string                `json:"description"`
+	Headers     map[string]*Header    `json:"headers,omitempty"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+// pathParams describes the path parameters used across the routes.
+var pathParams = map[string]*Parameter{
+	"id":          {Description: "Id of the user the resource belongs to", Schema: &Schema{Type: "integer"}},
+	"note_id":     {Description: "Note id", Schema: &Schema{Type: "integer"}},
+	"notebook_id": {Description: "Notebook id", Schema: &Schema{Type: "integer"}},
+	"rev":         {Description: "Revision number", Schema: &Schema{Type: "integer"}},
+	"user_id":     {Description: "Id of another user, such as the one a note is shared with", Schema: &Schema{Type: "integer"}},
+	"link_id":     {Description: "Link id", Schema: &Schema{Type: "integer"}},
+	"token":       {Description: "Public link token", Schema: &Schema{Type: "string"}},
+}
+
+var pathParamRe = regexp.MustCompile(`\{(\w+)\}`)
+
+var (
+	buildOnce sync.Once
+	doc       *Document
+	docJSON   []byte
+)
+
+// Spec returns the generated document.
+func Spec() *Document {
+	buildOnce.Do(func() {
+		doc = build()
+		var err error
+		docJSON, err = json.Marshal(doc)
+		if err != nil {
+			panic("openapi: marshal document: " + err.Error())
+		}
+	})
+	return doc
+}
+
+// Handler serves the document as JSON.
+func Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		Spec()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(docJSON)
+	}
+}
+
+func build() *Document {
+	g := &reflector{components: make(map[string]*Schema)}
+	d := &Document{
+		OpenAPI: "3.1.0",
+		Info: Info{
+			Title:   "Notes API",
+			Version: "1.0.0",
+			Description: "Errors are RFC 7807 problem documents (application/problem+json). " +
+				"Branch on their code member; the codes an operation can return are listed in x-error-codes.",
+		},
+		Paths: make(map[string]*PathItem),
+		Components: Components{
+			Schemas: g.components,
+			SecuritySchemes: map[string]*SecurityScheme{
+				"bearerAuth": {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+			},
+		},
+	}
+	g.components["Problem"] = problemSchema()
+	for _, op := range Operations() {
+		item := d.Paths[op.Path]
+		if item == nil {
+			item = &PathItem{}
+			d.Paths[op.Path] = item
+		}
+		*item.slot(op.Method) = g.operation(op)
+	}
+	return d
+}
+
+func (p *PathItem) slot(method string) **OperationObject {
+	switch method {
+	case http.MethodGet:
+		return &p.Get
+	case http.MethodPut:
+		return &p.Put
+	case http.MethodPost:
+		return &p.Post
+	case http.MethodDelete:
+		return &p.Delete
+	case http.MethodPatch:
+		return &p.Patch
+	}
+	panic("openapi: unsupported method " + method)
+}
+
+func (g *reflector) operation(op Operation) *OperationObject {
+	o := &OperationObject{
+		OperationID: op.ID,
+		Summary:     op.Summary,
+		Tags:        []string{op.Tag},
+		Parameters:  slices.Clone(op.Query),
+		Responses:   make(map[string]*Response),
+	}
+	for _, m := range pathParamRe.FindAllStringSubmatch(op.Path, -1) {
+		p := *pathParams[m[1]]
+		p.Name, p.In, p.Required = m[1], "path", true
+		o.Parameters = append(o.Parameters, &p)
+	}
+	for _, p := range op.Query {
+		p.In = "query"
+	}
+	o.Parameters = append(o.Parameters, op.Headers...)
+	for _, p := range op.Headers {
+		p.In = "header"
+	}
+
+	if op.Body != nil {
+		o.RequestBody = &RequestBody{Required: true, Content: map[string]*MediaType{
+			"application/json": {Schema: g.request(op.BodyName, op.Body)},
+		}}
+	}
+	if op.BodySchemas != nil {
+		o.RequestBody = &RequestBody{Required: true, Content: make(map[string]*MediaType)}
+		for contentType, s := range op.BodySchemas {
+			o.RequestBody.Content[contentType] = &MediaType{Schema: s}
+		}
+	}
+
+	success := &Response{Description: op.Summary}
+	if op.Response != nil {
+		success.Content = map[string]*MediaType{
+			"application/json": {Schema: g.response(op.ResponseName, op.Response)},
+		}
+	}
+	success.Headers = op.ResponseHeaders
+	o.Responses[strconv.Itoa(op.Status)] = success
+	for status, desc := range op.ExtraResponses {
+		o.Responses[strconv.Itoa(status)] = &Response{Description: desc}
+	}
+
+	// Errors every operation of its kind can return are added here rather
+	// than repeated in the table.
+	errs := slices.Clone(op.Errors)
+	if o.RequestBody != nil {
+		errs = append(errs, apierror.InvalidRequest, apierror.ValidationFailed, apierror.PayloadTooLarge)
+	}
+	if len(op.Query) > 0 || strings.Contains(op.Path, "_id}") || strings.Contains(op.Path, "{id}") || strings.Contains(op.Path, "{rev}") {
+		errs = append(errs, apierror.InvalidParameter)
+	}
+	if strings.HasPrefix(op.Path, "/users/{id}/") || strings.HasPrefix(op.Path, "/admin/") {
+		errs = append(errs, apierror.Forbidden)
+	}
+	if op.Auth {
+		o.Security = []map[string][]string{{"bearerAuth": {}}}
+		errs = append(errs, apierror.Unauthorized, apierror.InvalidToken, apierror.SessionRevoked)
+	}
+	errs = append(errs, apierror.Internal)
+	byStatus := make(map[int][]string)
+	for _, e := range errs {
+		if !slices.Contains(o.Errors, e.Code) {
+			o.Errors = append(o.Errors, e.Code)
+			byStatus[e.Status] = append(byStatus[e.Status], e.Code)
+		}
+	}
+	for status, codes := range byStatus {
+		o.Responses[strconv.Itoa(status)] = &Response{
+			Description: http.StatusText(status) + ": " + strings.Join(codes, ", "),
+			Content: map[string]*MediaType{
+				response.ContentTypeProblem: {Schema: ref("Problem")},
+			},
+		}
+	}
+	return o
+}
+
+func problemSchema() *Schema {
+	var codes []any
+	for _, e := range apierror.All() {
+		codes = append(codes, e.Code)
+	}
+	g := &reflector{components: make(map[string]*Schema)}
+	s := g.object(reflect.TypeFor[response.Problem](), false)
+	s.Properties["code"].Enum = codes
+	s.Description = "RFC 7807 problem details. Version mismatches add current_version."
+	s.Properties["current_version"] = &Schema{Type: "integer"}
+	return s
+}
@@ -0,0 +1,406 @@
+package openapi
+
+import (
+	"net/http"
+	"notes/internal/apierror"
+	"notes/internal/handlers/admin/role"
+	linkSave "notes/internal/handlers/link/save"
+	"notes/internal/handlers/note/getall"
+	"notes/internal/handlers/note/move"
+	"notes/internal/handlers/note/patch"
+	noteSave "notes/internal/handlers/note/save"
+	"notes/internal/handlers/note/update"
+	notebookSave "notes/internal/handlers/notebook/save"
+	notebookUpdate "notes/internal/handlers/notebook/update"
+	"notes/internal/handlers/revision/diff"
+	shareSave "notes/internal/handlers/share/save"
+	"notes/internal/handlers/user/login"
+	"notes/internal/handlers/user/refresh"
+	userSave "notes/internal/handlers/user/save"
+	"notes/internal/models"
+	"notes/internal/session"
+	"notes/internal/storage"
+	"notes/pkg/api/response"
+)
+
+// Operation describes one endpoint. Path parameters are taken from Path;
+// Body and Response are values of the types the handler decodes and renders.
+type Operation struct {
+	Method  string
+	Path    string
+	ID      string
+	Summary string
+	Tag     string
+	Auth    bool
+
+	Query   []*Parameter
+	Headers []*Parameter
+
+	BodyName    string
+	Body        any
+	BodySchemas map[string]*Schema // for bodies that are not plain JSON objects
+
+	Status          int
+	ResponseName    string
+	Response        any
+	ResponseHeaders map[string]*Header
+	ExtraResponses  map[int]string
+
+	Errors []*apierror.Error
+}
+
+func query(name, description string, s *Schema) *Parameter {
+	return &Parameter{Name: name, Description: description, Schema: s}
+}
+
+func header(name, description string, required bool) *Parameter {
+	return &Parameter{Name: name, Description: description, Required: required, Schema: &Schema{Type: "string"}}
+}
+
+var etagHeader = map[string]*Header{
+	"ETag": {Description: "Version of the note, for If-Match and If-None-Match", Schema: &Schema{Type: "string"}},
+}
+
+// Operations lists every endpoint of the API. The router test fails when it
+// and the routes registered in the router drift apart.
+func Operations() []Operation {
+	ok := response.OK()
+	return []Operation{
+		{
+			Method: http.MethodGet, Path: "/healthz", ID: "live", Tag: "health",
+			Summary: "Report that the process is alive",
+			Status:  http.StatusOK, ResponseName: "OK", Response: ok,
+		},
+		{
+			Method: http.MethodGet, Path: "/readyz", ID: "ready", Tag: "health",
+			Summary: "Report whether the service can take traffic",
+			Status:  http.StatusOK, ResponseName: "OK", Response: ok,
+			Errors: []*apierror.Error{apierror.Unavailable},
+		},
+
+		{
+			Method: http.MethodPost, Path: "/users/register", ID: "registerUser", Tag: "users",
+			Summary:  "Register a user and start a session",
+			BodyName: "RegisterRequest", Body: userSave.Request{},
+			Status: http.StatusCreated, ResponseName: "Tokens", Response: session.Tokens{},
+			Errors: []*apierror.Error{apierror.UserExists},
+		},
+		{
+			Method: http.MethodPost, Path: "/users/login", ID: "login", Tag: "users",
+			Summary:  "Start a session",
+			BodyName: "LoginRequest", Body: login.Request{},
+			Status: http.StatusOK, ResponseName: "Tokens", Response: session.Tokens{},
+			Errors: []*apierror.Error{apierror.InvalidCredentials, apierror.AccountLocked},
+		},
+		{
+			Method: http.MethodPost, Path: "/users/token/refresh", ID: "refreshToken", Tag: "users",
+			Summary:  "Exchange a refresh token for a new token pair",
+			BodyName: "RefreshRequest", Body: refresh.Request{},
+			Status: http.StatusOK, ResponseName: "Tokens", Response: session.Tokens{},
+			Errors: []*apierror.Error{
+				apierror.InvalidRefreshToken, apierror.RefreshTokenExpired,
+				apierror.RefreshTokenRevoked, apierror.RefreshTokenReused,
+			},
+		},
+		{
+			Method: http.MethodPost, Path: "/users/logout", ID: "logout", Tag: "users", Auth: true,
+			Summary: "End the current session",
+			Status:  http.StatusOK, ResponseName: "OK", Response: ok,
+		},
+		{
+			Method: http.MethodPost, Path: "/users/logout-all", ID: "logoutAll", Tag: "users", Auth: true,
+			Summary: "End every session of the user",
+			Status:  http.StatusOK, ResponseName: "OK", Response: ok,
+		},
+		{
+			Method: http.MethodGet, Path: "/public/notes/{token}", ID: "getPublicNote", Tag: "links",
+			Summary: "Read a note through a public link",
+			Headers: []*Parameter{header("X-Link-Password", "Password of a password-protected link", false)},
+			Status:  http.StatusOK, ResponseName: "PublicNote", Response: models.PublicNote{},
+			Errors: []*apierror.Error{
+				apierror.LinkNotFound, apierror.LinkExpired,
+				apierror.LinkPasswordRequired, apierror.InvalidLinkPassword,
+			},
+		},
+
+		{
+			Method: http.MethodPost, Path: "/users/{id}/notes", ID: "createNote", Tag: "notes", Auth: true,
+			Summary:  "Create a note",
+			BodyName: "CreateNoteRequest", Body: noteSave.Request{},
+			Status: http.StatusCreated, ResponseName: "OK", Response: ok,
+		},
+		{
+			Method: http.MethodGet, Path: "/users/{id}/notes", ID: "listNotes", Tag: "notes", Auth: true,
+			Summary: "List notes, newest first by default",
+			Query: []*Parameter{
+				query("limit", "Page size", &Schema{Type: "integer", Minimum: ptr(1), Maximum: ptr(100), Default: 20}),
+				query("sort", "Sort direction", &Schema{Type: "string", Enum: []any{storage.SortAsc, storage.SortDesc}, Default: storage.SortDesc}),
+				query("sort_by", "Sort field", &Schema{Type: "string", Enum: []any{storage.SortByCreatedAt, storage.SortByUpdatedAt, storage.SortByTitle}, Default: storage.SortByCreatedAt}),
+				query("cursor", "Cursor from next_cursor or prev_cursor of the previous page", &Schema{Type: "string"}),
+				query("total", "Include the total number of matching notes", &Schema{Type: "boolean"}),
+				query("tag", "Only notes with this tag; repeat for several tags", &Schema{Type: "string"}),
+				query("tag_mode", "Whether notes need any or all of the tags", &Schema{Type: "string", Enum: []any{"any", "all"}, Default: "any"}),
+				query("notebook", "Only notes in this notebook", &Schema{Type: "integer"}),
+				query("created_after", "Only notes created after this time", &Schema{Type: "string", Format: "date-time"}),
+				query("created_before", "Only notes created before this time", &Schema{Type: "string", Format: "date-time"}),
+				query("updated_since", "Only notes updated since this time", &Schema{Type: "string", Format: "date-time"}),
+				query("title_prefix", "Only notes whose title starts with this prefix", &Schema{Type: "string"}),
+				query("has_content", "Only notes with or without content", &Schema{Type: "boolean"}),
+			},
+			Status: http.StatusOK, ResponseName: "NotePage", Response: getall.Response{},
+			Errors: []*apierror.Error{apierror.InvalidCursor},
+		},
+		{
+			Method: http.MethodGet, Path: "/users/{id}/notes/search", ID: "searchNotes", Tag: "notes", Auth: true,
+			Summary: "Search notes by title and content",
+			Query: []*Parameter{
+				{Name: "q", Description: "Search words", Required: true, Schema: &Schema{Type: "string", MinLength: ptr(1)}},
+				query("limit", "Page size", &Schema{Type: "integer", Minimum: ptr(1), Maximum: ptr(100), Default: 10}),
+				query("offset", "Number of results to skip", &Schema{Type: "integer", Minimum: ptr(0), Default: 0}),
+			},
+			Status: http.StatusOK, ResponseName: "SearchResult", Response: []models.SearchResult{},
+		},
+		{
+			Method: http.MethodGet, Path: "/users/{id}/notes/{note_id}", ID: "getNote", Tag: "notes", Auth: true,
+			Summary: "Get a note",
+			Headers: []*Parameter{header("If-None-Match", "ETag of a cached copy", false)},
+			Status:  http.StatusOK, ResponseName: "Note", Response: models.Note{}, ResponseHeaders: etagHeader,
+			ExtraResponses: map[int]string{http.StatusNotModified: "The cached copy is current"},
+			Errors:         []*apierror.Error{apierror.NoteNotFound},
+		},
+		{
+			Method: http.MethodPut, Path: "/users/{id}/notes/{note_id}", ID: "updateNote", Tag: "notes", Auth: true,
+			Summary:  "Replace a note",
+			Headers:  []*Parameter{header("If-Match", "ETag of the version being replaced, or *", true)},
+			BodyName: "UpdateNoteRequest", Body: update.Request{},
+			Status: http.StatusOK, ResponseName: "OK", Response: ok, ResponseHeaders: etagHeader,
+			Errors: []*apierror.Error{apierror.NoteNotFound, apierror.PreconditionRequired, apierror.VersionMismatch},
+		},
+		{
+			Method: http.MethodPatch, Path: "/users/{id}/notes/{note_id}", ID: "patchNote", Tag: "notes", Auth: true,
+			Summary: "Change part of a note with a JSON merge patch or a JSON patch",
+			Headers: []*Parameter{header("If-Match", "ETag of the version being patched", false)},
+			BodySchemas: map[string]*Schema{
+				patch.MergePatchContentType: {
+					Type: "object", AdditionalProperties: ptr(false),
+					Properties: map[string]*Schema{
+						"title":   {Type: "string", MinLength: ptr(1)},
+						"content": {Type: []string{"string", "null"}},
+						"tags":    {Type: []string{"array", "null"}, Items: &Schema{Type: "string", MaxLength: ptr(64)}},
+					},
+				},
+				patch.JSONPatchContentType: {
+					Type: "array",
+					Items: &Schema{
+						Type:     "object",
+						Required: []string{"op", "path"},
+						Properties: map[string]*Schema{
+							"op":    {Type: "string", Enum: []any{"add", "remove", "replace", "move", "copy", "test"}},
+							"path":  {Type: "string"},
+							"from":  {Type: "string"},
+							"value": {},
+						},
+					},
+				},
+			},
+			Status: http.StatusOK, ResponseName: "OK", Response: ok, ResponseHeaders: etagHeader,
+			Errors: []*apierror.Error{
+				apierror.InvalidRequest, apierror.UnsupportedMediaType, apierror.InvalidPatch,
+				apierror.NoteNotFound, apierror.VersionMismatch,
+			},
+		},
+		{
+			Method: http.MethodDelete, Path: "/users/{id}/notes/{note_id}", ID: "deleteNote", Tag: "notes", Auth: true,
+			Summary: "Move a note to the trash",
+			Status:  http.StatusOK, ResponseName: "OK", Response: ok,
+			Errors: []*apierror.Error{apierror.NoteNotFound},
+		},
+		{
+			Method: http.MethodPut, Path: "/users/{id}/notes/{note_id}/notebook", ID: "moveNote", Tag: "notes", Auth: true,
+			Summary:  "Move a note into a notebook, or out of all notebooks",
+			BodyName: "MoveNoteRequest", Body: move.Request{},
+			Status: http.StatusOK, ResponseName: "OK", Response: ok,
+			Errors: []*apierror.Error{apierror.NoteNotFound, apierror.NotebookNotFound},
+		},
+
+		{
+			Method: http.MethodGet, Path: "/users/{id}/notes/{note_id}/revisions", ID: "listRevisions", Tag: "revisions", Auth: true,
+			Summary: "List the revisions of a note",
+			Status:  http.StatusOK, ResponseName: "Revision", Response: []models.Revision{},
+			Errors: []*apierror.Error{apierror.NoteNotFound},
+		},
+		{
+			Method: http.MethodGet, Path: "/users/{id}/notes/{note_id}/revisions/diff", ID: "diffRevisions", Tag: "revisions", Auth: true,
+			Summary: "Diff a revision against another revision or the current note",
+			Query: []*Parameter{
+				{Name: "from", Description: "Revision to diff from", Required: true, Schema: &Schema{Type: "integer"}},
+				query("to", "Revision to diff to; the current note when omitted", &Schema{Type: "integer"}),
+			},
+			Status: http.StatusOK, ResponseName: "RevisionDiff", Response: diff.Response{},
+			Errors: []*apierror.Error{apierror.NoteNotFound, apierror.RevisionNotFound},
+		},
+		{
+			Method: http.MethodGet, Path: "/users/{id}/notes/{note_id}/revisions/{rev}", ID: "getRevision", Tag: "revisions", Auth: true,
+			Summary: "Get a revision of a note",
+			Status:  http.StatusOK, ResponseName: "Revision", Response: models.Revision{},
+			Errors: []*apierror.Error{apierror.NoteNotFound, apierror.RevisionNotFound},
+		},
+		{
+			Method: http.MethodPost, Path: "/users/{id}/notes/{note_id}/revisions/{rev}/restore", ID: "restoreRevision", Tag: "revisions", Auth: true,
+			Summary: "Restore a note to a revision",
+			Status:  http.StatusOK, ResponseName: "OK", Response: ok,
+			Errors: []*apierror.Error{apierror.NoteNotFound, apierror.RevisionNotFound},
+		},
+
+		{
+			Method: http.MethodPost, Path: "/users/{id}/notes/{note_id}/shares", ID: "shareNote", Tag: "shares", Auth: true,
+			Summary:  "Share a note with another user",
+			BodyName: "ShareNoteRequest", Body: shareSave.Request{},
+			Status: http.StatusOK, ResponseName: "OK", Response: ok,
+			Errors: []*apierror.Error{apierror.NoteNotFound, apierror.UserNotFound, apierror.ShareWithOwner},
+		},
+		{
+			Method: http.MethodGet, Path: "/users/{id}/notes/{note_id}/shares", ID: "listShares", Tag: "shares", Auth: true,
+			Summary: "List the users a note is shared with",
+			Status:  http.StatusOK, ResponseName: "NoteShare", Response: []models.NoteShare{},
+			Errors: []*apierror.Error{apierror.NoteNotFound},
+		},
+		{
+			Method: http.MethodDelete, Path: "/users/{id}/notes/{note_id}/shares/{user_id}", ID: "unshareNote", Tag: "shares", Auth: true,
+			Summary: "Stop sharing a note with a user",
+			Status:  http.StatusOK, ResponseName: "OK", Response: ok,
+			Errors: []*apierror.Error{apierror.NoteNotFound, apierror.ShareNotFound},
+		},
+		{
+			Method: http.MethodGet, Path: "/users/{id}/shared-with-me", ID: "listSharedWithMe", Tag: "shares", Auth: true,
+			Summary: "List the notes other users share with the user",
+			Status:  http.StatusOK, ResponseName: "SharedNote", Response: []models.SharedNote{},
+		},
+
+		{
+			Method: http.MethodPost, Path: "/users/{id}/notes/{note_id}/links", ID: "createLink", Tag: "links", Auth: true,
+			Summary:  "Create a public link to a note",
+			BodyName: "CreateLinkRequest", Body: linkSave.Request{},
+			Status: http.StatusCreated, ResponseName: "CreatedLink", Response: linkSave.Response{},
+			Errors: []*apierror.Error{apierror.NoteNotFound},
+		},
+		{
+			Method: http.MethodGet, Path: "/users/{id}/notes/{note_id}/links", ID: "listLinks", Tag: "links", Auth: true,
+			Summary: "List the public links of a note",
+			Status:  http.StatusOK, ResponseName: "NoteLink", Response: []models.NoteLink{},
+			Errors: []*apierror.Error{apierror.NoteNotFound},
+		},
+		{
+			Method: http.MethodDelete, Path: "/users/{id}/notes/{note_id}/links/{link_id}", ID: "revokeLink", Tag: "links", Auth: true,
+			Summary: "Revoke a public link",
+			Status:  http.StatusOK, ResponseName: "OK", Response: ok,
+			Errors: []*apierror.Error{apierror.NoteNotFound, apierror.LinkNotFound},
+		},
+
+		{
+			Method: http.MethodGet, Path: "/users/{id}/tags", ID: "listTags", Tag: "tags", Auth: true,
+			Summary: "List the tags of the user with their note counts",
+			Status:  http.StatusOK, ResponseName: "Tag", Response: []models.Tag{},
+		},
+
+		{
+			Method: http.MethodPost, Path: "/users/{id}/notebooks", ID: "createNotebook", Tag: "notebooks", Auth: true,
+			Summary:  "Create a notebook",
+			BodyName: "CreateNotebookRequest", Body: notebookSave.Request{},
+			Status: http.StatusCreated, ResponseName: "CreatedNotebook", Response: notebookSave.Response{},
+			Errors: []*apierror.Error{apierror.NotebookNotFound},
+		},
+		{
+			Method: http.MethodGet, Path: "/users/{id}/notebooks", ID: "listNotebooks", Tag: "notebooks", Auth: true,
+			Summary: "List notebooks",
+			Status:  http.StatusOK, ResponseName: "Notebook", Response: []models.Notebook{},
+		},
+		{
+			Method: http.MethodGet, Path: "/users/{id}/notebooks/{notebook_id}", ID: "getNotebook", Tag: "notebooks", Auth: true,
+			Summary: "Get a notebook",
+			Status:  http.StatusOK, ResponseName: "Notebook", Response: models.Notebook{},
+			Errors: []*apierror.Error{apierror.NotebookNotFound},
+		},
+		{
+			Method: http.MethodPut, Path: "/users/{id}/notebooks/{notebook_id}", ID: "updateNotebook", Tag: "notebooks", Auth: true,
+			Summary:  "Rename or move a notebook",
+			BodyName: "UpdateNotebookRequest", Body: notebookUpdate.Request{},
+			Status: http.StatusOK, ResponseName: "OK", Response: ok,
+			Errors: []*apierror.Error{apierror.NotebookNotFound, apierror.NotebookCycle},
+		},
+		{
+			Method: http.MethodDelete, Path: "/users/{id}/notebooks/{notebook_id}", ID: "deleteNotebook", Tag: "notebooks", Auth: true,
+			Summary: "Delete a notebook",
+			Query: []*Parameter{
+				query("mode", "move hands the contents to the parent notebook; recursive trashes them", &Schema{Type: "string", Enum: []any{"move", "recursive"}, Default: "move"}),
+			},
+			Status: http.StatusOK, ResponseName: "OK", Response: ok,
+			Errors: []*apierror.Error{apierror.NotebookNotFound},
+		},
+
+		{
+			Method: http.MethodGet, Path: "/users/{id}/trash", ID: "listTrash", Tag: "trash", Auth: true,
+			Summary: "List the notes in the trash",
+			Status:  http.StatusOK, ResponseName: "Note", Response: []models.Note{},
+		},
+		{
+			Method: http.MethodPost, Path: "/users/{id}/trash/{note_id}/restore", ID: "restoreNote", Tag: "trash", Auth: true,
+			Summary: "Restore a note from the trash",
+			Status:  http.StatusOK, ResponseName: "OK", Response: ok,
+			Errors: []*apierror.Error{apierror.NoteNotFound},
+		},
+		{
+			Method: http.MethodDelete, Path: "/users/{id}/trash/{note_id}", ID: "purgeNote", Tag: "trash", Auth: true,
+			Summary: "Delete a note in the trash for good",
+			Status:  http.StatusOK, ResponseName: "OK", Response: ok,
+			Errors: []*apierror.Error{apierror.NoteNotFound},
+		},
+
+		{
+			Method: http.MethodGet, Path: "/admin/users", ID: "adminListUsers", Tag: "admin", Auth: true,
+			Summary: "List or search users",
+			Query: []*Parameter{
+				query("q", "Only users whose username contains this text", &Schema{Type: "string"}),
+				query("limit", "Page size", &Schema{Type: "integer", Minimum: ptr(1), Maximum: ptr(100), Default: 50}),
+				query("offset", "Number of users to skip", &Schema{Type: "integer", Minimum: ptr(0), Default: 0}),
+			},
+			Status: http.StatusOK, ResponseName: "UserInfo", Response: []models.UserInfo{},
+		},
+		{
+			Method: http.MethodGet, Path: "/admin/users/{user_id}/stats", ID: "adminGetNoteCounts", Tag: "admin", Auth: true,
+			Summary: "Count the notes of a user",
+			Status:  http.StatusOK, ResponseName: "NoteCounts", Response: models.NoteCounts{},
+			Errors: []*apierror.Error{apierror.UserNotFound},
+		},
+		{
+			Method: http.MethodPut, Path: "/admin/users/{user_id}/role", ID: "adminSetRole", Tag: "admin", Auth: true,
+			Summary:  "Change the role of a user and log them out",
+			BodyName: "SetRoleRequest", Body: role.Request{},
+			Status: http.StatusOK, ResponseName: "OK", Response: ok,
+			Errors: []*apierror.Error{apierror.UserNotFound, apierror.LastAdmin},
+		},
+		{
+			Method: http.MethodPost, Path: "/admin/users/{user_id}/lock", ID: "adminLockUser", Tag: "admin", Auth: true,
+			Summary: "Lock the account of a user and log them out",
+			Status:  http.StatusOK, ResponseName: "OK", Response: ok,
+			Errors: []*apierror.Error{apierror.UserNotFound, apierror.LastAdmin},
+		},
+		{
+			Method: http.MethodPost, Path: "/admin/users/{user_id}/unlock", ID: "adminUnlockUser", Tag: "admin", Auth: true,
+			Summary: "Unlock the account of a user",
+			Status:  http.StatusOK, ResponseName: "OK", Response: ok,
+			Errors: []*apierror.Error{apierror.UserNotFound},
+		},
+		{
+			Method: http.MethodPost, Path: "/admin/users/{user_id}/logout", ID: "adminLogoutUser", Tag: "admin", Auth: true,
+			Summary: "End every session of a user",
+			Status:  http.StatusOK, ResponseName: "OK", Response: ok,
+		},
+		{
+			Method: http.MethodDelete, Path: "/admin/users/{user_id}", ID: "adminDeleteUser", Tag: "admin", Auth: true,
+			Summary: "Delete a user and everything they own",
+			Status:  http.StatusOK, ResponseName: "OK", Response: ok,
+			Errors: []*apierror.Error{apierror.UserNotFound, apierror.LastAdmin},
+		},
+	}
+}
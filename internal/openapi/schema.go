@@ -0,0 +1,175 @@
+package openapi
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema is a JSON Schema (draft 2020-12) object, the dialect of OpenAPI 3.1.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 any                `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Minimum              *int               `json:"minimum,omitempty"`
+	Maximum              *int               `json:"maximum,omitempty"`
+	Default              any                `json:"default,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+}
+
+func ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// reflector derives schemas from the Go types handlers decode and render.
+// Named model types become components; everything else is inlined.
+type reflector struct {
+	components map[string]*Schema
+}
+
+// request returns the schema of a request body. Fields are required when
+// their validate tag says so, validate rules become keywords, and unknown
+// fields are not allowed.
+func (g *reflector) request(name string, v any) *Schema {
+	g.components[name] = g.object(reflect.TypeOf(v), true)
+	return ref(name)
+}
+
+// response returns the schema of a response body, in which every field that
+// is not omitempty is always present.
+func (g *reflector) response(name string, v any) *Schema {
+	t := reflect.TypeOf(v)
+	if t.Kind() == reflect.Slice {
+		return &Schema{Type: "array", Items: g.response(name, reflect.Zero(t.Elem()).Interface())}
+	}
+	if _, ok := g.components[name]; !ok {
+		g.components[name] = g.object(t, false)
+	}
+	return ref(name)
+}
+
+func (g *reflector) schema(t reflect.Type, request bool) *Schema {
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Pointer:
+		s := g.schema(t.Elem(), request)
+		if s.Ref != "" {
+			return &Schema{OneOf: []*Schema{s, {Type: "null"}}}
+		}
+		s.Type = []string{s.Type.(string), "null"}
+		return s
+	case t.Kind() == reflect.Slice:
+		return &Schema{Type: "array", Items: g.schema(t.Elem(), request)}
+	case t.Kind() == reflect.Struct:
+		if !request && t.PkgPath() == "notes/internal/models" {
+			if _, ok := g.components[t.Name()]; !ok {
+				g.components[t.Name()] = nil // guards against recursion
+				g.components[t.Name()] = g.object(t, false)
+			}
+			return ref(t.Name())
+		}
+		return g.object(t, request)
+	case t.Kind() == reflect.String:
+		return &Schema{Type: "string"}
+	case t.Kind() == reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return &Schema{Type: "number"}
+	}
+	return &Schema{}
+}
+
+func (g *reflector) object(t reflect.Type, request bool) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	if request {
+		s.AdditionalProperties = ptr(false)
+	}
+	g.fields(s, t, request)
+	return s
+}
+
+func (g *reflector) fields(s *Schema, t reflect.Type, request bool) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if f.Anonymous && tag == "" {
+			g.fields(s, f.Type, request)
+			continue
+		}
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		fs := g.schema(f.Type, request)
+		required := !request && !strings.Contains(opts, "omitempty")
+		if request {
+			required = applyValidate(fs, f.Tag.Get("validate"))
+		}
+		if required {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = fs
+	}
+}
+
+// applyValidate turns the validate rules the handlers use into schema
+// keywords and reports whether the field is required.
+func applyValidate(s *Schema, tag string) bool {
+	target := s
+	required, omitempty := false, false
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			required = true
+			if target.Type == "string" {
+				target.MinLength = ptr(1)
+			}
+		case "omitempty":
+			omitempty = true
+		case "dive":
+			target = s.Items
+		case "min", "max":
+			n, err := strconv.Atoi(param)
+			if err != nil || omitempty {
+				continue
+			}
+			switch {
+			case target.Type == "integer" && name == "min":
+				target.Minimum = &n
+			case target.Type == "integer":
+				target.Maximum = &n
+			case name == "min":
+				target.MinLength = &n
+			default:
+				target.MaxLength = &n
+			}
+		case "oneof":
+			for _, v := range strings.Fields(param) {
+				target.Enum = append(target.Enum, v)
+			}
+		}
+	}
+	return required
+}
@@ -0,0 +1,364 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"notes/internal/apierror"
+	"notes/pkg/api/response"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi"
+)
+
+// Validator returns middleware that checks requests against the spec before
+// they reach the handlers: path and query parameters must have the declared
+// type and bounds, and JSON bodies must match their schema, may not carry
+// fields the schema does not declare and may not exceed maxBodySize bytes
+// (no limit when it is zero). Rejected requests get field-level errors.
+// Requests that match no operation are passed on for the router to answer.
+func Validator(maxBodySize int64) func(http.Handler) http.Handler {
+	d := Spec()
+	v := &validator{schemas: d.Components.Schemas}
+	// The operations are routed on a mux of their own, as the route of a
+	// request is only known to the main router after the middleware ran.
+	mux := chi.NewRouter()
+	ops := make(map[string]*OperationObject)
+	for path, item := range d.Paths {
+		for method, op := range item.operations() {
+			mux.MethodFunc(method, path, func(http.ResponseWriter, *http.Request) {})
+			ops[method+" "+path] = op
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path := r.URL.Path
+			if len(path) > 1 {
+				path = strings.TrimSuffix(path, "/")
+			}
+			rctx := chi.NewRouteContext()
+			if !mux.Match(rctx, r.Method, path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			op := ops[r.Method+" "+rctx.RoutePattern()]
+
+			if errs := v.params(op, rctx, r); len(errs) > 0 {
+				apierror.RenderErrors(w, r, apierror.InvalidParameter, "request parameters are invalid", errs)
+				return
+			}
+			if op.RequestBody != nil {
+				if !v.body(w, r, op, maxBodySize) {
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (p *PathItem) operations() map[string]*OperationObject {
+	ops := make(map[string]*OperationObject)
+	for method, op := range map[string]*OperationObject{
+		http.MethodGet:    p.Get,
+		http.MethodPut:    p.Put,
+		http.MethodPost:   p.Post,
+		http.MethodDelete: p.Delete,
+		http.MethodPatch:  p.Patch,
+	} {
+		if op != nil {
+			ops[method] = op
+		}
+	}
+	return ops
+}
+
+// validator checks values against the schemas of the spec, resolving
+// references through its components.
+type validator struct {
+	schemas map[string]*Schema
+}
+
+// params checks the path and query parameters of op. Values are converted to
+// the type of their schema before the schema is applied to them.
+func (v *validator) params(op *OperationObject, rctx *chi.Context, r *http.Request) []response.FieldError {
+	var errs []response.FieldError
+	query := r.URL.Query()
+	for _, p := range op.Parameters {
+		var values []string
+		switch p.In {
+		case "path":
+			values = []string{rctx.URLParam(p.Name)}
+		case "query":
+			values = query[p.Name]
+		default:
+			continue
+		}
+		if len(values) == 0 || values[0] == "" && p.In == "query" {
+			if p.Required {
+				errs = append(errs, response.FieldError{Field: p.Name, Code: "required", Detail: "parameter " + p.Name + " is required"})
+			}
+			continue
+		}
+		for _, s := range values {
+			var value any = s
+			switch p.Schema.Type {
+			case "integer":
+				if _, err := strconv.Atoi(s); err != nil {
+					errs = append(errs, response.FieldError{Field: p.Name, Code: "type", Detail: "parameter " + p.Name + " must be an integer"})
+					continue
+				}
+				value = json.Number(s)
+			case "boolean":
+				b, err := strconv.ParseBool(s)
+				if err != nil {
+					errs = append(errs, response.FieldError{Field: p.Name, Code: "type", Detail: "parameter " + p.Name + " must be true or false"})
+					continue
+				}
+				value = b
+			}
+			v.validate(p.Schema, "parameter", p.Name, value, &errs)
+		}
+	}
+	return errs
+}
+
+// body reads and checks the request body of op, and puts it back for the
+// handler. It reports whether the request may go on; otherwise the error
+// has been written.
+func (v *validator) body(w http.ResponseWriter, r *http.Request, op *OperationObject, maxBodySize int64) bool {
+	schema := v.bodySchema(op, r.Header.Get("Content-Type"))
+	if schema == nil {
+		// The handler answers content types the operation does not accept.
+		return true
+	}
+	body := r.Body
+	if maxBodySize > 0 {
+		body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	}
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			apierror.Render(w, r, apierror.PayloadTooLarge, fmt.Sprintf("request body must be at most %d bytes", tooLarge.Limit))
+			return false
+		}
+		apierror.Render(w, r, apierror.InvalidRequest, "failed to read request body")
+		return false
+	}
+	if len(bytes.TrimSpace(raw)) == 0 {
+		apierror.Render(w, r, apierror.InvalidRequest, "empty request")
+		return false
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil || dec.More() {
+		apierror.Render(w, r, apierror.InvalidRequest, "failed to decode request body")
+		return false
+	}
+	var errs []response.FieldError
+	v.validate(schema, "field", "", value, &errs)
+	if len(errs) > 0 {
+		apierror.RenderFields(w, r, errs)
+		return false
+	}
+	r.Body = io.NopCloser(bytes.NewReader(raw))
+	return true
+}
+
+// bodySchema returns the schema of the body for the content type. An
+// operation with a single JSON body is lenient about the content type, as
+// its handler always has been.
+func (v *validator) bodySchema(op *OperationObject, contentType string) *Schema {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if m, ok := op.RequestBody.Content[mediaType]; ok {
+		return m.Schema
+	}
+	if m, ok := op.RequestBody.Content["application/json"]; ok && len(op.RequestBody.Content) == 1 {
+		return m.Schema
+	}
+	return nil
+}
+
+// validate checks value, decoded from JSON with numbers kept as json.Number,
+// against s and appends the errors found to errs. Field is the path to the
+// value, such as tags[0], and kind says whether it is a body field or a
+// parameter.
+func (v *validator) validate(s *Schema, kind, field string, value any, errs *[]response.FieldError) {
+	if s.Ref != "" {
+		s = v.schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+	}
+	fail := func(code, detail string) {
+		name := field
+		if name == "" {
+			name = "body"
+		}
+		*errs = append(*errs, response.FieldError{Field: field, Code: code, Detail: kind + " " + name + " " + detail})
+	}
+
+	if s.OneOf != nil {
+		matches := 0
+		for _, alt := range s.OneOf {
+			var altErrs []response.FieldError
+			v.validate(alt, kind, field, value, &altErrs)
+			if len(altErrs) == 0 {
+				matches++
+			}
+		}
+		if matches != 1 {
+			fail("type", "does not match exactly one allowed schema")
+		}
+		return
+	}
+
+	if s.Type != nil {
+		t := jsonType(value)
+		if !typeAllowed(s.Type, t) {
+			fail("type", "must be "+typeName(s.Type))
+			return
+		}
+	}
+	if s.Enum != nil {
+		allowed := make([]string, 0, len(s.Enum))
+		found := false
+		for _, e := range s.Enum {
+			allowed = append(allowed, fmt.Sprint(e))
+			found = found || fmt.Sprint(e) == fmt.Sprint(value)
+		}
+		if !found {
+			fail("oneof", "must be one of "+strings.Join(allowed, ", "))
+			return
+		}
+	}
+
+	switch value := value.(type) {
+	case string:
+		n := utf8.RuneCountInString(value)
+		if s.MinLength != nil && n < *s.MinLength {
+			if *s.MinLength == 1 {
+				fail("required", "must not be empty")
+			} else {
+				fail("min", fmt.Sprintf("must be at least %d characters long", *s.MinLength))
+			}
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			fail("max", fmt.Sprintf("must be at most %d characters long", *s.MaxLength))
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, value); err != nil {
+				fail("format", "must be an RFC 3339 time")
+			}
+		}
+	case json.Number:
+		n, err := value.Int64()
+		if err != nil {
+			return
+		}
+		if s.Minimum != nil && n < int64(*s.Minimum) {
+			fail("min", fmt.Sprintf("must be at least %d", *s.Minimum))
+		}
+		if s.Maximum != nil && n > int64(*s.Maximum) {
+			fail("max", fmt.Sprintf("must be at most %d", *s.Maximum))
+		}
+	case []any:
+		if s.Items == nil {
+			return
+		}
+		for i, item := range value {
+			v.validate(s.Items, kind, fmt.Sprintf("%s[%d]", field, i), item, errs)
+		}
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := value[name]; !ok {
+				*errs = append(*errs, response.FieldError{Field: join(field, name), Code: "required", Detail: kind + " " + join(field, name) + " is a required field"})
+			}
+		}
+		for name, item := range value {
+			prop, ok := s.Properties[name]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					*errs = append(*errs, response.FieldError{Field: join(field, name), Code: "unknown", Detail: kind + " " + join(field, name) + " is not allowed"})
+				}
+				continue
+			}
+			v.validate(prop, kind, join(field, name), item, errs)
+		}
+	}
+}
+
+func join(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+// jsonType returns the JSON Schema type of a decoded value.
+func jsonType(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := value.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return ""
+}
+
+func typeAllowed(schemaType any, t string) bool {
+	switch schemaType := schemaType.(type) {
+	case string:
+		return schemaType == t || schemaType == "number" && t == "integer"
+	case []string:
+		for _, st := range schemaType {
+			if typeAllowed(st, t) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func typeName(schemaType any) string {
+	name := func(t string) string {
+		switch t {
+		case "integer":
+			return "an integer"
+		case "object", "array":
+			return "an " + t
+		case "null":
+			return "null"
+		}
+		return "a " + t
+	}
+	switch schemaType := schemaType.(type) {
+	case string:
+		return name(schemaType)
+	case []string:
+		names := make([]string, 0, len(schemaType))
+		for _, t := range schemaType {
+			names = append(names, name(t))
+		}
+		return strings.Join(names, " or ")
+	}
+	return "valid"
+}
@@ -0,0 +1,147 @@
+package openapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"notes/pkg/api/response"
+	"strings"
+	"testing"
+)
+
+func TestValidator(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		body        string
+		status      int
+		code        string
+		fields      map[string]string // field name to error code
+	}{
+		{
+			name:   "valid query",
+			method: http.MethodGet, target: "/users/1/notes?limit=50&sort=asc&tag=a&tag=b&total=true",
+			status: http.StatusOK,
+		},
+		{
+			name:   "unknown route",
+			method: http.MethodGet, target: "/nowhere/1",
+			status: http.StatusOK,
+		},
+		{
+			name:   "path param not an integer",
+			method: http.MethodGet, target: "/users/1/notes/abc",
+			status: http.StatusBadRequest, code: "invalid_parameter",
+			fields: map[string]string{"note_id": "type"},
+		},
+		{
+			name:   "query params out of range",
+			method: http.MethodGet, target: "/users/1/notes?limit=500&sort=sideways&created_after=yesterday&total=maybe",
+			status: http.StatusBadRequest, code: "invalid_parameter",
+			fields: map[string]string{"limit": "max", "sort": "oneof", "created_after": "format", "total": "type"},
+		},
+		{
+			name:   "required query param",
+			method: http.MethodGet, target: "/users/1/notes/search",
+			status: http.StatusBadRequest, code: "invalid_parameter",
+			fields: map[string]string{"q": "required"},
+		},
+		{
+			name:   "valid body",
+			method: http.MethodPost, target: "/users/1/notes/", contentType: "application/json",
+			body:   `{"title":"a","content":"b","tags":["x"]}`,
+			status: http.StatusOK,
+		},
+		{
+			name:   "invalid body",
+			method: http.MethodPost, target: "/users/1/notes", contentType: "application/json",
+			body:   `{"content":1,"tags":["x",2],"color":"red"}`,
+			status: http.StatusUnprocessableEntity, code: "validation_failed",
+			fields: map[string]string{"title": "required", "content": "type", "tags[1]": "type", "color": "unknown"},
+		},
+		{
+			name:   "nullable field",
+			method: http.MethodPut, target: "/users/1/notes/2/notebook", contentType: "application/json",
+			body:   `{"notebook_id":null}`,
+			status: http.StatusOK,
+		},
+		{
+			name:   "malformed body",
+			method: http.MethodPost, target: "/users/login", contentType: "application/json",
+			body:   `{"username":`,
+			status: http.StatusBadRequest, code: "invalid_request",
+		},
+		{
+			name:   "empty body",
+			method: http.MethodPost, target: "/users/login", contentType: "application/json",
+			status: http.StatusBadRequest, code: "invalid_request",
+		},
+		{
+			name:   "oversized body",
+			method: http.MethodPost, target: "/users/login", contentType: "application/json",
+			body:   `{"username":"` + strings.Repeat("a", 2048) + `","password":"p"}`,
+			status: http.StatusRequestEntityTooLarge, code: "payload_too_large",
+		},
+		{
+			name:   "schema picked by content type",
+			method: http.MethodPatch, target: "/users/1/notes/2", contentType: "application/json-patch+json",
+			body:   `[{"op":"rename","path":"/title"}]`,
+			status: http.StatusUnprocessableEntity, code: "validation_failed",
+			fields: map[string]string{"[0].op": "oneof"},
+		},
+		{
+			name:   "unsupported content type left to the handler",
+			method: http.MethodPatch, target: "/users/1/notes/2", contentType: "text/plain",
+			body:   `title`,
+			status: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotBody string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				gotBody = string(b)
+			})
+			r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			Validator(1024)(next).ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.status == http.StatusOK {
+				if gotBody != tt.body {
+					t.Errorf("handler got body %q, want %q", gotBody, tt.body)
+				}
+				return
+			}
+			var p response.Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+				t.Fatalf("decode problem: %v", err)
+			}
+			if p.Code != tt.code {
+				t.Errorf("code = %q, want %q", p.Code, tt.code)
+			}
+			got := make(map[string]string)
+			for _, f := range p.Errors {
+				got[f.Field] = f.Code
+			}
+			for field, code := range tt.fields {
+				if got[field] != code {
+					t.Errorf("field %s: code = %q, want %q (errors: %v)", field, got[field], code, p.Errors)
+				}
+			}
+			if len(got) != len(tt.fields) {
+				t.Errorf("got errors %v, want %v", got, tt.fields)
+			}
+		})
+	}
+}
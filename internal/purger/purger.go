@@ -0,0 +1,51 @@
+package purger
+
+import (
+	"context"
+	"log/slog"
+	"notes/pkg/logger/sl"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+)
+
+const tracerName = "notes/internal/purger"
+
+type TrashPurger interface {
+	PurgeTrash(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Run hard-deletes notes that have been in the trash longer than retention,
+// checking every interval until ctx is cancelled. An interval of zero or less
+// disables purging. Every pass runs in a span of its own, which its queries
+// and log records are tied to.
+func Run(ctx context.Context, log *slog.Logger, trashPurger TrashPurger, interval, retention time.Duration) {
+	const op = "purger.Run"
+	log = log.With(slog.String("op", op))
+	if interval <= 0 {
+		log.InfoContext(ctx, "trash purger disabled")
+		return
+	}
+
+	tracer := otel.Tracer(tracerName)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		passCtx, span := tracer.Start(ctx, "purger.PurgeTrash")
+		purged, err := trashPurger.PurgeTrash(passCtx, time.Now().Add(-retention))
+		if err != nil {
+			log.ErrorContext(passCtx, "failed to purge trash", sl.Err(err))
+			span.SetStatus(codes.Error, err.Error())
+		} else if purged > 0 {
+			log.InfoContext(passCtx, "trash purged", slog.Int64("notes", purged))
+		}
+		span.End()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package purger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"notes/pkg/logger/sl"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+type countingPurger struct {
+	calls atomic.Int32
+}
+
+func (p *countingPurger) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	p.calls.Add(1)
+	return 0, nil
+}
+
+func TestRunDisabled(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second} {
+		var p countingPurger
+		Run(t.Context(), slog.New(slog.DiscardHandler), &p, interval, time.Hour)
+		if n := p.calls.Load(); n != 0 {
+			t.Errorf("interval %v: purged %d times, want none", interval, n)
+		}
+	}
+}
+
+func TestRunPurgesUntilCancelled(t *testing.T) {
+	var p countingPurger
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Run(ctx, slog.New(slog.DiscardHandler), &p, time.Millisecond, time.Hour)
+	}()
+	for p.calls.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+}
+
+type failingPurger struct{}
+
+func (failingPurger) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	return 0, errors.New("database is down")
+}
+
+// TestRunLogsTraceID checks that a pass logs with the context of its span,
+// so that its records carry the trace id.
+func TestRunLogsTraceID(t *testing.T) {
+	provider := sdktrace.NewTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+
+	var logs bytes.Buffer
+	log := slog.New(sl.NewTraceHandler(slog.NewJSONHandler(&logs, nil)))
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	Run(ctx, log, failingPurger{}, time.Hour, time.Hour)
+	if !strings.Contains(logs.String(), "failed to purge trash") || !strings.Contains(logs.String(), `"trace_id"`) {
+		t.Errorf("got log %s, want the failure with a trace id", logs.String())
+	}
+}
@@ -0,0 +1,82 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"notes/internal/apierror"
+	"notes/internal/models"
+	"notes/internal/storage/storagetest"
+	"testing"
+)
+
+// TestAdmin handles support tickets through the admin API. Every change to
+// a user ends their sessions, so the tokens they hold stop working at once.
+func TestAdmin(t *testing.T) {
+	a := newAPI(t)
+	alice := a.register("alice")
+	bob := a.register("bob")
+	carol := a.register("carol")
+	a.register("Alicia")
+
+	a.wantProblem("admin API as user", a.do(alice, http.MethodGet, "/admin/users", nil), http.StatusForbidden, apierror.Forbidden.Code)
+	// The first admin is made with the role command, outside the API.
+	if err := a.store.SetUserRole(t.Context(), alice.id, models.RoleAdmin); err != nil {
+		t.Fatalf("SetUserRole: %v", err)
+	}
+	a.want("token from before promotion", a.do(alice, http.MethodGet, "/admin/users", nil), http.StatusUnauthorized)
+	alice = a.login("alice")
+
+	var users []models.UserInfo
+	a.decode(a.want("search users", a.do(alice, http.MethodGet, "/admin/users?q=+ALI+", nil), http.StatusOK), &users)
+	if len(users) != 2 || users[0].Username != "alice" || users[0].Role != models.RoleAdmin || users[1].Username != "Alicia" {
+		t.Fatalf("got users %+v, want alice and Alicia", users)
+	}
+	a.decode(a.want("page users", a.do(alice, http.MethodGet, "/admin/users?limit=2&offset=1", nil), http.StatusOK), &users)
+	if len(users) != 2 || users[0].ID != bob.id || users[1].ID != carol.id {
+		t.Fatalf("got users %+v, want bob and carol", users)
+	}
+
+	// Admins see into the notes of any user.
+	id := storagetest.NewNote(t, a.store, bob.id, "groceries", "milk")
+	trashed := storagetest.NewNote(t, a.store, bob.id, "old", "")
+	a.want("trash note", a.do(bob, http.MethodDelete, fmt.Sprintf("/users/%d/notes/%d", bob.id, trashed), nil), http.StatusOK)
+	var counts models.NoteCounts
+	a.decode(a.want("note counts", a.do(alice, http.MethodGet, fmt.Sprintf("/admin/users/%d/stats", bob.id), nil), http.StatusOK), &counts)
+	if counts != (models.NoteCounts{UserID: bob.id, Active: 1, Trashed: 1}) {
+		t.Fatalf("got counts %+v", counts)
+	}
+	a.want("GET note of user", a.do(alice, http.MethodGet, fmt.Sprintf("/users/%d/notes/%d", bob.id, id), nil), http.StatusOK)
+
+	bobRole := fmt.Sprintf("/admin/users/%d/role", bob.id)
+	a.want("make read-only", a.do(alice, http.MethodPut, bobRole, map[string]string{"role": models.RoleReadOnly}), http.StatusOK)
+	a.want("token from before demotion", a.do(bob, http.MethodGet, fmt.Sprintf("/users/%d/notes", bob.id), nil), http.StatusUnauthorized)
+	bob = a.login("bob")
+	a.want("read as read-only", a.do(bob, http.MethodGet, fmt.Sprintf("/users/%d/notes/%d", bob.id, id), nil), http.StatusOK)
+	a.wantProblem("write as read-only", a.do(bob, http.MethodDelete, fmt.Sprintf("/users/%d/notes/%d", bob.id, id), nil), http.StatusForbidden, apierror.Forbidden.Code)
+	a.wantProblem("unknown role", a.do(alice, http.MethodPut, bobRole, map[string]string{"role": "root"}), http.StatusUnprocessableEntity, apierror.ValidationFailed.Code)
+
+	a.want("force logout", a.do(alice, http.MethodPost, fmt.Sprintf("/admin/users/%d/logout", bob.id), nil), http.StatusOK)
+	a.want("token after logout", a.do(bob, http.MethodGet, fmt.Sprintf("/users/%d/notes", bob.id), nil), http.StatusUnauthorized)
+
+	a.want("lock", a.do(alice, http.MethodPost, fmt.Sprintf("/admin/users/%d/lock", carol.id), nil), http.StatusOK)
+	a.want("token after lock", a.do(carol, http.MethodGet, fmt.Sprintf("/users/%d/notes", carol.id), nil), http.StatusUnauthorized)
+	a.wantProblem("login when locked", a.do(user{}, http.MethodPost, "/users/login", map[string]string{"username": "carol", "password": "password1"}),
+		http.StatusForbidden, apierror.AccountLocked.Code)
+	a.want("unlock", a.do(alice, http.MethodPost, fmt.Sprintf("/admin/users/%d/unlock", carol.id), nil), http.StatusOK)
+	a.login("carol")
+
+	// Admins cannot lock out, demote or delete themselves, so one of them
+	// is always left; admins acting on each other at once are left to the
+	// storage tests.
+	own := fmt.Sprintf("/admin/users/%d", alice.id)
+	a.wantProblem("lock own account", a.do(alice, http.MethodPost, own+"/lock", nil), http.StatusForbidden, apierror.Forbidden.Code)
+	a.wantProblem("demote self", a.do(alice, http.MethodPut, own+"/role", map[string]string{"role": models.RoleUser}), http.StatusForbidden, apierror.Forbidden.Code)
+	a.wantProblem("delete own account", a.do(alice, http.MethodDelete, own, nil), http.StatusForbidden, apierror.Forbidden.Code)
+
+	a.want("delete", a.do(alice, http.MethodDelete, fmt.Sprintf("/admin/users/%d", bob.id), nil), http.StatusOK)
+	a.wantProblem("note counts of deleted user", a.do(alice, http.MethodGet, fmt.Sprintf("/admin/users/%d/stats", bob.id), nil), http.StatusNotFound, apierror.UserNotFound.Code)
+	a.wantProblem("delete twice", a.do(alice, http.MethodDelete, fmt.Sprintf("/admin/users/%d", bob.id), nil), http.StatusNotFound, apierror.UserNotFound.Code)
+	if _, err := a.store.GetNote(t.Context(), bob.id, id); err == nil {
+		t.Fatal("notes of deleted user are left behind")
+	}
+}
@@ -0,0 +1,129 @@
+package router
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"notes/internal/config"
+	"notes/internal/session"
+	"notes/internal/storage/memory"
+	"notes/pkg/api/response"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// api serves requests through the whole router, the way clients make them:
+// users register, then act with the access token they got.
+type api struct {
+	t      *testing.T
+	router chi.Router
+	store  *memory.Storage
+}
+
+// user is a registered user and the access token they act with. The zero
+// user makes anonymous requests.
+type user struct {
+	id    int
+	token string
+}
+
+func newAPI(t *testing.T) *api {
+	t.Helper()
+	var shuttingDown atomic.Bool
+	cfg := &config.Config{}
+	cfg.Auth.AccessTokenTTL = time.Hour
+	cfg.Auth.RefreshTokenTTL = time.Hour
+	store := memory.New()
+	return &api{t: t, router: New(slog.New(slog.DiscardHandler), cfg, store, &shuttingDown), store: store}
+}
+
+// register signs a user up through the API.
+func (a *api) register(username string) user {
+	a.t.Helper()
+	var tokens session.Tokens
+	a.decode(a.want("register "+username, a.do(user{}, http.MethodPost, "/users/register", map[string]string{
+		"username": username,
+		"password": "password1",
+	}), http.StatusCreated), &tokens)
+	u, err := a.store.GetUserByUsername(a.t.Context(), username)
+	if err != nil {
+		a.t.Fatalf("GetUserByUsername(%s): %v", username, err)
+	}
+	return user{id: u.ID, token: tokens.AccessToken}
+}
+
+// login logs a registered user in again, for a token that carries their
+// current role.
+func (a *api) login(username string) user {
+	a.t.Helper()
+	var tokens session.Tokens
+	a.decode(a.want("login "+username, a.do(user{}, http.MethodPost, "/users/login", map[string]string{
+		"username": username,
+		"password": "password1",
+	}), http.StatusOK), &tokens)
+	u, err := a.store.GetUserByUsername(a.t.Context(), username)
+	if err != nil {
+		a.t.Fatalf("GetUserByUsername(%s): %v", username, err)
+	}
+	return user{id: u.ID, token: tokens.AccessToken}
+}
+
+// do sends a request as u with body, unless nil, encoded as JSON. header
+// holds pairs of header names and values.
+func (a *api) do(u user, method, target string, body any, header ...string) *httptest.ResponseRecorder {
+	a.t.Helper()
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			a.t.Fatalf("encode %v: %v", body, err)
+		}
+		r = strings.NewReader(string(b))
+	}
+	req := httptest.NewRequestWithContext(a.t.Context(), method, target, r)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if u.token != "" {
+		req.Header.Set("Authorization", "Bearer "+u.token)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	a.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// want fails the test unless rec has the given status.
+func (a *api) want(what string, rec *httptest.ResponseRecorder, status int) *httptest.ResponseRecorder {
+	a.t.Helper()
+	if rec.Code != status {
+		a.t.Fatalf("%s: status %d, want %d: %s", what, rec.Code, status, rec.Body)
+	}
+	return rec
+}
+
+// wantProblem fails the test unless rec is a problem document with the
+// given status and code.
+func (a *api) wantProblem(what string, rec *httptest.ResponseRecorder, status int, code string) {
+	a.t.Helper()
+	var p response.Problem
+	a.decode(a.want(what, rec, status), &p)
+	if p.Code != code {
+		a.t.Fatalf("%s: code %q, want %q: %s", what, p.Code, code, rec.Body)
+	}
+}
+
+func (a *api) decode(rec *httptest.ResponseRecorder, v any) {
+	a.t.Helper()
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		a.t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+}
@@ -0,0 +1,80 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"notes/internal/apierror"
+	"notes/internal/handlers/link/public"
+	linkSave "notes/internal/handlers/link/save"
+	"notes/internal/models"
+	"notes/internal/storage/storagetest"
+	"notes/pkg/auth"
+	"testing"
+	"time"
+)
+
+// TestLink follows public links to a note the way people without an account
+// do, anonymously, through the lifetime of a link: counted views, password,
+// expiry and revocation.
+func TestLink(t *testing.T) {
+	a := newAPI(t)
+	alice := a.register("alice")
+	bob := a.register("bob")
+	carol := a.register("carol")
+	id := storagetest.NewNote(t, a.store, alice.id, "groceries", "milk", "home")
+	a.want("share for writing", a.do(alice, http.MethodPost, fmt.Sprintf("/users/%d/notes/%d/shares", alice.id, id),
+		map[string]string{"username": "bob", "permission": models.PermissionWrite}), http.StatusOK)
+	links := fmt.Sprintf("/users/%d/notes/%d/links", alice.id, id)
+	anonymous := user{}
+
+	var open linkSave.Response
+	a.decode(a.want("create link", a.do(alice, http.MethodPost, links, map[string]any{}), http.StatusCreated), &open)
+	if open.Token == "" || open.URL != "/public/notes/"+open.Token {
+		t.Fatalf("got link %+v", open)
+	}
+	for range 2 {
+		var note models.PublicNote
+		a.decode(a.want("follow link", a.do(anonymous, http.MethodGet, open.URL, nil), http.StatusOK), &note)
+		if note.Title != "groceries" || note.Content != "milk" || len(note.Tags) != 1 {
+			t.Fatalf("got public note %+v", note)
+		}
+	}
+
+	tomorrow := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	var protected linkSave.Response
+	a.decode(a.want("create protected link", a.do(alice, http.MethodPost, links, map[string]any{"password": "secret1", "expires_at": tomorrow}), http.StatusCreated), &protected)
+	a.wantProblem("follow without password", a.do(anonymous, http.MethodGet, protected.URL, nil), http.StatusUnauthorized, apierror.LinkPasswordRequired.Code)
+	a.wantProblem("follow with wrong password", a.do(anonymous, http.MethodGet, protected.URL, nil, public.PasswordHeader, "secret2"), http.StatusForbidden, apierror.InvalidLinkPassword.Code)
+	a.want("follow with password", a.do(anonymous, http.MethodGet, protected.URL, nil, public.PasswordHeader, "secret1"), http.StatusOK)
+
+	var list []models.NoteLink
+	a.decode(a.want("list links", a.do(alice, http.MethodGet, links, nil), http.StatusOK), &list)
+	views := make(map[int]models.NoteLink)
+	for _, l := range list {
+		views[l.ID] = l
+	}
+	if l := views[open.ID]; len(list) != 2 || l.ViewCount != 2 || l.HasPassword || l.ExpiresAt != nil {
+		t.Fatalf("got open link %+v of %d", l, len(list))
+	}
+	if l := views[protected.ID]; l.ViewCount != 1 || !l.HasPassword || l.ExpiresAt == nil || !l.ExpiresAt.Equal(tomorrow) {
+		t.Fatalf("got protected link %+v", l)
+	}
+
+	// Links cannot be created already expired, so one expires in the store.
+	yesterday := time.Now().Add(-24 * time.Hour)
+	if _, err := a.store.SaveNoteLink(t.Context(), alice.id, id, auth.HashOpaqueToken("expired"), "", &yesterday); err != nil {
+		t.Fatalf("SaveNoteLink: %v", err)
+	}
+	a.wantProblem("follow expired link", a.do(anonymous, http.MethodGet, "/public/notes/expired", nil), http.StatusGone, apierror.LinkExpired.Code)
+	a.wantProblem("create expired link", a.do(alice, http.MethodPost, links, map[string]any{"expires_at": yesterday}), http.StatusUnprocessableEntity, apierror.ValidationFailed.Code)
+
+	a.want("revoke link", a.do(alice, http.MethodDelete, fmt.Sprintf("%s/%d", links, open.ID), nil), http.StatusOK)
+	a.wantProblem("follow revoked link", a.do(anonymous, http.MethodGet, open.URL, nil), http.StatusNotFound, apierror.LinkNotFound.Code)
+	a.wantProblem("follow unknown link", a.do(anonymous, http.MethodGet, "/public/notes/unknown", nil), http.StatusNotFound, apierror.LinkNotFound.Code)
+
+	// Only the owner hands a note out to people without an account.
+	a.wantProblem("create link with write access", a.do(bob, http.MethodPost, fmt.Sprintf("/users/%d/notes/%d/links", bob.id, id), map[string]any{}),
+		http.StatusForbidden, apierror.Forbidden.Code)
+	a.wantProblem("create link to note of another user", a.do(carol, http.MethodPost, fmt.Sprintf("/users/%d/notes/%d/links", carol.id, id), map[string]any{}),
+		http.StatusNotFound, apierror.NoteNotFound.Code)
+}
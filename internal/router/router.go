@@ -0,0 +1,181 @@
+// Package router wires the handlers of the API into a chi router.
+package router
+
+import (
+	"log/slog"
+	"net/http"
+	"notes/internal/apierror"
+	"notes/internal/config"
+	adminDelete "notes/internal/handlers/admin/delete"
+	"notes/internal/handlers/admin/lock"
+	adminLogout "notes/internal/handlers/admin/logout"
+	"notes/internal/handlers/admin/role"
+	"notes/internal/handlers/admin/stats"
+	"notes/internal/handlers/admin/users"
+	"notes/internal/handlers/health/live"
+	"notes/internal/handlers/health/ready"
+	linkDelete "notes/internal/handlers/link/delete"
+	linkGetAll "notes/internal/handlers/link/getall"
+	"notes/internal/handlers/link/public"
+	linkSave "notes/internal/handlers/link/save"
+	"notes/internal/handlers/note/delete"
+	"notes/internal/handlers/note/get"
+	"notes/internal/handlers/note/getall"
+	"notes/internal/handlers/note/move"
+	"notes/internal/handlers/note/patch"
+	noteSave "notes/internal/handlers/note/save"
+	"notes/internal/handlers/note/search"
+	"notes/internal/handlers/note/update"
+	notebookDelete "notes/internal/handlers/notebook/delete"
+	notebookGet "notes/internal/handlers/notebook/get"
+	notebookGetAll "notes/internal/handlers/notebook/getall"
+	notebookSave "notes/internal/handlers/notebook/save"
+	notebookUpdate "notes/internal/handlers/notebook/update"
+	"notes/internal/handlers/revision/diff"
+	revisionGet "notes/internal/handlers/revision/get"
+	revisionGetAll "notes/internal/handlers/revision/getall"
+	"notes/internal/handlers/revision/restore"
+	shareDelete "notes/internal/handlers/share/delete"
+	shareGetAll "notes/internal/handlers/share/getall"
+	"notes/internal/handlers/share/received"
+	shareSave "notes/internal/handlers/share/save"
+	tagGetAll "notes/internal/handlers/tag/getall"
+	trashDelete "notes/internal/handlers/trash/delete"
+	trashGetAll "notes/internal/handlers/trash/getall"
+	trashRestore "notes/internal/handlers/trash/restore"
+	"notes/internal/handlers/user/login"
+	"notes/internal/handlers/user/logout"
+	"notes/internal/handlers/user/logoutall"
+	"notes/internal/handlers/user/refresh"
+	userSave "notes/internal/handlers/user/save"
+	"notes/internal/metrics"
+	"notes/internal/models"
+	"notes/internal/openapi"
+	"notes/internal/session"
+	"notes/internal/storage"
+	"notes/internal/tracing"
+	"sync/atomic"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/swaggest/swgui/v5emb"
+	JWTMiddleware "notes/internal/middleware"
+)
+
+// New returns the router of the API. Routes added here must also be listed
+// in openapi.Operations; the router test fails when the two drift apart.
+func New(log *slog.Logger, cfg *config.Config, storage storage.Store, shuttingDown *atomic.Bool) chi.Router {
+	router := chi.NewRouter()
+	router.Use(middleware.RequestID)
+	router.Use(tracing.Middleware)
+	router.Use(metrics.Middleware)
+	router.Use(JWTMiddleware.Logger(log))
+	router.Use(JWTMiddleware.Recoverer(log))
+	// Cancel the request context, and so its queries, when the server
+	// timeout fires instead of letting them run on unobserved. A zero
+	// timeout would cancel every request up front, so it means none.
+	if cfg.HTTPServer.Timeout > 0 {
+		router.Use(JWTMiddleware.Timeout(cfg.HTTPServer.Timeout))
+	}
+	issuer := session.Issuer{
+		AccessTokenTTL:  cfg.Auth.AccessTokenTTL,
+		RefreshTokenTTL: cfg.Auth.RefreshTokenTTL,
+	}
+	router.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		apierror.Render(w, r, apierror.RouteNotFound, "no route for "+r.URL.Path)
+	})
+	router.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		apierror.Render(w, r, apierror.MethodNotAllowed, r.Method+" is not allowed on "+r.URL.Path)
+	})
+	router.Get("/healthz", live.New())
+	router.Get("/readyz", ready.New(log, storage, shuttingDown))
+	if cfg.HTTPServer.MetricsAddress == "" {
+		router.Handle("/metrics", promhttp.Handler())
+	}
+	// Requests are validated against the spec only once they are
+	// authenticated, so that anonymous callers learn nothing about the
+	// schema and cannot make the server buffer bodies.
+	validate := openapi.Validator(cfg.HTTPServer.MaxBodySize)
+	router.Get("/openapi.json", openapi.Handler())
+	router.Mount("/docs", v5emb.New("Notes API", "/openapi.json", "/docs/"))
+
+	router.With(validate).Post("/users/register", userSave.New(log, storage, issuer))
+	router.With(validate).Post("/users/login", login.New(log, storage, issuer))
+	router.With(validate).Post("/users/token/refresh", refresh.New(log, storage, issuer))
+	router.With(JWTMiddleware.JWT(storage)).Post("/users/logout", logout.New(log, storage))
+	router.With(JWTMiddleware.JWT(storage)).Post("/users/logout-all", logoutall.New(log, storage))
+	router.With(validate).Get("/public/notes/{token}", public.New(log, storage))
+
+	router.Route("/users/{id}/notes", func(r chi.Router) {
+		r.Use(JWTMiddleware.JWT(storage))
+		r.Use(JWTMiddleware.Authorize(log))
+		r.Use(validate)
+		r.Post("/", noteSave.New(log, storage))
+		r.Get("/", getall.New(log, storage))
+		r.Get("/search", search.New(log, storage))
+		r.Get("/{note_id}", get.New(log, storage))
+		r.Put("/{note_id}", update.New(log, storage))
+		r.Patch("/{note_id}", patch.New(log, storage, cfg.HTTPServer.MaxBodySize))
+		r.Delete("/{note_id}", delete.New(log, storage))
+		r.Put("/{note_id}/notebook", move.New(log, storage))
+		r.Get("/{note_id}/revisions", revisionGetAll.New(log, storage))
+		r.Get("/{note_id}/revisions/diff", diff.New(log, storage))
+		r.Get("/{note_id}/revisions/{rev}", revisionGet.New(log, storage))
+		r.Post("/{note_id}/revisions/{rev}/restore", restore.New(log, storage))
+		r.Post("/{note_id}/shares", shareSave.New(log, storage))
+		r.Get("/{note_id}/shares", shareGetAll.New(log, storage))
+		r.Delete("/{note_id}/shares/{user_id}", shareDelete.New(log, storage))
+		r.Post("/{note_id}/links", linkSave.New(log, storage))
+		r.Get("/{note_id}/links", linkGetAll.New(log, storage))
+		r.Delete("/{note_id}/links/{link_id}", linkDelete.New(log, storage))
+	})
+
+	router.Route("/users/{id}/shared-with-me", func(r chi.Router) {
+		r.Use(JWTMiddleware.JWT(storage))
+		r.Use(JWTMiddleware.Authorize(log))
+		r.Use(validate)
+		r.Get("/", received.New(log, storage))
+	})
+
+	router.Route("/users/{id}/tags", func(r chi.Router) {
+		r.Use(JWTMiddleware.JWT(storage))
+		r.Use(JWTMiddleware.Authorize(log))
+		r.Use(validate)
+		r.Get("/", tagGetAll.New(log, storage))
+	})
+
+	router.Route("/users/{id}/notebooks", func(r chi.Router) {
+		r.Use(JWTMiddleware.JWT(storage))
+		r.Use(JWTMiddleware.Authorize(log))
+		r.Use(validate)
+		r.Post("/", notebookSave.New(log, storage))
+		r.Get("/", notebookGetAll.New(log, storage))
+		r.Get("/{notebook_id}", notebookGet.New(log, storage))
+		r.Put("/{notebook_id}", notebookUpdate.New(log, storage))
+		r.Delete("/{notebook_id}", notebookDelete.New(log, storage))
+	})
+
+	router.Route("/users/{id}/trash", func(r chi.Router) {
+		r.Use(JWTMiddleware.JWT(storage))
+		r.Use(JWTMiddleware.Authorize(log))
+		r.Use(validate)
+		r.Get("/", trashGetAll.New(log, storage))
+		r.Post("/{note_id}/restore", trashRestore.New(log, storage))
+		r.Delete("/{note_id}", trashDelete.New(log, storage))
+	})
+
+	router.Route("/admin", func(r chi.Router) {
+		r.Use(JWTMiddleware.JWT(storage))
+		r.Use(JWTMiddleware.RequireRole(models.RoleAdmin))
+		r.Use(validate)
+		r.Get("/users", users.New(log, storage))
+		r.Get("/users/{user_id}/stats", stats.New(log, storage))
+		r.Put("/users/{user_id}/role", role.New(log, storage))
+		r.Post("/users/{user_id}/lock", lock.New(log, storage, true))
+		r.Post("/users/{user_id}/unlock", lock.New(log, storage, false))
+		r.Post("/users/{user_id}/logout", adminLogout.New(log, storage))
+		r.Delete("/users/{user_id}", adminDelete.New(log, storage))
+	})
+	return router
+}
@@ -0,0 +1,136 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"notes/internal/config"
+	"notes/internal/openapi"
+	"notes/internal/storage/memory"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-chi/chi"
+)
+
+// infraRoutes are served by the router but are not part of the API.
+var infraRoutes = []string{"/metrics", "/openapi.json", "/docs"}
+
+func newTestRouter(t *testing.T) chi.Router {
+	t.Helper()
+	var shuttingDown atomic.Bool
+	return New(slog.New(slog.DiscardHandler), &config.Config{}, memory.New(), &shuttingDown)
+}
+
+// TestSpecMatchesRouter fails when a route is added to the router without
+// being described in the OpenAPI document, or the other way round.
+func TestSpecMatchesRouter(t *testing.T) {
+	routes := make(map[string]bool)
+	err := chi.Walk(newTestRouter(t), func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if slices.ContainsFunc(infraRoutes, func(p string) bool { return strings.HasPrefix(route, p) }) {
+			return nil
+		}
+		if len(route) > 1 {
+			route = strings.TrimSuffix(route, "/")
+		}
+		routes[method+" "+route] = true
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walk routes: %v", err)
+	}
+
+	documented := make(map[string]bool)
+	for _, op := range openapi.Operations() {
+		key := op.Method + " " + op.Path
+		if documented[key] {
+			t.Errorf("%s is documented twice", key)
+		}
+		documented[key] = true
+		if !routes[key] {
+			t.Errorf("%s is documented but not routed", key)
+		}
+	}
+	for key := range routes {
+		if !documented[key] {
+			t.Errorf("%s is routed but not documented", key)
+		}
+	}
+}
+
+func TestServeSpec(t *testing.T) {
+	router := newTestRouter(t)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /openapi.json: status %d", rec.Code)
+	}
+	var doc struct {
+		OpenAPI string                     `json:"openapi"`
+		Paths   map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("decode spec: %v", err)
+	}
+	if doc.OpenAPI != "3.1.0" || len(doc.Paths) == 0 {
+		t.Errorf("got openapi %q with %d paths", doc.OpenAPI, len(doc.Paths))
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs/", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "/openapi.json") {
+		t.Errorf("GET /docs/: status %d", rec.Code)
+	}
+}
+
+// TestAuthenticateBeforeValidate checks that anonymous requests are turned
+// away before their parameters and bodies are looked at.
+func TestAuthenticateBeforeValidate(t *testing.T) {
+	router := newTestRouter(t)
+	tests := []struct {
+		method string
+		target string
+		body   string
+	}{
+		{http.MethodPost, "/users/1/notes", `{"color":"red"}`},
+		{http.MethodGet, "/users/1/notes?limit=500", ""},
+		{http.MethodGet, "/users/1/notes/abc", ""},
+		{http.MethodPut, "/admin/users/1/role", `{"role":"god"}`},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		r.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(rec, r)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.target, rec.Code, http.StatusUnauthorized)
+		}
+	}
+}
+
+// ctxStore fails pings whose context is already done, as a database would.
+type ctxStore struct {
+	*memory.Storage
+}
+
+func (s ctxStore) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// TestZeroTimeout checks that a zero server timeout leaves requests
+// unbounded rather than cancelling them up front.
+func TestZeroTimeout(t *testing.T) {
+	var shuttingDown atomic.Bool
+	router := New(slog.New(slog.DiscardHandler), &config.Config{}, ctxStore{memory.New()}, &shuttingDown)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("GET /readyz: status %d: %s", rec.Code, rec.Body)
+	}
+}
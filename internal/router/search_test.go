@@ -0,0 +1,54 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"notes/internal/apierror"
+	"notes/internal/models"
+	"notes/internal/storage/storagetest"
+	"strings"
+	"testing"
+)
+
+// TestSearch searches notes through the API. The search route must not be
+// taken for a note id, and a user only ever searches their own notes.
+func TestSearch(t *testing.T) {
+	a := newAPI(t)
+	alice := a.register("alice")
+	bob := a.register("bob")
+	storagetest.NewNote(t, a.store, alice.id, "meeting notes", "discussed the budget for next year")
+	storagetest.NewNote(t, a.store, alice.id, "budget", "budget draft and budget review")
+	storagetest.NewNote(t, a.store, alice.id, "<b>snacks</b>", `crisps <img src=x onerror="alert(1)"> & snacks`)
+	storagetest.NewNote(t, a.store, bob.id, "budget", "not visible to alice")
+	search := fmt.Sprintf("/users/%d/notes/search", alice.id)
+
+	var results []models.SearchResult
+	a.decode(a.want("search", a.do(alice, http.MethodGet, search+"?q=budget", nil), http.StatusOK), &results)
+	if len(results) != 2 || results[0].Title != "budget" || results[1].Title != "meeting notes" {
+		t.Fatalf("got results %+v, want the two budget notes of alice, best first", results)
+	}
+	a.decode(a.want("search second page", a.do(alice, http.MethodGet, search+"?q=budget&limit=1&offset=1", nil), http.StatusOK), &results)
+	if len(results) != 1 || results[0].Title != "meeting notes" {
+		t.Fatalf("second page: got results %+v", results)
+	}
+
+	// Clients render highlights as HTML, so the text of the note is escaped
+	// around the marks.
+	a.decode(a.want("search snacks", a.do(alice, http.MethodGet, search+"?q=snacks", nil), http.StatusOK), &results)
+	if len(results) != 1 {
+		t.Fatalf("got results %+v", results)
+	}
+	for _, h := range []string{results[0].TitleHighlight, results[0].Snippet} {
+		if strings.ContainsAny(strings.NewReplacer("<mark>", "", "</mark>", "").Replace(h), `<>"`) || !strings.Contains(h, "<mark>snacks</mark>") {
+			t.Fatalf("highlight not escaped: %q", h)
+		}
+	}
+
+	a.decode(a.want("search by bob", a.do(bob, http.MethodGet, fmt.Sprintf("/users/%d/notes/search?q=budget", bob.id), nil), http.StatusOK), &results)
+	if len(results) != 1 || results[0].UserID != bob.id {
+		t.Fatalf("bob got results %+v, want his own note only", results)
+	}
+	a.wantProblem("search notes of another user", a.do(bob, http.MethodGet, search+"?q=budget", nil), http.StatusForbidden, apierror.Forbidden.Code)
+	a.wantProblem("search without words", a.do(alice, http.MethodGet, search+"?q=+", nil), http.StatusBadRequest, apierror.InvalidParameter.Code)
+	a.wantProblem("search with too large a page", a.do(alice, http.MethodGet, search+"?q=budget&limit=1000", nil), http.StatusBadRequest, apierror.InvalidParameter.Code)
+}
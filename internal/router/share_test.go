@@ -0,0 +1,69 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"notes/internal/apierror"
+	"notes/internal/models"
+	"notes/internal/storage/storagetest"
+	"testing"
+)
+
+// TestShare walks a note through being shared for reading, for writing and
+// no longer. Whoever it is shared with reaches it under their own id; only
+// its owner may delete it or change whom it is shared with.
+func TestShare(t *testing.T) {
+	a := newAPI(t)
+	alice := a.register("alice")
+	bob := a.register("bob")
+	a.register("carol")
+	id := storagetest.NewNote(t, a.store, alice.id, "groceries", "milk")
+	shares := fmt.Sprintf("/users/%d/notes/%d/shares", alice.id, id)
+	note := fmt.Sprintf("/users/%d/notes/%d", bob.id, id)
+	sharedWithMe := fmt.Sprintf("/users/%d/shared-with-me", bob.id)
+
+	a.wantProblem("GET before sharing", a.do(bob, http.MethodGet, note, nil), http.StatusNotFound, apierror.NoteNotFound.Code)
+	a.want("share for reading", a.do(alice, http.MethodPost, shares, map[string]string{"username": "bob", "permission": models.PermissionRead}), http.StatusOK)
+	a.want("GET with read access", a.do(bob, http.MethodGet, note, nil), http.StatusOK)
+	var received []models.SharedNote
+	a.decode(a.want("shared with me", a.do(bob, http.MethodGet, sharedWithMe, nil), http.StatusOK), &received)
+	if len(received) != 1 || received[0].ID != id || received[0].Permission != models.PermissionRead || received[0].OwnerUsername != "alice" {
+		t.Fatalf("bob got shared notes %+v, want groceries of alice to read", received)
+	}
+	update := map[string]string{"title": "groceries", "content": "milk, crisps"}
+	a.wantProblem("PUT with read access", a.do(bob, http.MethodPut, note, update, "If-Match", `"1"`), http.StatusForbidden, apierror.Forbidden.Code)
+
+	// Sharing again changes the permission rather than adding a share.
+	a.want("share for writing", a.do(alice, http.MethodPost, shares, map[string]string{"username": "bob", "permission": models.PermissionWrite}), http.StatusOK)
+	a.want("PUT with write access", a.do(bob, http.MethodPut, note, update, "If-Match", `"1"`), http.StatusOK)
+	var n models.Note
+	a.decode(a.want("GET by owner", a.do(alice, http.MethodGet, fmt.Sprintf("/users/%d/notes/%d", alice.id, id), nil), http.StatusOK), &n)
+	if n.Content != "milk, crisps" {
+		t.Fatalf("owner sees content %q after the write of bob", n.Content)
+	}
+	a.wantProblem("DELETE with write access", a.do(bob, http.MethodDelete, note, nil), http.StatusForbidden, apierror.Forbidden.Code)
+	a.wantProblem("reshare with write access",
+		a.do(bob, http.MethodPost, fmt.Sprintf("/users/%d/notes/%d/shares", bob.id, id), map[string]string{"username": "carol", "permission": models.PermissionRead}),
+		http.StatusForbidden, apierror.Forbidden.Code)
+	a.wantProblem("unshare with write access",
+		a.do(bob, http.MethodDelete, fmt.Sprintf("/users/%d/notes/%d/shares/%d", bob.id, id, bob.id), nil),
+		http.StatusForbidden, apierror.Forbidden.Code)
+	var list []models.NoteShare
+	a.decode(a.want("list shares", a.do(alice, http.MethodGet, shares, nil), http.StatusOK), &list)
+	if len(list) != 1 || list[0].UserID != bob.id || list[0].Permission != models.PermissionWrite {
+		t.Fatalf("got shares %+v, want write access for bob only", list)
+	}
+
+	a.wantProblem("share with owner", a.do(alice, http.MethodPost, shares, map[string]string{"username": "alice", "permission": models.PermissionRead}),
+		http.StatusUnprocessableEntity, apierror.ShareWithOwner.Code)
+	a.wantProblem("share with unknown user", a.do(alice, http.MethodPost, shares, map[string]string{"username": "dave", "permission": models.PermissionRead}),
+		http.StatusNotFound, apierror.UserNotFound.Code)
+
+	a.want("unshare", a.do(alice, http.MethodDelete, fmt.Sprintf("%s/%d", shares, bob.id), nil), http.StatusOK)
+	a.wantProblem("unshare twice", a.do(alice, http.MethodDelete, fmt.Sprintf("%s/%d", shares, bob.id), nil), http.StatusNotFound, apierror.ShareNotFound.Code)
+	a.wantProblem("GET after unsharing", a.do(bob, http.MethodGet, note, nil), http.StatusNotFound, apierror.NoteNotFound.Code)
+	a.decode(a.want("shared with me after unsharing", a.do(bob, http.MethodGet, sharedWithMe, nil), http.StatusOK), &received)
+	if len(received) != 0 {
+		t.Fatalf("bob still got shared notes %+v", received)
+	}
+}
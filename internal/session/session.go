@@ -0,0 +1,49 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"notes/pkg/auth"
+	"time"
+)
+
+type RefreshTokenSaver interface {
+	SaveRefreshToken(ctx context.Context, userID int, sessionID, tokenHash string, expiresAt time.Time) error
+}
+
+// Issuer hands out access tokens together with the refresh tokens of their session.
+type Issuer struct {
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+}
+
+type Tokens struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Start opens a new session for the user and returns its first pair of tokens.
+func (i Issuer) Start(ctx context.Context, saver RefreshTokenSaver, userID int, username, role string) (Tokens, error) {
+	const op = "session.Issuer.Start"
+	sessionID, err := auth.NewOpaqueToken()
+	if err != nil {
+		return Tokens{}, fmt.Errorf("%s: session id: %w", op, err)
+	}
+	refreshToken, err := auth.NewOpaqueToken()
+	if err != nil {
+		return Tokens{}, fmt.Errorf("%s: refresh token: %w", op, err)
+	}
+	if err := saver.SaveRefreshToken(ctx, userID, sessionID, auth.HashOpaqueToken(refreshToken), i.RefreshExpiry()); err != nil {
+		return Tokens{}, fmt.Errorf("%s: %w", op, err)
+	}
+	accessToken, err := auth.GenerateToken(userID, username, role, sessionID, i.AccessTokenTTL)
+	if err != nil {
+		return Tokens{}, fmt.Errorf("%s: access token: %w", op, err)
+	}
+	return Tokens{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+// RefreshExpiry returns the expiry for a refresh token issued now.
+func (i Issuer) RefreshExpiry() time.Time {
+	return time.Now().Add(i.RefreshTokenTTL)
+}
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"notes/internal/models"
+	"slices"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+const (
+	SortAsc  = "asc"
+	SortDesc = "desc"
+
+	SortByCreatedAt = "created_at"
+	SortByUpdatedAt = "updated_at"
+	SortByTitle     = "title"
+)
+
+// ValidSortBy reports whether notes can be ordered by the field.
+func ValidSortBy(field string) bool {
+	switch field {
+	case SortByCreatedAt, SortByUpdatedAt, SortByTitle:
+		return true
+	}
+	return false
+}
+
+// Cursor is a keyset position in a note listing ordered by (SortBy, id).
+// Key holds the value of the SortBy field of the note at the position.
+// Backward cursors select the page before the position instead of after it.
+type Cursor struct {
+	Key      string `json:"k"`
+	ID       int    `json:"id"`
+	SortBy   string `json:"f"`
+	Sort     string `json:"s"`
+	Backward bool   `json:"b,omitempty"`
+}
+
+// Encode renders the cursor as an opaque URL-safe string.
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func DecodeCursor(s string) (Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil || !c.Valid() {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// Valid reports whether the cursor names a note by a sort field and order
+// notes can be listed in, with a key of the type of that field.
+func (c Cursor) Valid() bool {
+	if c.ID <= 0 || !ValidSortBy(c.SortBy) || (c.Sort != SortAsc && c.Sort != SortDesc) {
+		return false
+	}
+	if c.SortBy == SortByTitle {
+		return true
+	}
+	_, err := time.Parse(time.RFC3339Nano, c.Key)
+	return err == nil
+}
+
+// PageRequest selects one page of a note listing.
+type PageRequest struct {
+	Limit     int
+	SortBy    string
+	Sort      string
+	Cursor    *Cursor
+	WithTotal bool
+}
+
+// Backward reports whether the page is fetched against the listing order.
+func (p PageRequest) Backward() bool {
+	return p.Cursor != nil && p.Cursor.Backward
+}
+
+type NotePage struct {
+	Notes []models.Note
+	Next  *Cursor
+	Prev  *Cursor
+	Total *int
+}
+
+// Paginate turns up to Limit+1 notes, fetched in the direction of the request,
+// into a page in listing order with cursors to its neighbours.
+func Paginate(notes []models.Note, page PageRequest) NotePage {
+	more := len(notes) > page.Limit
+	if more {
+		notes = notes[:page.Limit]
+	}
+	if page.Backward() {
+		slices.Reverse(notes)
+	}
+	res := NotePage{Notes: notes}
+	if len(notes) == 0 {
+		return res
+	}
+	first, last := notes[0], notes[len(notes)-1]
+	// Moving forward, the page was reached from an earlier one; moving backward,
+	// from a later one. The other side exists only if more rows were found.
+	hasPrev := page.Cursor != nil && !page.Backward() || page.Backward() && more
+	hasNext := page.Backward() || more
+	if hasPrev {
+		res.Prev = &Cursor{Key: SortKey(first, page.SortBy), ID: first.ID, SortBy: page.SortBy, Sort: page.Sort, Backward: true}
+	}
+	if hasNext {
+		res.Next = &Cursor{Key: SortKey(last, page.SortBy), ID: last.ID, SortBy: page.SortBy, Sort: page.Sort}
+	}
+	return res
+}
+
+// SortKey returns the value of the sort field of a note as stored in a cursor.
+func SortKey(note models.Note, sortBy string) string {
+	switch sortBy {
+	case SortByUpdatedAt:
+		return note.UpdatedAt.Format(time.RFC3339Nano)
+	case SortByTitle:
+		return note.Title
+	default:
+		return note.CreatedAt.Format(time.RFC3339Nano)
+	}
+}
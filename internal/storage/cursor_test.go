@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"encoding/base64"
+	"errors"
+	"notes/internal/models"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	for _, c := range []Cursor{
+		{Key: "2025-11-01T10:00:00.5Z", ID: 7, SortBy: SortByCreatedAt, Sort: SortDesc},
+		{Key: "2025-11-01T10:00:00Z", ID: 1, SortBy: SortByCreatedAt, Sort: SortAsc, Backward: true},
+		{Key: "2025-11-01T10:00:00Z", ID: 3, SortBy: SortByUpdatedAt, Sort: SortDesc},
+		{Key: "groceries", ID: 4, SortBy: SortByTitle, Sort: SortAsc},
+	} {
+		got, err := DecodeCursor(c.Encode())
+		if err != nil {
+			t.Fatalf("DecodeCursor(%+v): %v", c, err)
+		}
+		if got != c {
+			t.Errorf("round trip of %+v gave %+v", c, got)
+		}
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"empty", ""},
+		{"not base64", "not a cursor!"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte(`{"k":"a","id":1,"f":"created_at","s":"asc"}`))},
+		{"not json", encode("cursor")},
+		{"json array", encode(`[1]`)},
+		{"missing id", encode(`{"k":"a","f":"created_at","s":"asc"}`)},
+		{"negative id", encode(`{"k":"a","id":-1,"f":"created_at","s":"asc"}`)},
+		{"missing sort", encode(`{"k":"a","id":1,"f":"created_at"}`)},
+		{"invalid sort", encode(`{"k":"a","id":1,"f":"created_at","s":"up"}`)},
+		{"missing sort field", encode(`{"k":"a","id":1,"s":"asc"}`)},
+		{"unknown sort field", encode(`{"k":"a","id":1,"f":"content","s":"asc"}`)},
+		{"time key not a time", encode(`{"k":"garbage","id":1,"f":"created_at","s":"desc"}`)},
+		{"empty time key", encode(`{"id":1,"f":"updated_at","s":"desc"}`)},
+		{"injected sort field", encode(`{"k":"a","id":1,"f":"title; DROP TABLE notes","s":"asc"}`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeCursor(tt.cursor); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("DecodeCursor(%q) = %v, want %v", tt.cursor, err, ErrInvalidCursor)
+			}
+		})
+	}
+}
+
+// TestPaginate walks a listing of five notes two at a time, the way the
+// stores call Paginate: with one row more than the limit, fetched against the
+// listing order when going backward.
+func TestPaginate(t *testing.T) {
+	notes := make([]models.Note, 5)
+	for i := range notes {
+		notes[i] = models.Note{ID: i + 1, Title: string(rune('a' + i))}
+	}
+	// fetch returns the rows a store would find for the page.
+	fetch := func(page PageRequest) []models.Note {
+		rows := slices.Clone(notes)
+		if c := page.Cursor; c != nil {
+			if c.Backward {
+				rows = rows[:c.ID-1]
+			} else {
+				rows = rows[c.ID:]
+			}
+		}
+		if page.Backward() {
+			slices.Reverse(rows)
+		}
+		return rows[:min(len(rows), page.Limit+1)]
+	}
+	ids := func(p NotePage) []int {
+		var res []int
+		for _, n := range p.Notes {
+			res = append(res, n.ID)
+		}
+		return res
+	}
+	tests := []struct {
+		name   string
+		cursor *Cursor
+		want   []int
+		prev   int
+		next   int
+	}{
+		{name: "first page", want: []int{1, 2}, next: 2},
+		{name: "middle page", cursor: &Cursor{ID: 2}, want: []int{3, 4}, prev: 3, next: 4},
+		{name: "last page", cursor: &Cursor{ID: 4}, want: []int{5}, prev: 5},
+		{name: "back from the last page", cursor: &Cursor{ID: 5, Backward: true}, want: []int{3, 4}, prev: 3, next: 4},
+		{name: "back to the first page", cursor: &Cursor{ID: 3, Backward: true}, want: []int{1, 2}, next: 2},
+		{name: "past the last page", cursor: &Cursor{ID: 5}, want: nil},
+		{name: "before the first page", cursor: &Cursor{ID: 1, Backward: true}, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := PageRequest{Limit: 2, SortBy: SortByTitle, Sort: SortAsc, Cursor: tt.cursor}
+			got := Paginate(fetch(page), page)
+			if !slices.Equal(ids(got), tt.want) {
+				t.Errorf("notes = %v, want %v", ids(got), tt.want)
+			}
+			checkCursor(t, "prev", got.Prev, tt.prev, true)
+			checkCursor(t, "next", got.Next, tt.next, false)
+		})
+	}
+}
+
+// checkCursor checks that c points at note id in the given direction, or is
+// nil when id is zero.
+func checkCursor(t *testing.T, name string, c *Cursor, id int, backward bool) {
+	t.Helper()
+	switch {
+	case id == 0 && c != nil:
+		t.Errorf("%s = %+v, want none", name, *c)
+	case id == 0:
+	case c == nil:
+		t.Errorf("%s = none, want note %d", name, id)
+	case c.ID != id || c.Backward != backward || c.Key != string(rune('a'+id-1)) || c.SortBy != SortByTitle || c.Sort != SortAsc:
+		t.Errorf("%s = %+v, want note %d with backward %t", name, *c, id, backward)
+	}
+}
+
+func TestSortKey(t *testing.T) {
+	created := time.Date(2025, 11, 1, 10, 0, 0, 500, time.UTC)
+	note := models.Note{ID: 1, Title: "groceries", CreatedAt: created, UpdatedAt: created.Add(time.Hour)}
+	tests := []struct {
+		sortBy string
+		want   string
+	}{
+		{SortByCreatedAt, "2025-11-01T10:00:00.0000005Z"},
+		{SortByUpdatedAt, "2025-11-01T11:00:00.0000005Z"},
+		{SortByTitle, "groceries"},
+		{"", "2025-11-01T10:00:00.0000005Z"},
+	}
+	for _, tt := range tests {
+		if got := SortKey(note, tt.sortBy); got != tt.want {
+			t.Errorf("SortKey(%q) = %q, want %q", tt.sortBy, got, tt.want)
+		}
+	}
+}
+
+func TestValidSortBy(t *testing.T) {
+	for _, field := range []string{SortByCreatedAt, SortByUpdatedAt, SortByTitle} {
+		if !ValidSortBy(field) {
+			t.Errorf("ValidSortBy(%q) = false", field)
+		}
+	}
+	for _, field := range []string{"", "id", "content", "Title", "title desc"} {
+		if ValidSortBy(field) {
+			t.Errorf("ValidSortBy(%q) = true", field)
+		}
+	}
+}
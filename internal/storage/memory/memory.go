@@ -0,0 +1,1303 @@
+// Package memory implements storage.Store in process memory. It keeps the
+// semantics of the postgres backend and is meant for local runs and tests;
+// nothing survives a restart.
+package memory
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"html"
+	"notes/internal/models"
+	"notes/internal/storage"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var _ storage.Store = (*Storage)(nil)
+
+type link struct {
+	models.NoteLink
+	tokenHash string
+	password  []byte
+}
+
+type refreshToken struct {
+	userID    int
+	familyID  string
+	expiresAt time.Time
+	usedAt    *time.Time
+	revokedAt *time.Time
+}
+
+type Storage struct {
+	mu sync.RWMutex
+
+	userSeq, noteSeq, notebookSeq, linkSeq int
+
+	users     map[int]*models.User
+	usernames map[string]int
+	notes     map[int]*models.Note
+	revisions map[int][]models.Revision
+	notebooks map[int]*models.Notebook
+	shares    map[int]map[int]*models.NoteShare
+	links     map[int]*link
+	tokens    map[string]*refreshToken
+}
+
+func New() *Storage {
+	return &Storage{
+		users:     make(map[int]*models.User),
+		usernames: make(map[string]int),
+		notes:     make(map[int]*models.Note),
+		revisions: make(map[int][]models.Revision),
+		notebooks: make(map[int]*models.Notebook),
+		shares:    make(map[int]map[int]*models.NoteShare),
+		links:     make(map[int]*link),
+		tokens:    make(map[string]*refreshToken),
+	}
+}
+
+// Ping always succeeds: there is nothing to reach.
+func (s *Storage) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s *Storage) Close() error {
+	return nil
+}
+
+// now returns the current time at the precision postgres stores timestamps with,
+// so cursor keys round-trip the same way on both backends.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+func (s *Storage) SaveUser(ctx context.Context, username, password string) (int, error) {
+	const op = "storage.memory.SaveUser"
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, fmt.Errorf("%s: hash password: %w", op, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.usernames[username]; ok {
+		return 0, storage.ErrUserExists
+	}
+	s.userSeq++
+	s.users[s.userSeq] = &models.User{
+		ID:        s.userSeq,
+		Username:  username,
+		Password:  string(hashedPassword),
+		Role:      models.RoleUser,
+		CreatedAt: now(),
+	}
+	s.usernames[username] = s.userSeq
+	return s.userSeq, nil
+}
+
+func (s *Storage) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, ok := s.usernames[username]
+	if !ok {
+		return nil, storage.ErrUserNotFound
+	}
+	u := *s.users[id]
+	u.LockedAt = clonePtr(u.LockedAt)
+	return &u, nil
+}
+
+func clonePtr[T any](v *T) *T {
+	if v == nil {
+		return nil
+	}
+	c := *v
+	return &c
+}
+
+func (s *Storage) SaveNote(ctx context.Context, userID int, title, content string, tags []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := now()
+	s.noteSeq++
+	s.notes[s.noteSeq] = &models.Note{
+		ID:        s.noteSeq,
+		UserID:    userID,
+		Title:     title,
+		Content:   content,
+		Tags:      tagSet(tags),
+		Version:   1,
+		CreatedAt: t,
+		UpdatedAt: t,
+	}
+	return nil
+}
+
+// tagSet returns the sorted distinct tags, the way the postgres backend reads
+// them back from note_tags.
+func tagSet(tags []string) []string {
+	res := slices.Clone(tags)
+	slices.Sort(res)
+	return slices.Compact(res)
+}
+
+// cloneNote copies a stored note so callers never share memory with the store.
+func cloneNote(n *models.Note) models.Note {
+	c := *n
+	c.Tags = slices.Clone(n.Tags)
+	if c.Tags == nil {
+		c.Tags = []string{}
+	}
+	if n.NotebookID != nil {
+		id := *n.NotebookID
+		c.NotebookID = &id
+	}
+	if n.DeletedAt != nil {
+		t := *n.DeletedAt
+		c.DeletedAt = &t
+	}
+	return c
+}
+
+// activeNote returns a note that is not in the trash.
+func (s *Storage) activeNote(noteID int) (*models.Note, bool) {
+	n, ok := s.notes[noteID]
+	if !ok || n.DeletedAt != nil {
+		return nil, false
+	}
+	return n, true
+}
+
+func (s *Storage) GetNote(ctx context.Context, userID, noteID int) (*models.Note, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	n, ok := s.activeNote(noteID)
+	if !ok {
+		return nil, storage.ErrNoteNotFound
+	}
+	if n.UserID != userID {
+		if _, shared := s.shares[noteID][userID]; !shared {
+			return nil, storage.ErrNoteNotFound
+		}
+	}
+	note := cloneNote(n)
+	return &note, nil
+}
+
+func matchesFilter(n *models.Note, filter storage.NoteFilter) bool {
+	if filter.NotebookID != nil && (n.NotebookID == nil || *n.NotebookID != *filter.NotebookID) {
+		return false
+	}
+	if len(filter.Tags) > 0 {
+		matched := 0
+		for _, t := range filter.Tags {
+			if slices.Contains(n.Tags, t) {
+				matched++
+			}
+		}
+		if matched == 0 || filter.MatchAllTags && matched != len(filter.Tags) {
+			return false
+		}
+	}
+	if filter.CreatedAfter != nil && !n.CreatedAt.After(*filter.CreatedAfter) {
+		return false
+	}
+	if filter.CreatedBefore != nil && !n.CreatedAt.Before(*filter.CreatedBefore) {
+		return false
+	}
+	if filter.UpdatedSince != nil && n.UpdatedAt.Before(*filter.UpdatedSince) {
+		return false
+	}
+	if filter.TitlePrefix != "" && !strings.HasPrefix(strings.ToLower(n.Title), strings.ToLower(filter.TitlePrefix)) {
+		return false
+	}
+	if filter.HasContent != nil && (n.Content != "") != *filter.HasContent {
+		return false
+	}
+	return true
+}
+
+// compareNotes orders two notes ascending by (sortBy, id).
+func compareNotes(a, b models.Note, sortBy string) int {
+	var c int
+	switch sortBy {
+	case storage.SortByTitle:
+		c = strings.Compare(a.Title, b.Title)
+	case storage.SortByUpdatedAt:
+		c = a.UpdatedAt.Compare(b.UpdatedAt)
+	default:
+		c = a.CreatedAt.Compare(b.CreatedAt)
+	}
+	if c == 0 {
+		c = cmp.Compare(a.ID, b.ID)
+	}
+	return c
+}
+
+// compareNote orders a note against the keyset position (key, id) of a listing
+// sorted ascending by sortBy.
+func compareNote(n models.Note, sortBy, key string, id int) (int, error) {
+	var c int
+	if sortBy == storage.SortByTitle {
+		c = strings.Compare(n.Title, key)
+	} else {
+		t, err := time.Parse(time.RFC3339Nano, key)
+		if err != nil {
+			return 0, storage.ErrInvalidCursor
+		}
+		v := n.CreatedAt
+		if sortBy == storage.SortByUpdatedAt {
+			v = n.UpdatedAt
+		}
+		c = v.Compare(t)
+	}
+	if c == 0 {
+		c = cmp.Compare(n.ID, id)
+	}
+	return c, nil
+}
+
+// GetAllNotes returns one keyset-paginated page of the user's notes ordered by
+// (page.SortBy, id).
+func (s *Storage) GetAllNotes(ctx context.Context, userID int, page storage.PageRequest, filter storage.NoteFilter) (*storage.NotePage, error) {
+	const op = "storage.memory.GetAllNotes"
+	if page.Sort != storage.SortAsc {
+		page.Sort = storage.SortDesc
+	}
+	if !storage.ValidSortBy(page.SortBy) {
+		page.SortBy = storage.SortByCreatedAt
+	}
+	s.mu.RLock()
+	notes := []models.Note{}
+	for _, n := range s.notes {
+		if n.UserID == userID && n.DeletedAt == nil && matchesFilter(n, filter) {
+			notes = append(notes, cloneNote(n))
+		}
+	}
+	s.mu.RUnlock()
+
+	var total *int
+	if page.WithTotal {
+		count := len(notes)
+		total = &count
+	}
+
+	// Walking backward flips both the keyset comparison and the order;
+	// storage.Paginate restores the listing order afterwards.
+	desc := page.Sort == storage.SortDesc
+	if page.Backward() {
+		desc = !desc
+	}
+	slices.SortFunc(notes, func(a, b models.Note) int {
+		c := compareNotes(a, b, page.SortBy)
+		if desc {
+			return -c
+		}
+		return c
+	})
+	if page.Cursor != nil {
+		after := notes[:0]
+		for _, n := range notes {
+			c, err := compareNote(n, page.SortBy, page.Cursor.Key, page.Cursor.ID)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+			if desc && c < 0 || !desc && c > 0 {
+				after = append(after, n)
+			}
+		}
+		notes = after
+	}
+	if len(notes) > page.Limit+1 {
+		notes = notes[:page.Limit+1]
+	}
+	res := storage.Paginate(notes, page)
+	res.Total = total
+	return &res, nil
+}
+
+// UpdateNote overwrites a note if it is still at expectedVersion, or
+// unconditionally when expectedVersion is 0. It returns the version of the note
+// after the call: the new one on success, the current one on
+// storage.ErrVersionMismatch.
+func (s *Storage) UpdateNote(ctx context.Context, noteID int, userID int, title, content string, tags []string, expectedVersion int) (int, error) {
+	patch := storage.NotePatch{Title: &title, Content: &content, Tags: &tags}
+	return s.writeNote(noteID, userID, patch, expectedVersion)
+}
+
+// PatchNote writes only the fields set in the patch. Versions are handled
+// as in UpdateNote.
+func (s *Storage) PatchNote(ctx context.Context, noteID, userID int, patch storage.NotePatch, expectedVersion int) (int, error) {
+	return s.writeNote(noteID, userID, patch, expectedVersion)
+}
+
+func (s *Storage) writeNote(noteID, userID int, patch storage.NotePatch, expectedVersion int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.activeNote(noteID)
+	if !ok {
+		return 0, storage.ErrNoteNotFound
+	}
+	if n.UserID != userID {
+		sh, shared := s.shares[noteID][userID]
+		if !shared || sh.Permission != models.PermissionWrite {
+			return 0, storage.ErrForbidden
+		}
+	}
+	if expectedVersion != 0 && expectedVersion != n.Version {
+		return n.Version, storage.ErrVersionMismatch
+	}
+	if patch.Title != nil || patch.Content != nil {
+		s.saveRevision(n)
+	}
+	if patch.Title != nil {
+		n.Title = *patch.Title
+	}
+	if patch.Content != nil {
+		n.Content = *patch.Content
+	}
+	if patch.Tags != nil {
+		n.Tags = tagSet(*patch.Tags)
+	}
+	n.Version++
+	n.UpdatedAt = now()
+	return n.Version, nil
+}
+
+// saveRevision stores the current title and content of a note as its next revision.
+func (s *Storage) saveRevision(n *models.Note) {
+	revs := s.revisions[n.ID]
+	s.revisions[n.ID] = append(revs, models.Revision{
+		NoteID:    n.ID,
+		Revision:  len(revs) + 1,
+		Title:     n.Title,
+		Content:   n.Content,
+		CreatedAt: n.UpdatedAt,
+	})
+}
+
+func (s *Storage) GetTags(ctx context.Context, userID int) ([]models.Tag, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, n := range s.notes {
+		if n.UserID != userID || n.DeletedAt != nil {
+			continue
+		}
+		for _, t := range n.Tags {
+			counts[t]++
+		}
+	}
+	tags := []models.Tag{}
+	for name, count := range counts {
+		tags = append(tags, models.Tag{Name: name, NoteCount: count})
+	}
+	slices.SortFunc(tags, func(a, b models.Tag) int { return strings.Compare(a.Name, b.Name) })
+	return tags, nil
+}
+
+// ownNote returns an active note of the user, or storage.ErrNoteNotFound.
+func (s *Storage) ownNote(userID, noteID int) (*models.Note, error) {
+	n, ok := s.activeNote(noteID)
+	if !ok || n.UserID != userID {
+		return nil, storage.ErrNoteNotFound
+	}
+	return n, nil
+}
+
+func (s *Storage) GetRevisions(ctx context.Context, userID, noteID int) ([]models.Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, err := s.ownNote(userID, noteID); err != nil {
+		return nil, err
+	}
+	revisions := slices.Clone(s.revisions[noteID])
+	slices.Reverse(revisions)
+	if revisions == nil {
+		revisions = []models.Revision{}
+	}
+	return revisions, nil
+}
+
+func (s *Storage) GetRevision(ctx context.Context, userID, noteID, revision int) (*models.Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, err := s.ownNote(userID, noteID); err != nil {
+		return nil, err
+	}
+	revs := s.revisions[noteID]
+	if revision < 1 || revision > len(revs) {
+		return nil, storage.ErrRevisionNotFound
+	}
+	rev := revs[revision-1]
+	return &rev, nil
+}
+
+func (s *Storage) RestoreRevision(ctx context.Context, userID, noteID, revision int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.activeNote(noteID)
+	if !ok {
+		return storage.ErrNoteNotFound
+	}
+	if n.UserID != userID {
+		return storage.ErrForbidden
+	}
+	revs := s.revisions[noteID]
+	if revision < 1 || revision > len(revs) {
+		return storage.ErrRevisionNotFound
+	}
+	rev := revs[revision-1]
+	s.saveRevision(n)
+	n.Title = rev.Title
+	n.Content = rev.Content
+	n.Version++
+	n.UpdatedAt = now()
+	return nil
+}
+
+// searchTerms splits text into the lowercase words it is indexed by.
+func searchTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// wordSpans returns the byte offsets of the words of text.
+func wordSpans(text string) [][2]int {
+	var spans [][2]int
+	start := -1
+	for i, r := range text {
+		word := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if word && start < 0 {
+			start = i
+		}
+		if !word && start >= 0 {
+			spans = append(spans, [2]int{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(text)})
+	}
+	return spans
+}
+
+// highlight wraps the words of text that are search terms in <mark> tags and
+// escapes the rest, like ts_headline and storage.MarkMatches do for the
+// postgres backend.
+func highlight(text string, terms []string) string {
+	var b strings.Builder
+	last := 0
+	for _, sp := range wordSpans(text) {
+		if slices.Contains(terms, strings.ToLower(text[sp[0]:sp[1]])) {
+			b.WriteString(html.EscapeString(text[last:sp[0]]))
+			b.WriteString("<mark>" + html.EscapeString(text[sp[0]:sp[1]]) + "</mark>")
+			last = sp[1]
+		}
+	}
+	b.WriteString(html.EscapeString(text[last:]))
+	return b.String()
+}
+
+// snippet cuts a window of up to 30 words around the first term found in text.
+func snippet(text string, terms []string) string {
+	const maxWords = 30
+	spans := wordSpans(text)
+	if len(spans) == 0 {
+		return ""
+	}
+	first := 0
+	for i, sp := range spans {
+		if slices.Contains(terms, strings.ToLower(text[sp[0]:sp[1]])) {
+			first = i
+			break
+		}
+	}
+	start := max(0, first-maxWords/3)
+	end := min(len(spans), start+maxWords)
+	return highlight(text[spans[start][0]:spans[end-1][1]], terms)
+}
+
+// SearchNotes matches notes containing every word of the query. Title matches
+// rank higher than content matches, mirroring the weights of the postgres
+// search vector.
+func (s *Storage) SearchNotes(ctx context.Context, userID int, query string, limit, offset int) ([]models.SearchResult, error) {
+	terms := slices.DeleteFunc(searchTerms(query), func(t string) bool { return t == "or" })
+	results := []models.SearchResult{}
+	if len(terms) == 0 {
+		return results, nil
+	}
+	s.mu.RLock()
+	for _, n := range s.notes {
+		if n.UserID != userID || n.DeletedAt != nil {
+			continue
+		}
+		titleWords, contentWords := searchTerms(n.Title), searchTerms(n.Content)
+		var rank float64
+		found := true
+		for _, t := range terms {
+			inTitle := float64(countOf(titleWords, t))
+			inContent := float64(countOf(contentWords, t))
+			if inTitle+inContent == 0 {
+				found = false
+				break
+			}
+			rank += inTitle + 0.4*inContent
+		}
+		if !found {
+			continue
+		}
+		results = append(results, models.SearchResult{
+			Note:           cloneNote(n),
+			Rank:           rank / float64(len(titleWords)+len(contentWords)),
+			TitleHighlight: highlight(n.Title, terms),
+			Snippet:        snippet(n.Content, terms),
+		})
+	}
+	s.mu.RUnlock()
+
+	slices.SortFunc(results, func(a, b models.SearchResult) int {
+		if c := cmp.Compare(b.Rank, a.Rank); c != 0 {
+			return c
+		}
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	if offset >= len(results) {
+		return []models.SearchResult{}, nil
+	}
+	results = results[offset:]
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+func countOf(words []string, term string) int {
+	n := 0
+	for _, w := range words {
+		if w == term {
+			n++
+		}
+	}
+	return n
+}
+
+// DeleteNote moves the note to the trash. Trashed notes are hidden from every
+// other query until restored or purged.
+func (s *Storage) DeleteNote(ctx context.Context, noteID, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.activeNote(noteID)
+	if !ok {
+		return storage.ErrNoteNotFound
+	}
+	if n.UserID != userID {
+		return storage.ErrForbidden
+	}
+	t := now()
+	n.DeletedAt = &t
+	return nil
+}
+
+func (s *Storage) GetTrash(ctx context.Context, userID int) ([]models.Note, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	notes := []models.Note{}
+	for _, n := range s.notes {
+		if n.UserID == userID && n.DeletedAt != nil {
+			notes = append(notes, cloneNote(n))
+		}
+	}
+	slices.SortFunc(notes, func(a, b models.Note) int { return b.DeletedAt.Compare(*a.DeletedAt) })
+	return notes, nil
+}
+
+// trashedNote returns a note of the user that is in the trash.
+func (s *Storage) trashedNote(userID, noteID int) (*models.Note, bool) {
+	n, ok := s.notes[noteID]
+	if !ok || n.UserID != userID || n.DeletedAt == nil {
+		return nil, false
+	}
+	return n, true
+}
+
+func (s *Storage) RestoreNote(ctx context.Context, userID, noteID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.trashedNote(userID, noteID)
+	if !ok {
+		return storage.ErrNoteNotFound
+	}
+	n.DeletedAt = nil
+	return nil
+}
+
+// PurgeNote permanently removes a note that is already in the trash.
+func (s *Storage) PurgeNote(ctx context.Context, userID, noteID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.trashedNote(userID, noteID); !ok {
+		return storage.ErrNoteNotFound
+	}
+	s.removeNote(noteID)
+	return nil
+}
+
+// PurgeTrash permanently removes every note trashed before the given time.
+func (s *Storage) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var purged int64
+	for id, n := range s.notes {
+		if n.DeletedAt != nil && n.DeletedAt.Before(before) {
+			s.removeNote(id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// removeNote deletes a note together with everything that references it.
+func (s *Storage) removeNote(noteID int) {
+	delete(s.notes, noteID)
+	delete(s.revisions, noteID)
+	delete(s.shares, noteID)
+	for id, l := range s.links {
+		if l.NoteID == noteID {
+			delete(s.links, id)
+		}
+	}
+}
+
+func (s *Storage) SaveNotebook(ctx context.Context, userID int, name string, parentID *int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if parentID != nil {
+		if _, err := s.ownNotebook(userID, *parentID); err != nil {
+			return 0, err
+		}
+	}
+	t := now()
+	s.notebookSeq++
+	s.notebooks[s.notebookSeq] = &models.Notebook{
+		ID:        s.notebookSeq,
+		UserID:    userID,
+		ParentID:  cloneID(parentID),
+		Name:      name,
+		CreatedAt: t,
+		UpdatedAt: t,
+	}
+	return s.notebookSeq, nil
+}
+
+func cloneID(id *int) *int {
+	if id == nil {
+		return nil
+	}
+	c := *id
+	return &c
+}
+
+func cloneNotebook(nb *models.Notebook) models.Notebook {
+	c := *nb
+	c.ParentID = cloneID(nb.ParentID)
+	return c
+}
+
+// ownNotebook returns a notebook of the user, or storage.ErrNotebookNotFound.
+func (s *Storage) ownNotebook(userID, notebookID int) (*models.Notebook, error) {
+	nb, ok := s.notebooks[notebookID]
+	if !ok || nb.UserID != userID {
+		return nil, storage.ErrNotebookNotFound
+	}
+	return nb, nil
+}
+
+func (s *Storage) GetNotebooks(ctx context.Context, userID int) ([]models.Notebook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	notebooks := []models.Notebook{}
+	for _, nb := range s.notebooks {
+		if nb.UserID == userID {
+			notebooks = append(notebooks, cloneNotebook(nb))
+		}
+	}
+	slices.SortFunc(notebooks, func(a, b models.Notebook) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return notebooks, nil
+}
+
+func (s *Storage) GetNotebook(ctx context.Context, userID, notebookID int) (*models.Notebook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	nb, err := s.ownNotebook(userID, notebookID)
+	if err != nil {
+		return nil, err
+	}
+	res := cloneNotebook(nb)
+	return &res, nil
+}
+
+// subtree returns the ids of a notebook and all notebooks nested in it.
+func (s *Storage) subtree(notebookID int) map[int]bool {
+	ids := map[int]bool{notebookID: true}
+	for grown := true; grown; {
+		grown = false
+		for _, nb := range s.notebooks {
+			if nb.ParentID != nil && ids[*nb.ParentID] && !ids[nb.ID] {
+				ids[nb.ID] = true
+				grown = true
+			}
+		}
+	}
+	return ids
+}
+
+func (s *Storage) UpdateNotebook(ctx context.Context, userID, notebookID int, name string, parentID *int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	nb, err := s.ownNotebook(userID, notebookID)
+	if err != nil {
+		return err
+	}
+	if parentID != nil {
+		if _, err := s.ownNotebook(userID, *parentID); err != nil {
+			return err
+		}
+		if s.subtree(notebookID)[*parentID] {
+			return storage.ErrNotebookCycle
+		}
+	}
+	nb.Name = name
+	nb.ParentID = cloneID(parentID)
+	nb.UpdatedAt = now()
+	return nil
+}
+
+// DeleteNotebook removes a notebook. With recursive set, nested notebooks are
+// removed as well and all their notes go to the trash; otherwise the notes and
+// child notebooks of the removed notebook are moved to the root.
+func (s *Storage) DeleteNotebook(ctx context.Context, userID, notebookID int, recursive bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.ownNotebook(userID, notebookID); err != nil {
+		return err
+	}
+	removed := map[int]bool{notebookID: true}
+	if recursive {
+		removed = s.subtree(notebookID)
+	}
+	t := now()
+	for _, n := range s.notes {
+		if n.NotebookID == nil || !removed[*n.NotebookID] {
+			continue
+		}
+		if recursive && n.DeletedAt == nil {
+			deletedAt := t
+			n.DeletedAt = &deletedAt
+		}
+		n.NotebookID = nil
+	}
+	for id := range removed {
+		delete(s.notebooks, id)
+	}
+	for _, nb := range s.notebooks {
+		if nb.ParentID != nil && removed[*nb.ParentID] {
+			nb.ParentID = nil
+		}
+	}
+	return nil
+}
+
+// MoveNote puts a note into a notebook, or into the root when notebookID is nil.
+func (s *Storage) MoveNote(ctx context.Context, userID, noteID int, notebookID *int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if notebookID != nil {
+		if _, err := s.ownNotebook(userID, *notebookID); err != nil {
+			return err
+		}
+	}
+	n, err := s.ownNote(userID, noteID)
+	if err != nil {
+		return err
+	}
+	n.NotebookID = cloneID(notebookID)
+	n.Version++
+	return nil
+}
+
+// ShareNote grants another user read or write access to a note. Sharing an
+// already shared note again replaces the permission.
+func (s *Storage) ShareNote(ctx context.Context, ownerID, noteID int, username, permission string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkShareOwner(ownerID, noteID); err != nil {
+		return err
+	}
+	targetID, ok := s.usernames[username]
+	if !ok {
+		return storage.ErrUserNotFound
+	}
+	if targetID == ownerID {
+		return storage.ErrShareWithOwner
+	}
+	if sh, ok := s.shares[noteID][targetID]; ok {
+		sh.Permission = permission
+		return nil
+	}
+	if s.shares[noteID] == nil {
+		s.shares[noteID] = make(map[int]*models.NoteShare)
+	}
+	s.shares[noteID][targetID] = &models.NoteShare{
+		NoteID:     noteID,
+		UserID:     targetID,
+		Permission: permission,
+		CreatedAt:  now(),
+	}
+	return nil
+}
+
+func (s *Storage) UnshareNote(ctx context.Context, ownerID, noteID, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkShareOwner(ownerID, noteID); err != nil {
+		return err
+	}
+	if _, ok := s.shares[noteID][userID]; !ok {
+		return storage.ErrShareNotFound
+	}
+	delete(s.shares[noteID], userID)
+	return nil
+}
+
+func (s *Storage) GetNoteShares(ctx context.Context, ownerID, noteID int) ([]models.NoteShare, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := s.checkShareOwner(ownerID, noteID); err != nil {
+		return nil, err
+	}
+	shares := []models.NoteShare{}
+	for _, sh := range s.shares[noteID] {
+		share := *sh
+		share.Username = s.users[sh.UserID].Username
+		shares = append(shares, share)
+	}
+	slices.SortFunc(shares, func(a, b models.NoteShare) int { return strings.Compare(a.Username, b.Username) })
+	return shares, nil
+}
+
+func (s *Storage) GetSharedNotes(ctx context.Context, userID int) ([]models.SharedNote, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	notes := []models.SharedNote{}
+	for noteID, shares := range s.shares {
+		sh, ok := shares[userID]
+		if !ok {
+			continue
+		}
+		n, ok := s.activeNote(noteID)
+		if !ok {
+			continue
+		}
+		notes = append(notes, models.SharedNote{
+			Note:          cloneNote(n),
+			Permission:    sh.Permission,
+			OwnerUsername: s.users[n.UserID].Username,
+		})
+	}
+	slices.SortFunc(notes, func(a, b models.SharedNote) int { return b.UpdatedAt.Compare(a.UpdatedAt) })
+	return notes, nil
+}
+
+// checkShareOwner makes sure only the owner manages the shares of a note:
+// collaborators get storage.ErrForbidden, everybody else storage.ErrNoteNotFound.
+func (s *Storage) checkShareOwner(ownerID, noteID int) error {
+	n, ok := s.activeNote(noteID)
+	if !ok {
+		return storage.ErrNoteNotFound
+	}
+	if n.UserID == ownerID {
+		return nil
+	}
+	if _, shared := s.shares[noteID][ownerID]; shared {
+		return storage.ErrForbidden
+	}
+	return storage.ErrNoteNotFound
+}
+
+// SaveNoteLink stores a public link to a note. Only the hash of the link token is
+// kept; an empty password leaves the link open to anyone holding the token.
+func (s *Storage) SaveNoteLink(ctx context.Context, ownerID, noteID int, tokenHash, password string, expiresAt *time.Time) (int, error) {
+	const op = "storage.memory.SaveNoteLink"
+	var hashedPassword []byte
+	if password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return 0, fmt.Errorf("%s: hash password: %w", op, err)
+		}
+		hashedPassword = hash
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkShareOwner(ownerID, noteID); err != nil {
+		return 0, err
+	}
+	var expires *time.Time
+	if expiresAt != nil {
+		t := expiresAt.UTC().Truncate(time.Microsecond)
+		expires = &t
+	}
+	s.linkSeq++
+	s.links[s.linkSeq] = &link{
+		NoteLink: models.NoteLink{
+			ID:          s.linkSeq,
+			NoteID:      noteID,
+			HasPassword: hashedPassword != nil,
+			ExpiresAt:   expires,
+			CreatedAt:   now(),
+		},
+		tokenHash: tokenHash,
+		password:  hashedPassword,
+	}
+	return s.linkSeq, nil
+}
+
+func (s *Storage) GetNoteLinks(ctx context.Context, ownerID, noteID int) ([]models.NoteLink, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := s.checkShareOwner(ownerID, noteID); err != nil {
+		return nil, err
+	}
+	links := []models.NoteLink{}
+	for _, l := range s.links {
+		if l.NoteID == noteID {
+			links = append(links, l.NoteLink)
+		}
+	}
+	slices.SortFunc(links, func(a, b models.NoteLink) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.ID, a.ID)
+	})
+	return links, nil
+}
+
+func (s *Storage) RevokeNoteLink(ctx context.Context, ownerID, noteID, linkID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkShareOwner(ownerID, noteID); err != nil {
+		return err
+	}
+	l, ok := s.links[linkID]
+	if !ok || l.NoteID != noteID || l.RevokedAt != nil {
+		return storage.ErrLinkNotFound
+	}
+	t := now()
+	l.RevokedAt = &t
+	return nil
+}
+
+// GetPublicNote resolves a public link token, checks its expiry and password
+// and counts the view.
+func (s *Storage) GetPublicNote(ctx context.Context, tokenHash, password string) (*models.PublicNote, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var found *link
+	for _, l := range s.links {
+		if l.tokenHash == tokenHash && l.RevokedAt == nil {
+			found = l
+			break
+		}
+	}
+	if found == nil {
+		return nil, storage.ErrLinkNotFound
+	}
+	n, ok := s.activeNote(found.NoteID)
+	if !ok {
+		return nil, storage.ErrLinkNotFound
+	}
+	if found.ExpiresAt != nil && !found.ExpiresAt.After(time.Now()) {
+		return nil, storage.ErrLinkExpired
+	}
+	if found.password != nil {
+		if password == "" {
+			return nil, storage.ErrLinkPasswordRequired
+		}
+		if err := bcrypt.CompareHashAndPassword(found.password, []byte(password)); err != nil {
+			return nil, storage.ErrInvalidLinkPassword
+		}
+	}
+	found.ViewCount++
+	note := cloneNote(n)
+	return &models.PublicNote{
+		Title:     note.Title,
+		Content:   note.Content,
+		Tags:      note.Tags,
+		UpdatedAt: note.UpdatedAt,
+	}, nil
+}
+
+// SaveRefreshToken stores the first refresh token of a new session (token family).
+func (s *Storage) SaveRefreshToken(ctx context.Context, userID int, sessionID, tokenHash string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens[tokenHash] = &refreshToken{userID: userID, familyID: sessionID, expiresAt: expiresAt}
+	return nil
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one in the same session.
+// Presenting a token that was already exchanged revokes the whole session and
+// returns storage.ErrTokenReused.
+func (s *Storage) RotateRefreshToken(ctx context.Context, oldTokenHash, newTokenHash string, expiresAt time.Time) (*models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rt, ok := s.tokens[oldTokenHash]
+	if !ok {
+		return nil, storage.ErrTokenNotFound
+	}
+	if rt.revokedAt != nil {
+		return nil, storage.ErrTokenRevoked
+	}
+	if rt.usedAt != nil {
+		s.revokeTokens(func(t *refreshToken) bool { return t.familyID == rt.familyID })
+		return nil, storage.ErrTokenReused
+	}
+	if !rt.expiresAt.After(time.Now()) {
+		return nil, storage.ErrTokenExpired
+	}
+	t := now()
+	rt.usedAt = &t
+	s.tokens[newTokenHash] = &refreshToken{userID: rt.userID, familyID: rt.familyID, expiresAt: expiresAt}
+	return &models.Session{
+		ID:       rt.familyID,
+		UserID:   rt.userID,
+		Username: s.users[rt.userID].Username,
+		Role:     s.users[rt.userID].Role,
+	}, nil
+}
+
+// revokeTokens revokes every live refresh token matching the predicate.
+func (s *Storage) revokeTokens(match func(*refreshToken) bool) {
+	t := now()
+	for _, rt := range s.tokens {
+		if rt.revokedAt == nil && match(rt) {
+			revokedAt := t
+			rt.revokedAt = &revokedAt
+		}
+	}
+}
+
+func (s *Storage) RevokeSession(ctx context.Context, userID int, sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revokeTokens(func(t *refreshToken) bool { return t.userID == userID && t.familyID == sessionID })
+	return nil
+}
+
+func (s *Storage) RevokeAllSessions(ctx context.Context, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revokeTokens(func(t *refreshToken) bool { return t.userID == userID })
+	return nil
+}
+
+// IsSessionActive reports whether a session still has refresh tokens that were not revoked.
+func (s *Storage) IsSessionActive(ctx context.Context, sessionID string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, rt := range s.tokens {
+		if rt.familyID == sessionID && rt.revokedAt == nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GetUsers returns the users whose username contains query, in the order
+// they signed up.
+func (s *Storage) GetUsers(ctx context.Context, query string, limit, offset int) ([]models.UserInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	query = strings.ToLower(query)
+	users := []models.UserInfo{}
+	for _, u := range s.users {
+		if strings.Contains(strings.ToLower(u.Username), query) {
+			users = append(users, models.UserInfo{
+				ID:        u.ID,
+				Username:  u.Username,
+				Role:      u.Role,
+				LockedAt:  clonePtr(u.LockedAt),
+				CreatedAt: u.CreatedAt,
+			})
+		}
+	}
+	slices.SortFunc(users, func(a, b models.UserInfo) int { return cmp.Compare(a.ID, b.ID) })
+	offset = min(offset, len(users))
+	return users[offset:min(offset+limit, len(users))], nil
+}
+
+func (s *Storage) SetUserRole(ctx context.Context, userID int, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return storage.ErrUserNotFound
+	}
+	if u.Role == role {
+		return nil
+	}
+	if s.isLastAdmin(u) {
+		return storage.ErrLastAdmin
+	}
+	u.Role = role
+	s.revokeTokens(func(t *refreshToken) bool { return t.userID == userID })
+	return nil
+}
+
+// SetUserLocked locks or unlocks the account of a user. Locked users cannot
+// log in and lose their sessions.
+func (s *Storage) SetUserLocked(ctx context.Context, userID int, locked bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return storage.ErrUserNotFound
+	}
+	if !locked {
+		u.LockedAt = nil
+		return nil
+	}
+	if s.isLastAdmin(u) {
+		return storage.ErrLastAdmin
+	}
+	if u.LockedAt == nil {
+		t := now()
+		u.LockedAt = &t
+	}
+	s.revokeTokens(func(t *refreshToken) bool { return t.userID == userID })
+	return nil
+}
+
+// GetNoteCounts counts the live and trashed notes of a user and the live
+// notes they share with someone.
+func (s *Storage) GetNoteCounts(ctx context.Context, userID int) (*models.NoteCounts, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.users[userID]; !ok {
+		return nil, storage.ErrUserNotFound
+	}
+	counts := models.NoteCounts{UserID: userID}
+	for id, n := range s.notes {
+		switch {
+		case n.UserID != userID:
+		case n.DeletedAt != nil:
+			counts.Trashed++
+		default:
+			counts.Active++
+			if len(s.shares[id]) > 0 {
+				counts.Shared++
+			}
+		}
+	}
+	return &counts, nil
+}
+
+// DeleteUser deletes a user together with everything they own, the way the
+// foreign keys of the database backends cascade.
+func (s *Storage) DeleteUser(ctx context.Context, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return storage.ErrUserNotFound
+	}
+	if s.isLastAdmin(u) {
+		return storage.ErrLastAdmin
+	}
+	for id, n := range s.notes {
+		if n.UserID == userID {
+			s.removeNote(id)
+		}
+	}
+	for id, nb := range s.notebooks {
+		if nb.UserID == userID {
+			delete(s.notebooks, id)
+		}
+	}
+	for _, shares := range s.shares {
+		delete(shares, userID)
+	}
+	for hash, rt := range s.tokens {
+		if rt.userID == userID {
+			delete(s.tokens, hash)
+		}
+	}
+	delete(s.usernames, u.Username)
+	delete(s.users, userID)
+	return nil
+}
+
+// isLastAdmin reports whether u is the only admin who can still log in,
+// that is the only one whose account is not locked. The caller holds s.mu.
+func (s *Storage) isLastAdmin(u *models.User) bool {
+	if u.Role != models.RoleAdmin || u.LockedAt != nil {
+		return false
+	}
+	for _, other := range s.users {
+		if other.ID != u.ID && other.Role == models.RoleAdmin && other.LockedAt == nil {
+			return false
+		}
+	}
+	return true
+}
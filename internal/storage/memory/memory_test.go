@@ -0,0 +1,19 @@
+package memory
+
+import (
+	"notes/internal/storage"
+	"notes/internal/storage/storagetest"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		return New()
+	})
+}
+
+func BenchmarkStore(b *testing.B) {
+	storagetest.Bench(b, func(b *testing.B) storage.Store {
+		return New()
+	})
+}
@@ -1,43 +1,157 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"notes/internal/models"
 	"notes/internal/storage"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/XSAM/otelsql"
 	"github.com/lib/pq"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
 	"golang.org/x/crypto/bcrypt"
 )
 
+var _ storage.Store = (*Storage)(nil)
+
+// Hot queries, run on every login or authenticated request, go through
+// prepared statements.
+const (
+	getUserByUsernameQuery = "SELECT id, username, password, role, locked_at, created_at FROM users WHERE username=$1"
+	getNoteQuery           = "SELECT n.id, n.user_id, n.notebook_id, n.title, n.content, " + noteTagsColumn + ", n.version, n.created_at, n.updated_at FROM notes n WHERE n.id=$1 AND n.deleted_at IS NULL AND (n.user_id=$2 OR EXISTS(SELECT 1 FROM note_shares ns WHERE ns.note_id=n.id AND ns.user_id=$2))"
+	isSessionActiveQuery   = "SELECT EXISTS(SELECT 1 FROM refresh_tokens WHERE family_id=$1 AND revoked_at IS NULL)"
+)
+
 type Storage struct {
-	db *sql.DB
+	db           *sql.DB
+	queryTimeout time.Duration
+
+	// stmts holds the statements of the hot queries once Prepare has run.
+	stmts map[string]*sql.Stmt
 }
 
-func New(StoragePath string) (*Storage, error) {
+func New(StoragePath string, opts storage.Options) (*Storage, error) {
 	const op = "storage.postgres.New"
-	db, err := sql.Open("postgres", StoragePath)
+	// Every query gets a child span of the span carried by its context.
+	db, err := otelsql.Open("postgres", StoragePath,
+		otelsql.WithAttributes(semconv.DBSystemNamePostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{OmitRows: true, OmitConnResetSession: true}),
+	)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
+	setPool(db, opts)
 	if err := db.Ping(); err != nil {
 		return nil, fmt.Errorf("%s: ping: %w", op, err)
 	}
 
 	return &Storage{
-		db: db,
+		db:           db,
+		queryTimeout: opts.QueryTimeout,
 	}, nil
 }
 
-func (s *Storage) SaveUser(username, password string) (int, error) {
+// DB returns the connection pool of the storage, for running migrations.
+func (s *Storage) DB() *sql.DB {
+	return s.db
+}
+
+func (s *Storage) Ping(ctx context.Context) error {
+	const op = "storage.postgres.Ping"
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// withTimeout bounds a storage call by the configured query timeout, on top
+// of whatever deadline the caller's context already has.
+func (s *Storage) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.queryTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, s.queryTimeout)
+}
+
+// hotQueries are the queries Prepare prepares statements for.
+var hotQueries = []string{getUserByUsernameQuery, getNoteQuery, isSessionActiveQuery}
+
+// Prepare prepares the statements of the hot queries. It is called once the
+// schema is migrated and before the storage is shared, so that no request
+// waits on a statement being prepared; until then, and in commands that do
+// not serve requests, hot queries are prepared per call like the others.
+func (s *Storage) Prepare(ctx context.Context) error {
+	const op = "storage.postgres.Prepare"
+	stmts := make(map[string]*sql.Stmt, len(hotQueries))
+	for _, query := range hotQueries {
+		stmt, err := s.db.PrepareContext(ctx, query)
+		if err != nil {
+			closeStmts(stmts)
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		stmts[query] = stmt
+	}
+	closeStmts(s.stmts)
+	s.stmts = stmts
+	return nil
+}
+
+// queryRow runs a hot query through its prepared statement, if Prepare has
+// run.
+func (s *Storage) queryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	if stmt, ok := s.stmts[query]; ok {
+		return stmt.QueryRowContext(ctx, args...)
+	}
+	return s.db.QueryRowContext(ctx, query, args...)
+}
+
+func closeStmts(stmts map[string]*sql.Stmt) {
+	for _, stmt := range stmts {
+		stmt.Close()
+	}
+}
+
+// setPool applies the pool settings; zero values keep the database/sql defaults.
+func setPool(db *sql.DB, opts storage.Options) {
+	if opts.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(opts.MaxOpenConns)
+	}
+	if opts.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(opts.MaxIdleConns)
+	}
+	if opts.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	}
+	if opts.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
+	}
+}
+
+// Close closes the connection pool once in-flight queries are done.
+func (s *Storage) Close() error {
+	const op = "storage.postgres.Close"
+	closeStmts(s.stmts)
+	if err := s.db.Close(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Storage) SaveUser(ctx context.Context, username, password string) (int, error) {
 	const op = "storage.postgres.SaveUser"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return 0, fmt.Errorf("%s: hash password: %w", op, err)
 	}
 	var userID int
-	err = s.db.QueryRow(
+	err = s.db.QueryRowContext(ctx,
 		"INSERT INTO users(username, password) VALUES($1, $2) RETURNING id",
 		username, hashedPassword,
 	).Scan(&userID)
@@ -51,16 +165,13 @@ func (s *Storage) SaveUser(username, password string) (int, error) {
 	return userID, nil
 }
 
-func (s *Storage) GetUserByUsername(username string) (*models.User, error) {
+func (s *Storage) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
 	const op = "storage.postgres.GetUserByUsername"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 
-	stmt, err := s.db.Prepare("SELECT id, username, password, created_at FROM users WHERE username=$1")
-	if err != nil {
-		return nil, fmt.Errorf("%s: prepare statement: %w", op, err)
-	}
-	defer stmt.Close()
 	var u models.User
-	err = stmt.QueryRow(username).Scan(&u.ID, &u.Username, &u.Password, &u.CreatedAt)
+	err := s.queryRow(ctx, getUserByUsernameQuery, username).Scan(&u.ID, &u.Username, &u.Password, &u.Role, &u.LockedAt, &u.CreatedAt)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, storage.ErrUserNotFound
 	}
@@ -70,33 +181,53 @@ func (s *Storage) GetUserByUsername(username string) (*models.User, error) {
 	return &u, nil
 }
 
-func (s *Storage) SaveNote(userID int, title, content string) error {
+func (s *Storage) SaveNote(ctx context.Context, userID int, title, content string, tags []string) error {
 	const op = "storage.postgres.SaveNote"
-	stmt, err := s.db.Prepare("INSERT INTO notes(user_id, title, content) VALUES($1, $2, $3)")
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+		return fmt.Errorf("%s: begin tx: %w", op, err)
 	}
-	res, err := stmt.Exec(userID, title, content)
+	defer tx.Rollback()
+
+	var noteID int
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO notes(user_id, title, content) VALUES($1, $2, $3) RETURNING id",
+		userID, title, content,
+	).Scan(&noteID)
 	if err != nil {
+		return fmt.Errorf("%s: insert note: %w", op, err)
+	}
+	if err := setNoteTags(ctx, tx, userID, noteID, tags); err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
-	_ = res
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: commit: %w", op, err)
+	}
 	return nil
 }
 
-func (s *Storage) GetNote(userID, noteID int) (*models.Note, error) {
+// noteTagsColumn selects the sorted tag names of the note aliased as n.
+const noteTagsColumn = `COALESCE((
+		SELECT array_agg(t.name ORDER BY t.name)
+		FROM note_tags nt JOIN tags t ON t.id = nt.tag_id
+		WHERE nt.note_id = n.id
+	), '{}')`
+
+func (s *Storage) GetNote(ctx context.Context, userID, noteID int) (*models.Note, error) {
 	const op = "storage.postgres.GetNote"
-	stmt, err := s.db.Prepare("SELECT id, user_id, title, content, created_at, updated_at FROM notes WHERE id=$1 AND user_id=$2")
-	if err != nil {
-		return nil, fmt.Errorf("%s: prepare statement: %w", op, err)
-	}
-	defer stmt.Close()
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 	var resNote models.Note
-	err = stmt.QueryRow(noteID, userID).Scan(
+	err := s.queryRow(ctx, getNoteQuery, noteID, userID).Scan(
 		&resNote.ID,
 		&resNote.UserID,
+		&resNote.NotebookID,
 		&resNote.Title,
 		&resNote.Content,
+		pq.Array(&resNote.Tags),
+		&resNote.Version,
 		&resNote.CreatedAt,
 		&resNote.UpdatedAt,
 	)
@@ -109,41 +240,378 @@ func (s *Storage) GetNote(userID, noteID int) (*models.Note, error) {
 	return &resNote, nil
 }
 
-func (s *Storage) GetAllNotes(userID, limit, offset int, sort string) ([]models.Note, error) {
+// sortColumns whitelists the columns a note listing can be ordered by,
+// together with the type their cursor keys are cast to.
+var sortColumns = map[string]struct{ column, cast string }{
+	storage.SortByCreatedAt: {"n.created_at", "timestamptz"},
+	storage.SortByUpdatedAt: {"n.updated_at", "timestamptz"},
+	storage.SortByTitle:     {"n.title", "text"},
+}
+
+// queryBuilder collects WHERE conditions with numbered placeholders, so caller
+// input only ever reaches the database as query parameters.
+type queryBuilder struct {
+	conds []string
+	args  []any
+}
+
+// arg registers a parameter and returns its placeholder.
+func (q *queryBuilder) arg(v any) string {
+	q.args = append(q.args, v)
+	return "$" + strconv.Itoa(len(q.args))
+}
+
+func (q *queryBuilder) where(cond string) {
+	q.conds = append(q.conds, cond)
+}
+
+func (q *queryBuilder) whereClause() string {
+	return strings.Join(q.conds, " AND ")
+}
+
+// likeEscaper escapes LIKE wildcards so a title prefix is matched literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func noteFilterQuery(userID int, filter storage.NoteFilter) *queryBuilder {
+	q := &queryBuilder{}
+	q.where("n.user_id = " + q.arg(userID))
+	q.where("n.deleted_at IS NULL")
+	if filter.NotebookID != nil {
+		q.where("n.notebook_id = " + q.arg(*filter.NotebookID))
+	}
+	if len(filter.Tags) > 0 {
+		tags := q.arg(pq.Array(filter.Tags))
+		if filter.MatchAllTags {
+			q.where(`(
+				SELECT COUNT(*) FROM note_tags nt JOIN tags t ON t.id = nt.tag_id
+				WHERE nt.note_id = n.id AND t.name = ANY(` + tags + `)
+			) = ` + q.arg(len(filter.Tags)))
+		} else {
+			q.where(`EXISTS (
+				SELECT 1 FROM note_tags nt JOIN tags t ON t.id = nt.tag_id
+				WHERE nt.note_id = n.id AND t.name = ANY(` + tags + `)
+			)`)
+		}
+	}
+	if filter.CreatedAfter != nil {
+		q.where("n.created_at > " + q.arg(*filter.CreatedAfter))
+	}
+	if filter.CreatedBefore != nil {
+		q.where("n.created_at < " + q.arg(*filter.CreatedBefore))
+	}
+	if filter.UpdatedSince != nil {
+		q.where("n.updated_at >= " + q.arg(*filter.UpdatedSince))
+	}
+	if filter.TitlePrefix != "" {
+		q.where("n.title ILIKE " + q.arg(likeEscaper.Replace(filter.TitlePrefix)+"%") + ` ESCAPE '\'`)
+	}
+	if filter.HasContent != nil {
+		if *filter.HasContent {
+			q.where("COALESCE(n.content, '') <> ''")
+		} else {
+			q.where("COALESCE(n.content, '') = ''")
+		}
+	}
+	return q
+}
+
+// GetAllNotes returns one keyset-paginated page of the user's notes ordered by
+// (page.SortBy, id).
+func (s *Storage) GetAllNotes(ctx context.Context, userID int, page storage.PageRequest, filter storage.NoteFilter) (*storage.NotePage, error) {
 	const op = "storage.postgres.GetAllNotes"
-	if sort != "asc" && sort != "desc" {
-		sort = "desc"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	// A key that does not fit the sort field would fail its cast below.
+	if page.Cursor != nil && !page.Cursor.Valid() {
+		return nil, storage.ErrInvalidCursor
+	}
+	if page.Sort != storage.SortAsc {
+		page.Sort = storage.SortDesc
+	}
+	sortCol, ok := sortColumns[page.SortBy]
+	if !ok {
+		page.SortBy = storage.SortByCreatedAt
+		sortCol = sortColumns[page.SortBy]
+	}
+	q := noteFilterQuery(userID, filter)
+
+	var total *int
+	if page.WithTotal {
+		var count int
+		err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM notes n WHERE "+q.whereClause(), q.args...).Scan(&count)
+		if err != nil {
+			return nil, fmt.Errorf("%s: count: %w", op, err)
+		}
+		total = &count
+	}
+
+	// Walking backward flips both the keyset comparison and the order;
+	// storage.Paginate restores the listing order afterwards.
+	order := page.Sort
+	if page.Backward() {
+		if order == storage.SortAsc {
+			order = storage.SortDesc
+		} else {
+			order = storage.SortAsc
+		}
+	}
+	if page.Cursor != nil {
+		cmp := "<"
+		if order == storage.SortAsc {
+			cmp = ">"
+		}
+		key := q.arg(page.Cursor.Key) + "::" + sortCol.cast
+		q.where(fmt.Sprintf("(%s, n.id) %s (%s, %s)", sortCol.column, cmp, key, q.arg(page.Cursor.ID)))
 	}
 	query := `
-		SELECT id, user_id, title, content, created_at, updated_at
-		FROM notes
-		WHERE user_id = $1
-		ORDER BY created_at ` + sort + `
-		LIMIT $2 OFFSET $3
-	`
-	rows, err := s.db.Query(query, userID, limit, offset)
+		SELECT n.id, n.user_id, n.notebook_id, n.title, n.content, ` + noteTagsColumn + `, n.version, n.created_at, n.updated_at
+		FROM notes n
+		WHERE ` + q.whereClause() + `
+		ORDER BY ` + sortCol.column + ` ` + order + `, n.id ` + order + `
+		LIMIT ` + q.arg(page.Limit+1)
+	rows, err := s.db.QueryContext(ctx, query, q.args...)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 	defer rows.Close()
-	var notes []models.Note
+	notes := []models.Note{}
 	for rows.Next() {
 		var n models.Note
-		if err := rows.Scan(&n.ID, &n.UserID, &n.Title, &n.Content, &n.CreatedAt, &n.UpdatedAt); err != nil {
+		if err := rows.Scan(&n.ID, &n.UserID, &n.NotebookID, &n.Title, &n.Content, pq.Array(&n.Tags), &n.Version, &n.CreatedAt, &n.UpdatedAt); err != nil {
 			return nil, fmt.Errorf("%s: scan: %w", op, err)
 		}
 		notes = append(notes, n)
 	}
-	if len(notes) == 0 {
-		return nil, storage.ErrNoteNotFound
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: rows: %w", op, err)
 	}
-	return notes, nil
+	res := storage.Paginate(notes, page)
+	res.Total = total
+	return &res, nil
 }
 
-func (s *Storage) UpdateNote(noteID int, userID int, title, content string) error {
+// UpdateNote overwrites a note if it is still at expectedVersion, or
+// unconditionally when expectedVersion is 0. It returns the version of the note
+// after the call: the new one on success, the current one on
+// storage.ErrVersionMismatch.
+func (s *Storage) UpdateNote(ctx context.Context, noteID int, userID int, title, content string, tags []string, expectedVersion int) (int, error) {
 	const op = "storage.postgres.UpdateNote"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	patch := storage.NotePatch{Title: &title, Content: &content, Tags: &tags}
+	return s.writeNote(ctx, op, noteID, userID, patch, expectedVersion)
+}
+
+// PatchNote writes only the fields set in the patch. Versions are handled
+// as in UpdateNote.
+func (s *Storage) PatchNote(ctx context.Context, noteID, userID int, patch storage.NotePatch, expectedVersion int) (int, error) {
+	const op = "storage.postgres.PatchNote"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	return s.writeNote(ctx, op, noteID, userID, patch, expectedVersion)
+}
+
+func (s *Storage) writeNote(ctx context.Context, op string, noteID, userID int, patch storage.NotePatch, expectedVersion int) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: begin tx: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var ownerID, version int
+	err = tx.QueryRowContext(ctx, "SELECT user_id, version FROM notes WHERE id=$1 AND deleted_at IS NULL FOR UPDATE", noteID).Scan(&ownerID, &version)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, storage.ErrNoteNotFound
+		}
+		return 0, fmt.Errorf("%s: query row: %w", op, err)
+	}
+	if ownerID != userID {
+		var canWrite bool
+		err := tx.QueryRowContext(ctx,
+			"SELECT EXISTS(SELECT 1 FROM note_shares WHERE note_id=$1 AND user_id=$2 AND permission=$3)",
+			noteID, userID, models.PermissionWrite,
+		).Scan(&canWrite)
+		if err != nil {
+			return 0, fmt.Errorf("%s: check share: %w", op, err)
+		}
+		if !canWrite {
+			return 0, storage.ErrForbidden
+		}
+	}
+	if expectedVersion != 0 && expectedVersion != version {
+		return version, storage.ErrVersionMismatch
+	}
+
+	set := []string{"version=version+1", "updated_at=NOW()"}
+	var args []any
+	if patch.Title != nil {
+		args = append(args, *patch.Title)
+		set = append(set, fmt.Sprintf("title=$%d", len(args)))
+	}
+	if patch.Content != nil {
+		args = append(args, *patch.Content)
+		set = append(set, fmt.Sprintf("content=$%d", len(args)))
+	}
+	if patch.Title != nil || patch.Content != nil {
+		if err := saveRevision(ctx, tx, noteID); err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	args = append(args, noteID)
+	query := fmt.Sprintf("UPDATE notes SET %s WHERE id=$%d RETURNING version", strings.Join(set, ", "), len(args))
+	if err := tx.QueryRowContext(ctx, query, args...).Scan(&version); err != nil {
+		return 0, fmt.Errorf("%s: exec: %w", op, err)
+	}
+	if patch.Tags != nil {
+		// Tags belong to the note owner even when a collaborator edits the note.
+		if err := setNoteTags(ctx, tx, ownerID, noteID, *patch.Tags); err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: commit: %w", op, err)
+	}
+	return version, nil
+}
+
+// saveRevision stores the current title and content of a note as its next revision.
+// The caller must hold a row lock on the note.
+func saveRevision(ctx context.Context, tx *sql.Tx, noteID int) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO note_revisions(note_id, revision, title, content, created_at)
+		SELECT n.id,
+			COALESCE((SELECT MAX(revision) FROM note_revisions WHERE note_id = n.id), 0) + 1,
+			n.title, COALESCE(n.content, ''), n.updated_at
+		FROM notes n
+		WHERE n.id = $1
+	`, noteID)
+	if err != nil {
+		return fmt.Errorf("save revision: %w", err)
+	}
+	return nil
+}
+
+// setNoteTags replaces the tags of a note, creating missing tags for the user.
+func setNoteTags(ctx context.Context, tx *sql.Tx, userID, noteID int, tags []string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM note_tags WHERE note_id=$1", noteID); err != nil {
+		return fmt.Errorf("clear note tags: %w", err)
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx,
+		"INSERT INTO tags(user_id, name) SELECT $1, unnest($2::text[]) ON CONFLICT (user_id, name) DO NOTHING",
+		userID, pq.Array(tags),
+	)
+	if err != nil {
+		return fmt.Errorf("insert tags: %w", err)
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO note_tags(note_id, tag_id) SELECT $1, id FROM tags WHERE user_id=$2 AND name = ANY($3)",
+		noteID, userID, pq.Array(tags),
+	)
+	if err != nil {
+		return fmt.Errorf("link note tags: %w", err)
+	}
+	return nil
+}
+
+func (s *Storage) GetTags(ctx context.Context, userID int) ([]models.Tag, error) {
+	const op = "storage.postgres.GetTags"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT t.name, COUNT(nt.note_id)
+		FROM tags t
+		JOIN note_tags nt ON nt.tag_id = t.id
+		JOIN notes n ON n.id = nt.note_id AND n.deleted_at IS NULL
+		WHERE t.user_id = $1
+		GROUP BY t.name
+		ORDER BY t.name
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+	tags := []models.Tag{}
+	for rows.Next() {
+		var t models.Tag
+		if err := rows.Scan(&t.Name, &t.NoteCount); err != nil {
+			return nil, fmt.Errorf("%s: scan: %w", op, err)
+		}
+		tags = append(tags, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: rows: %w", op, err)
+	}
+	return tags, nil
+}
+
+func (s *Storage) GetRevisions(ctx context.Context, userID, noteID int) ([]models.Revision, error) {
+	const op = "storage.postgres.GetRevisions"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.checkNoteOwner(ctx, userID, noteID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT note_id, revision, title, content, created_at
+		FROM note_revisions
+		WHERE note_id = $1
+		ORDER BY revision DESC
+	`, noteID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+	revisions := []models.Revision{}
+	for rows.Next() {
+		var rev models.Revision
+		if err := rows.Scan(&rev.NoteID, &rev.Revision, &rev.Title, &rev.Content, &rev.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: scan: %w", op, err)
+		}
+		revisions = append(revisions, rev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: rows: %w", op, err)
+	}
+	return revisions, nil
+}
+
+func (s *Storage) GetRevision(ctx context.Context, userID, noteID, revision int) (*models.Revision, error) {
+	const op = "storage.postgres.GetRevision"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.checkNoteOwner(ctx, userID, noteID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	var rev models.Revision
+	err := s.db.QueryRowContext(ctx,
+		"SELECT note_id, revision, title, content, created_at FROM note_revisions WHERE note_id=$1 AND revision=$2",
+		noteID, revision,
+	).Scan(&rev.NoteID, &rev.Revision, &rev.Title, &rev.Content, &rev.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrRevisionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: query row: %w", op, err)
+	}
+	return &rev, nil
+}
+
+func (s *Storage) RestoreRevision(ctx context.Context, userID, noteID, revision int) error {
+	const op = "storage.postgres.RestoreRevision"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: begin tx: %w", op, err)
+	}
+	defer tx.Rollback()
+
 	var ownerID int
-	err := s.db.QueryRow("SELECT user_id FROM notes WHERE id=$1", noteID).Scan(&ownerID)
+	err = tx.QueryRowContext(ctx, "SELECT user_id FROM notes WHERE id=$1 AND deleted_at IS NULL FOR UPDATE", noteID).Scan(&ownerID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return storage.ErrNoteNotFound
@@ -153,22 +621,89 @@ func (s *Storage) UpdateNote(noteID int, userID int, title, content string) erro
 	if ownerID != userID {
 		return storage.ErrForbidden
 	}
-	stmt, err := s.db.Prepare("UPDATE notes SET title=$1, content=$2, updated_at=NOW() WHERE id=$3")
+	var title, content string
+	err = tx.QueryRowContext(ctx,
+		"SELECT title, content FROM note_revisions WHERE note_id=$1 AND revision=$2",
+		noteID, revision,
+	).Scan(&title, &content)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.ErrRevisionNotFound
+	}
 	if err != nil {
-		return fmt.Errorf("%s: prepare statement: %w", op, err)
+		return fmt.Errorf("%s: query revision: %w", op, err)
 	}
-	res, err := stmt.Exec(title, content, noteID)
+	if err := saveRevision(ctx, tx, noteID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE notes SET title=$1, content=$2, version=version+1, updated_at=NOW() WHERE id=$3", title, content, noteID)
 	if err != nil {
 		return fmt.Errorf("%s: exec: %w", op, err)
 	}
-	_ = res
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: commit: %w", op, err)
+	}
+	return nil
+}
+
+// checkNoteOwner returns storage.ErrNoteNotFound unless the note belongs to the user.
+func (s *Storage) checkNoteOwner(ctx context.Context, userID, noteID int) error {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM notes WHERE id=$1 AND user_id=$2 AND deleted_at IS NULL)", noteID, userID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("check note owner: %w", err)
+	}
+	if !exists {
+		return storage.ErrNoteNotFound
+	}
 	return nil
 }
 
-func (s *Storage) DeleteNote(noteID, userID int) error {
+func (s *Storage) SearchNotes(ctx context.Context, userID int, query string, limit, offset int) ([]models.SearchResult, error) {
+	const op = "storage.postgres.SearchNotes"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT n.id, n.user_id, n.notebook_id, n.title, n.content, `+noteTagsColumn+`, n.version, n.created_at, n.updated_at,
+			ts_rank(n.search_vector, q) AS rank,
+			ts_headline('simple', n.title, q, $5 || ', HighlightAll=true'),
+			ts_headline('simple', coalesce(n.content, ''), q, $5 || ', MaxFragments=2, MaxWords=30, MinWords=10')
+		FROM notes n, websearch_to_tsquery('simple', $2) q
+		WHERE n.user_id = $1 AND n.deleted_at IS NULL AND n.search_vector @@ q
+		ORDER BY rank DESC, n.created_at DESC
+		LIMIT $3 OFFSET $4
+	`, userID, query, limit, offset, `StartSel="`+storage.MatchStart+`", StopSel="`+storage.MatchStop+`"`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+	results := []models.SearchResult{}
+	for rows.Next() {
+		var res models.SearchResult
+		err := rows.Scan(
+			&res.ID, &res.UserID, &res.NotebookID, &res.Title, &res.Content, pq.Array(&res.Tags), &res.Version, &res.CreatedAt, &res.UpdatedAt,
+			&res.Rank, &res.TitleHighlight, &res.Snippet,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: scan: %w", op, err)
+		}
+		res.TitleHighlight = storage.MarkMatches(res.TitleHighlight)
+		res.Snippet = storage.MarkMatches(res.Snippet)
+		results = append(results, res)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: rows: %w", op, err)
+	}
+	return results, nil
+}
+
+// DeleteNote moves the note to the trash. Trashed notes are hidden from every
+// other query until restored or purged.
+func (s *Storage) DeleteNote(ctx context.Context, noteID, userID int) error {
 	const op = "storage.postgres.DeleteNote"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 	var ownerID int
-	err := s.db.QueryRow("SELECT user_id FROM notes WHERE id=$1", noteID).Scan(&ownerID)
+	err := s.db.QueryRowContext(ctx, "SELECT user_id FROM notes WHERE id=$1 AND deleted_at IS NULL", noteID).Scan(&ownerID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return storage.ErrNoteNotFound
@@ -178,9 +713,900 @@ func (s *Storage) DeleteNote(noteID, userID int) error {
 	if ownerID != userID {
 		return storage.ErrForbidden
 	}
-	_, err = s.db.Exec("DELETE FROM notes WHERE id=$1", noteID)
+	_, err = s.db.ExecContext(ctx, "UPDATE notes SET deleted_at=NOW() WHERE id=$1", noteID)
+	if err != nil {
+		return fmt.Errorf("%s: trash exec: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Storage) GetTrash(ctx context.Context, userID int) ([]models.Note, error) {
+	const op = "storage.postgres.GetTrash"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT n.id, n.user_id, n.notebook_id, n.title, n.content, `+noteTagsColumn+`, n.version, n.created_at, n.updated_at, n.deleted_at
+		FROM notes n
+		WHERE n.user_id = $1 AND n.deleted_at IS NOT NULL
+		ORDER BY n.deleted_at DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+	notes := []models.Note{}
+	for rows.Next() {
+		var n models.Note
+		if err := rows.Scan(&n.ID, &n.UserID, &n.NotebookID, &n.Title, &n.Content, pq.Array(&n.Tags), &n.Version, &n.CreatedAt, &n.UpdatedAt, &n.DeletedAt); err != nil {
+			return nil, fmt.Errorf("%s: scan: %w", op, err)
+		}
+		notes = append(notes, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: rows: %w", op, err)
+	}
+	return notes, nil
+}
+
+func (s *Storage) RestoreNote(ctx context.Context, userID, noteID int) error {
+	const op = "storage.postgres.RestoreNote"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE notes SET deleted_at=NULL WHERE id=$1 AND user_id=$2 AND deleted_at IS NOT NULL",
+		noteID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: exec: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: rows affected: %w", op, err)
+	}
+	if n == 0 {
+		return storage.ErrNoteNotFound
+	}
+	return nil
+}
+
+// PurgeNote permanently removes a note that is already in the trash.
+func (s *Storage) PurgeNote(ctx context.Context, userID, noteID int) error {
+	const op = "storage.postgres.PurgeNote"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx,
+		"DELETE FROM notes WHERE id=$1 AND user_id=$2 AND deleted_at IS NOT NULL",
+		noteID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: exec: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: rows affected: %w", op, err)
+	}
+	if n == 0 {
+		return storage.ErrNoteNotFound
+	}
+	return nil
+}
+
+// PurgeTrash permanently removes every note trashed before the given time.
+func (s *Storage) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	const op = "storage.postgres.PurgeTrash"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, "DELETE FROM notes WHERE deleted_at IS NOT NULL AND deleted_at < $1", before)
+	if err != nil {
+		return 0, fmt.Errorf("%s: exec: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: rows affected: %w", op, err)
+	}
+	return n, nil
+}
+
+func (s *Storage) SaveNotebook(ctx context.Context, userID int, name string, parentID *int) (int, error) {
+	const op = "storage.postgres.SaveNotebook"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if parentID != nil {
+		if err := s.checkNotebookOwner(ctx, s.db, userID, *parentID); err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	var notebookID int
+	err := s.db.QueryRowContext(ctx,
+		"INSERT INTO notebooks(user_id, parent_id, name) VALUES($1, $2, $3) RETURNING id",
+		userID, parentID, name,
+	).Scan(&notebookID)
+	if err != nil {
+		return 0, fmt.Errorf("%s: insert notebook: %w", op, err)
+	}
+	return notebookID, nil
+}
+
+func (s *Storage) GetNotebooks(ctx context.Context, userID int) ([]models.Notebook, error) {
+	const op = "storage.postgres.GetNotebooks"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, user_id, parent_id, name, created_at, updated_at
+		FROM notebooks
+		WHERE user_id = $1
+		ORDER BY name, id
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+	notebooks := []models.Notebook{}
+	for rows.Next() {
+		var nb models.Notebook
+		if err := rows.Scan(&nb.ID, &nb.UserID, &nb.ParentID, &nb.Name, &nb.CreatedAt, &nb.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("%s: scan: %w", op, err)
+		}
+		notebooks = append(notebooks, nb)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: rows: %w", op, err)
+	}
+	return notebooks, nil
+}
+
+func (s *Storage) GetNotebook(ctx context.Context, userID, notebookID int) (*models.Notebook, error) {
+	const op = "storage.postgres.GetNotebook"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	var nb models.Notebook
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id, user_id, parent_id, name, created_at, updated_at FROM notebooks WHERE id=$1 AND user_id=$2",
+		notebookID, userID,
+	).Scan(&nb.ID, &nb.UserID, &nb.ParentID, &nb.Name, &nb.CreatedAt, &nb.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrNotebookNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: query row: %w", op, err)
+	}
+	return &nb, nil
+}
+
+func (s *Storage) UpdateNotebook(ctx context.Context, userID, notebookID int, name string, parentID *int) error {
+	const op = "storage.postgres.UpdateNotebook"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("%s: delete exec: %w", op, err)
+		return fmt.Errorf("%s: begin tx: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if err := s.checkNotebookOwner(ctx, tx, userID, notebookID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if parentID != nil {
+		if err := s.checkNotebookOwner(ctx, tx, userID, *parentID); err != nil {
+			return fmt.Errorf("%s: parent: %w", op, err)
+		}
+		var cycle bool
+		err := tx.QueryRowContext(ctx, `
+			WITH RECURSIVE subtree AS (
+				SELECT id FROM notebooks WHERE id = $1
+				UNION ALL
+				SELECT nb.id FROM notebooks nb JOIN subtree st ON nb.parent_id = st.id
+			)
+			SELECT EXISTS(SELECT 1 FROM subtree WHERE id = $2)
+		`, notebookID, *parentID).Scan(&cycle)
+		if err != nil {
+			return fmt.Errorf("%s: check cycle: %w", op, err)
+		}
+		if cycle {
+			return storage.ErrNotebookCycle
+		}
+	}
+	_, err = tx.ExecContext(ctx,
+		"UPDATE notebooks SET name=$1, parent_id=$2, updated_at=NOW() WHERE id=$3",
+		name, parentID, notebookID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: exec: %w", op, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: commit: %w", op, err)
+	}
+	return nil
+}
+
+// DeleteNotebook removes a notebook. With recursive set, nested notebooks are
+// removed as well and all their notes go to the trash; otherwise the notes and
+// child notebooks of the removed notebook are moved to the root.
+func (s *Storage) DeleteNotebook(ctx context.Context, userID, notebookID int, recursive bool) error {
+	const op = "storage.postgres.DeleteNotebook"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: begin tx: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if err := s.checkNotebookOwner(ctx, tx, userID, notebookID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if recursive {
+		_, err = tx.ExecContext(ctx, `
+			WITH RECURSIVE subtree AS (
+				SELECT id FROM notebooks WHERE id = $1
+				UNION ALL
+				SELECT nb.id FROM notebooks nb JOIN subtree st ON nb.parent_id = st.id
+			)
+			UPDATE notes SET deleted_at = NOW()
+			WHERE notebook_id IN (SELECT id FROM subtree) AND deleted_at IS NULL
+		`, notebookID)
+		if err != nil {
+			return fmt.Errorf("%s: trash notes: %w", op, err)
+		}
+	} else {
+		if _, err := tx.ExecContext(ctx, "UPDATE notes SET notebook_id=NULL WHERE notebook_id=$1", notebookID); err != nil {
+			return fmt.Errorf("%s: move notes: %w", op, err)
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE notebooks SET parent_id=NULL WHERE parent_id=$1", notebookID); err != nil {
+			return fmt.Errorf("%s: move notebooks: %w", op, err)
+		}
+	}
+	// Nested notebooks go through ON DELETE CASCADE, notes left in them through ON DELETE SET NULL.
+	if _, err := tx.ExecContext(ctx, "DELETE FROM notebooks WHERE id=$1", notebookID); err != nil {
+		return fmt.Errorf("%s: delete notebook: %w", op, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: commit: %w", op, err)
+	}
+	return nil
+}
+
+// MoveNote puts a note into a notebook, or into the root when notebookID is nil.
+func (s *Storage) MoveNote(ctx context.Context, userID, noteID int, notebookID *int) error {
+	const op = "storage.postgres.MoveNote"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if notebookID != nil {
+		if err := s.checkNotebookOwner(ctx, s.db, userID, *notebookID); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE notes SET notebook_id=$1, version=version+1 WHERE id=$2 AND user_id=$3 AND deleted_at IS NULL",
+		notebookID, noteID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: exec: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: rows affected: %w", op, err)
+	}
+	if n == 0 {
+		return storage.ErrNoteNotFound
+	}
+	return nil
+}
+
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// checkNotebookOwner returns storage.ErrNotebookNotFound unless the notebook belongs to the user.
+func (s *Storage) checkNotebookOwner(ctx context.Context, q queryRower, userID, notebookID int) error {
+	var exists bool
+	err := q.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM notebooks WHERE id=$1 AND user_id=$2)", notebookID, userID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("check notebook owner: %w", err)
+	}
+	if !exists {
+		return storage.ErrNotebookNotFound
+	}
+	return nil
+}
+
+// ShareNote grants another user read or write access to a note. Sharing an
+// already shared note again replaces the permission.
+func (s *Storage) ShareNote(ctx context.Context, ownerID, noteID int, username, permission string) error {
+	const op = "storage.postgres.ShareNote"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.checkShareOwner(ctx, ownerID, noteID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	var targetID int
+	err := s.db.QueryRowContext(ctx, "SELECT id FROM users WHERE username=$1", username).Scan(&targetID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("%s: query user: %w", op, err)
+	}
+	if targetID == ownerID {
+		return storage.ErrShareWithOwner
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO note_shares(note_id, user_id, permission) VALUES($1, $2, $3)
+		ON CONFLICT (note_id, user_id) DO UPDATE SET permission = EXCLUDED.permission
+	`, noteID, targetID, permission)
+	if err != nil {
+		return fmt.Errorf("%s: insert share: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Storage) UnshareNote(ctx context.Context, ownerID, noteID, userID int) error {
+	const op = "storage.postgres.UnshareNote"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.checkShareOwner(ctx, ownerID, noteID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	res, err := s.db.ExecContext(ctx, "DELETE FROM note_shares WHERE note_id=$1 AND user_id=$2", noteID, userID)
+	if err != nil {
+		return fmt.Errorf("%s: exec: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: rows affected: %w", op, err)
+	}
+	if n == 0 {
+		return storage.ErrShareNotFound
+	}
+	return nil
+}
+
+func (s *Storage) GetNoteShares(ctx context.Context, ownerID, noteID int) ([]models.NoteShare, error) {
+	const op = "storage.postgres.GetNoteShares"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.checkShareOwner(ctx, ownerID, noteID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT ns.note_id, ns.user_id, u.username, ns.permission, ns.created_at
+		FROM note_shares ns
+		JOIN users u ON u.id = ns.user_id
+		WHERE ns.note_id = $1
+		ORDER BY u.username
+	`, noteID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+	shares := []models.NoteShare{}
+	for rows.Next() {
+		var sh models.NoteShare
+		if err := rows.Scan(&sh.NoteID, &sh.UserID, &sh.Username, &sh.Permission, &sh.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: scan: %w", op, err)
+		}
+		shares = append(shares, sh)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: rows: %w", op, err)
+	}
+	return shares, nil
+}
+
+func (s *Storage) GetSharedNotes(ctx context.Context, userID int) ([]models.SharedNote, error) {
+	const op = "storage.postgres.GetSharedNotes"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT n.id, n.user_id, n.notebook_id, n.title, n.content, `+noteTagsColumn+`, n.version, n.created_at, n.updated_at,
+			ns.permission, u.username
+		FROM note_shares ns
+		JOIN notes n ON n.id = ns.note_id AND n.deleted_at IS NULL
+		JOIN users u ON u.id = n.user_id
+		WHERE ns.user_id = $1
+		ORDER BY n.updated_at DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+	notes := []models.SharedNote{}
+	for rows.Next() {
+		var n models.SharedNote
+		err := rows.Scan(
+			&n.ID, &n.UserID, &n.NotebookID, &n.Title, &n.Content, pq.Array(&n.Tags), &n.Version, &n.CreatedAt, &n.UpdatedAt,
+			&n.Permission, &n.OwnerUsername,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: scan: %w", op, err)
+		}
+		notes = append(notes, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: rows: %w", op, err)
+	}
+	return notes, nil
+}
+
+// checkShareOwner makes sure only the owner manages the shares of a note:
+// collaborators get storage.ErrForbidden, everybody else storage.ErrNoteNotFound.
+func (s *Storage) checkShareOwner(ctx context.Context, ownerID, noteID int) error {
+	var noteOwnerID int
+	err := s.db.QueryRowContext(ctx, "SELECT user_id FROM notes WHERE id=$1 AND deleted_at IS NULL", noteID).Scan(&noteOwnerID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.ErrNoteNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("check note owner: %w", err)
+	}
+	if noteOwnerID == ownerID {
+		return nil
+	}
+	var shared bool
+	err = s.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM note_shares WHERE note_id=$1 AND user_id=$2)", noteID, ownerID).Scan(&shared)
+	if err != nil {
+		return fmt.Errorf("check note share: %w", err)
+	}
+	if shared {
+		return storage.ErrForbidden
+	}
+	return storage.ErrNoteNotFound
+}
+
+// SaveNoteLink stores a public link to a note. Only the hash of the link token is
+// kept; an empty password leaves the link open to anyone holding the token.
+func (s *Storage) SaveNoteLink(ctx context.Context, ownerID, noteID int, tokenHash, password string, expiresAt *time.Time) (int, error) {
+	const op = "storage.postgres.SaveNoteLink"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.checkShareOwner(ctx, ownerID, noteID); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	var hashedPassword *string
+	if password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return 0, fmt.Errorf("%s: hash password: %w", op, err)
+		}
+		h := string(hash)
+		hashedPassword = &h
+	}
+	var linkID int
+	err := s.db.QueryRowContext(ctx,
+		"INSERT INTO note_links(note_id, token_hash, password, expires_at) VALUES($1, $2, $3, $4) RETURNING id",
+		noteID, tokenHash, hashedPassword, expiresAt,
+	).Scan(&linkID)
+	if err != nil {
+		return 0, fmt.Errorf("%s: insert link: %w", op, err)
+	}
+	return linkID, nil
+}
+
+func (s *Storage) GetNoteLinks(ctx context.Context, ownerID, noteID int) ([]models.NoteLink, error) {
+	const op = "storage.postgres.GetNoteLinks"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.checkShareOwner(ctx, ownerID, noteID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, note_id, password IS NOT NULL, expires_at, view_count, revoked_at, created_at
+		FROM note_links
+		WHERE note_id = $1
+		ORDER BY created_at DESC
+	`, noteID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+	links := []models.NoteLink{}
+	for rows.Next() {
+		var l models.NoteLink
+		if err := rows.Scan(&l.ID, &l.NoteID, &l.HasPassword, &l.ExpiresAt, &l.ViewCount, &l.RevokedAt, &l.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: scan: %w", op, err)
+		}
+		links = append(links, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: rows: %w", op, err)
+	}
+	return links, nil
+}
+
+func (s *Storage) RevokeNoteLink(ctx context.Context, ownerID, noteID, linkID int) error {
+	const op = "storage.postgres.RevokeNoteLink"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.checkShareOwner(ctx, ownerID, noteID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE note_links SET revoked_at=NOW() WHERE id=$1 AND note_id=$2 AND revoked_at IS NULL",
+		linkID, noteID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: exec: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: rows affected: %w", op, err)
+	}
+	if n == 0 {
+		return storage.ErrLinkNotFound
+	}
+	return nil
+}
+
+// GetPublicNote resolves a public link token, checks its expiry and password
+// and counts the view.
+func (s *Storage) GetPublicNote(ctx context.Context, tokenHash, password string) (*models.PublicNote, error) {
+	const op = "storage.postgres.GetPublicNote"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	var (
+		linkID         int
+		hashedPassword sql.NullString
+		expiresAt      sql.NullTime
+		note           models.PublicNote
+	)
+	err := s.db.QueryRowContext(ctx, `
+		SELECT l.id, l.password, l.expires_at, n.title, n.content, `+noteTagsColumn+`, n.updated_at
+		FROM note_links l
+		JOIN notes n ON n.id = l.note_id AND n.deleted_at IS NULL
+		WHERE l.token_hash = $1 AND l.revoked_at IS NULL
+	`, tokenHash).Scan(&linkID, &hashedPassword, &expiresAt, &note.Title, &note.Content, pq.Array(&note.Tags), &note.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrLinkNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: query row: %w", op, err)
+	}
+	if expiresAt.Valid && !expiresAt.Time.After(time.Now()) {
+		return nil, storage.ErrLinkExpired
+	}
+	if hashedPassword.Valid {
+		if password == "" {
+			return nil, storage.ErrLinkPasswordRequired
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword.String), []byte(password)); err != nil {
+			return nil, storage.ErrInvalidLinkPassword
+		}
+	}
+	if _, err := s.db.ExecContext(ctx, "UPDATE note_links SET view_count = view_count + 1 WHERE id=$1", linkID); err != nil {
+		return nil, fmt.Errorf("%s: count view: %w", op, err)
+	}
+	return &note, nil
+}
+
+// SaveRefreshToken stores the first refresh token of a new session (token family).
+func (s *Storage) SaveRefreshToken(ctx context.Context, userID int, sessionID, tokenHash string, expiresAt time.Time) error {
+	const op = "storage.postgres.SaveRefreshToken"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO refresh_tokens(user_id, family_id, token_hash, expires_at) VALUES($1, $2, $3, $4)",
+		userID, sessionID, tokenHash, expiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: insert token: %w", op, err)
+	}
+	return nil
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one in the same session.
+// Presenting a token that was already exchanged revokes the whole session and
+// returns storage.ErrTokenReused.
+func (s *Storage) RotateRefreshToken(ctx context.Context, oldTokenHash, newTokenHash string, expiresAt time.Time) (*models.Session, error) {
+	const op = "storage.postgres.RotateRefreshToken"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: begin tx: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var (
+		tokenID   int
+		sess      models.Session
+		expiresOn time.Time
+		usedAt    sql.NullTime
+		revokedAt sql.NullTime
+	)
+	err = tx.QueryRowContext(ctx, `
+		SELECT rt.id, rt.family_id, rt.user_id, u.username, u.role, rt.expires_at, rt.used_at, rt.revoked_at
+		FROM refresh_tokens rt
+		JOIN users u ON u.id = rt.user_id
+		WHERE rt.token_hash = $1
+		FOR UPDATE OF rt
+	`, oldTokenHash).Scan(&tokenID, &sess.ID, &sess.UserID, &sess.Username, &sess.Role, &expiresOn, &usedAt, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: query row: %w", op, err)
+	}
+	if revokedAt.Valid {
+		return nil, storage.ErrTokenRevoked
+	}
+	if usedAt.Valid {
+		if _, err := tx.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at=NOW() WHERE family_id=$1 AND revoked_at IS NULL", sess.ID); err != nil {
+			return nil, fmt.Errorf("%s: revoke family: %w", op, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("%s: commit: %w", op, err)
+		}
+		return nil, storage.ErrTokenReused
+	}
+	if !expiresOn.After(time.Now()) {
+		return nil, storage.ErrTokenExpired
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE refresh_tokens SET used_at=NOW() WHERE id=$1", tokenID); err != nil {
+		return nil, fmt.Errorf("%s: mark used: %w", op, err)
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO refresh_tokens(user_id, family_id, token_hash, expires_at) VALUES($1, $2, $3, $4)",
+		sess.UserID, sess.ID, newTokenHash, expiresAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: insert token: %w", op, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: commit: %w", op, err)
+	}
+	return &sess, nil
+}
+
+func (s *Storage) RevokeSession(ctx context.Context, userID int, sessionID string) error {
+	const op = "storage.postgres.RevokeSession"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE refresh_tokens SET revoked_at=NOW() WHERE user_id=$1 AND family_id=$2 AND revoked_at IS NULL",
+		userID, sessionID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: exec: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Storage) RevokeAllSessions(ctx context.Context, userID int) error {
+	const op = "storage.postgres.RevokeAllSessions"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at=NOW() WHERE user_id=$1 AND revoked_at IS NULL", userID)
+	if err != nil {
+		return fmt.Errorf("%s: exec: %w", op, err)
+	}
+	return nil
+}
+
+// IsSessionActive reports whether a session still has refresh tokens that were not revoked.
+func (s *Storage) IsSessionActive(ctx context.Context, sessionID string) (bool, error) {
+	const op = "storage.postgres.IsSessionActive"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	var active bool
+	err := s.queryRow(ctx, isSessionActiveQuery, sessionID).Scan(&active)
+	if err != nil {
+		return false, fmt.Errorf("%s: query row: %w", op, err)
+	}
+	return active, nil
+}
+
+// GetUsers returns the users whose username contains query, in the order
+// they signed up.
+func (s *Storage) GetUsers(ctx context.Context, query string, limit, offset int) ([]models.UserInfo, error) {
+	const op = "storage.postgres.GetUsers"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, username, role, locked_at, created_at
+		FROM users
+		WHERE username ILIKE $1 ESCAPE '\'
+		ORDER BY id
+		LIMIT $2 OFFSET $3
+	`, "%"+likeEscaper.Replace(query)+"%", limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+	users := []models.UserInfo{}
+	for rows.Next() {
+		var u models.UserInfo
+		if err := rows.Scan(&u.ID, &u.Username, &u.Role, &u.LockedAt, &u.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: scan: %w", op, err)
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: rows: %w", op, err)
+	}
+	return users, nil
+}
+
+func (s *Storage) SetUserRole(ctx context.Context, userID int, role string) error {
+	const op = "storage.postgres.SetUserRole"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: begin tx: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if err := lockAdmins(ctx, tx); err != nil {
+		return fmt.Errorf("%s: lock admins: %w", op, err)
+	}
+	var current string
+	err = tx.QueryRowContext(ctx, "SELECT role FROM users WHERE id=$1 FOR UPDATE", userID).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("%s: query row: %w", op, err)
+	}
+	if current == role {
+		return nil
+	}
+	last, err := isLastAdmin(ctx, tx, userID)
+	if err != nil {
+		return fmt.Errorf("%s: count admins: %w", op, err)
+	}
+	if last {
+		return storage.ErrLastAdmin
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET role=$1 WHERE id=$2", role, userID); err != nil {
+		return fmt.Errorf("%s: update role: %w", op, err)
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at=NOW() WHERE user_id=$1 AND revoked_at IS NULL", userID); err != nil {
+		return fmt.Errorf("%s: revoke sessions: %w", op, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: commit: %w", op, err)
+	}
+	return nil
+}
+
+// adminsLockKey is the key of the advisory lock taken by lockAdmins. It is
+// arbitrary but must not be used for any other lock.
+const adminsLockKey = 7301
+
+// lockAdmins serializes the transactions that may take the admin role away
+// from a user until tx ends, so that two admins demoting or deleting each
+// other at the same time cannot both count the other one as the admin left.
+func lockAdmins(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", adminsLockKey)
+	return err
+}
+
+// isLastAdmin reports whether the user is the only admin who can still log
+// in, that is the only one whose account is not locked. Callers take
+// lockAdmins first.
+func isLastAdmin(ctx context.Context, tx *sql.Tx, userID int) (bool, error) {
+	var last bool
+	err := tx.QueryRowContext(ctx, `
+		SELECT u.role = $1 AND u.locked_at IS NULL AND NOT EXISTS (
+			SELECT 1 FROM users o WHERE o.id <> u.id AND o.role = $1 AND o.locked_at IS NULL
+		)
+		FROM users u WHERE u.id = $2`,
+		models.RoleAdmin, userID,
+	).Scan(&last)
+	return last, err
+}
+
+// SetUserLocked locks or unlocks the account of a user. Locked users cannot
+// log in and lose their sessions.
+func (s *Storage) SetUserLocked(ctx context.Context, userID int, locked bool) error {
+	const op = "storage.postgres.SetUserLocked"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: begin tx: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if locked {
+		if err := lockAdmins(ctx, tx); err != nil {
+			return fmt.Errorf("%s: lock admins: %w", op, err)
+		}
+		last, err := isLastAdmin(ctx, tx, userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.ErrUserNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("%s: count admins: %w", op, err)
+		}
+		if last {
+			return storage.ErrLastAdmin
+		}
+	}
+	res, err := tx.ExecContext(ctx,
+		"UPDATE users SET locked_at = CASE WHEN $1 THEN COALESCE(locked_at, NOW()) END WHERE id=$2",
+		locked, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: update user: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: rows affected: %w", op, err)
+	}
+	if n == 0 {
+		return storage.ErrUserNotFound
+	}
+	if locked {
+		if _, err := tx.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at=NOW() WHERE user_id=$1 AND revoked_at IS NULL", userID); err != nil {
+			return fmt.Errorf("%s: revoke sessions: %w", op, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: commit: %w", op, err)
+	}
+	return nil
+}
+
+// GetNoteCounts counts the live and trashed notes of a user and the live
+// notes they share with someone.
+func (s *Storage) GetNoteCounts(ctx context.Context, userID int) (*models.NoteCounts, error) {
+	const op = "storage.postgres.GetNoteCounts"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	counts := models.NoteCounts{UserID: userID}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM notes WHERE user_id = u.id AND deleted_at IS NULL),
+			(SELECT COUNT(*) FROM notes WHERE user_id = u.id AND deleted_at IS NOT NULL),
+			(SELECT COUNT(DISTINCT ns.note_id) FROM note_shares ns JOIN notes n ON n.id = ns.note_id
+				WHERE n.user_id = u.id AND n.deleted_at IS NULL)
+		FROM users u
+		WHERE u.id = $1
+	`, userID).Scan(&counts.Active, &counts.Trashed, &counts.Shared)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: query row: %w", op, err)
+	}
+	return &counts, nil
+}
+
+// DeleteUser deletes a user; the foreign keys cascade to everything they own.
+func (s *Storage) DeleteUser(ctx context.Context, userID int) error {
+	const op = "storage.postgres.DeleteUser"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: begin tx: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if err := lockAdmins(ctx, tx); err != nil {
+		return fmt.Errorf("%s: lock admins: %w", op, err)
+	}
+	var role string
+	err = tx.QueryRowContext(ctx, "SELECT role FROM users WHERE id=$1", userID).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("%s: query row: %w", op, err)
+	}
+	last, err := isLastAdmin(ctx, tx, userID)
+	if err != nil {
+		return fmt.Errorf("%s: count admins: %w", op, err)
+	}
+	if last {
+		return storage.ErrLastAdmin
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM users WHERE id=$1", userID); err != nil {
+		return fmt.Errorf("%s: delete user: %w", op, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: commit: %w", op, err)
 	}
 	return nil
 }
@@ -0,0 +1,49 @@
+package postgres
+
+import (
+	"fmt"
+	"notes/internal/storage"
+	"notes/internal/storage/storagetest"
+	"os"
+	"testing"
+)
+
+// The suite runs against a migrated database named by NOTES_TEST_POSTGRES_DSN.
+// Every test starts from empty tables, so never point it at real data.
+func newTestStore(t testing.TB, opts storage.Options) *Storage {
+	t.Helper()
+	dsn := os.Getenv("NOTES_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("NOTES_TEST_POSTGRES_DSN is not set")
+	}
+	s, err := New(dsn, opts)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	_, err = s.db.Exec("TRUNCATE users, notes, tags, note_tags, note_revisions, notebooks, note_shares, note_links, refresh_tokens RESTART IDENTITY CASCADE")
+	if err != nil {
+		t.Fatalf("truncate: %v", err)
+	}
+	return s
+}
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		s := newTestStore(t, storage.Options{})
+		if err := s.Prepare(t.Context()); err != nil {
+			t.Fatalf("prepare: %v", err)
+		}
+		return s
+	})
+}
+
+func BenchmarkStore(b *testing.B) {
+	for _, conns := range []int{4, 16, 64} {
+		b.Run(fmt.Sprintf("conns=%d", conns), func(b *testing.B) {
+			storagetest.Bench(b, func(b *testing.B) storage.Store {
+				return newTestStore(b, storage.Options{MaxOpenConns: conns, MaxIdleConns: conns})
+			})
+		})
+	}
+}
@@ -0,0 +1,1680 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"notes/internal/models"
+	"notes/internal/storage"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/XSAM/otelsql"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"golang.org/x/crypto/bcrypt"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+var _ storage.Store = (*Storage)(nil)
+
+// Hot queries, run on every login or authenticated request, go through
+// prepared statements.
+const (
+	getUserByUsernameQuery = "SELECT id, username, password, role, locked_at, created_at FROM users WHERE username=?"
+	getNoteQuery           = "SELECT " + noteColumns + " FROM notes n WHERE n.id=?1 AND n.deleted_at IS NULL AND (n.user_id=?2 OR EXISTS(SELECT 1 FROM note_shares ns WHERE ns.note_id=n.id AND ns.user_id=?2))"
+	isSessionActiveQuery   = "SELECT EXISTS(SELECT 1 FROM refresh_tokens WHERE family_id=? AND revoked_at IS NULL)"
+)
+
+type Storage struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+
+	// stmts holds the statements of the hot queries once Prepare has run.
+	stmts map[string]*sql.Stmt
+}
+
+// dsnOptions enable foreign keys (ON DELETE CASCADE depends on them), let
+// writers wait for each other instead of failing, and take the write lock when
+// a transaction begins, since SQLite has no SELECT ... FOR UPDATE.
+const dsnOptions = "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate&_time_format=sqlite"
+
+func New(StoragePath string, opts storage.Options) (*Storage, error) {
+	const op = "storage.sqlite.New"
+	sep := "?"
+	if strings.Contains(StoragePath, "?") {
+		sep = "&"
+	}
+	db, err := otelsql.Open("sqlite", StoragePath+sep+dsnOptions,
+		otelsql.WithAttributes(semconv.DBSystemNameSQLite),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{OmitRows: true, OmitConnResetSession: true}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	setPool(db, opts)
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("%s: ping: %w", op, err)
+	}
+
+	return &Storage{
+		db:           db,
+		queryTimeout: opts.QueryTimeout,
+	}, nil
+}
+
+// DB returns the connection pool of the storage, for running migrations.
+func (s *Storage) DB() *sql.DB {
+	return s.db
+}
+
+func (s *Storage) Ping(ctx context.Context) error {
+	const op = "storage.sqlite.Ping"
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// withTimeout bounds a storage call by the configured query timeout, on top
+// of whatever deadline the caller's context already has.
+func (s *Storage) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.queryTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, s.queryTimeout)
+}
+
+// hotQueries are the queries Prepare prepares statements for.
+var hotQueries = []string{getUserByUsernameQuery, getNoteQuery, isSessionActiveQuery}
+
+// Prepare prepares the statements of the hot queries. It is called once the
+// schema is migrated and before the storage is shared, so that no request
+// waits on a statement being prepared; until then, and in commands that do
+// not serve requests, hot queries are prepared per call like the others.
+func (s *Storage) Prepare(ctx context.Context) error {
+	const op = "storage.sqlite.Prepare"
+	stmts := make(map[string]*sql.Stmt, len(hotQueries))
+	for _, query := range hotQueries {
+		stmt, err := s.db.PrepareContext(ctx, query)
+		if err != nil {
+			closeStmts(stmts)
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		stmts[query] = stmt
+	}
+	closeStmts(s.stmts)
+	s.stmts = stmts
+	return nil
+}
+
+// queryRow runs a hot query through its prepared statement, if Prepare has
+// run.
+func (s *Storage) queryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	if stmt, ok := s.stmts[query]; ok {
+		return stmt.QueryRowContext(ctx, args...)
+	}
+	return s.db.QueryRowContext(ctx, query, args...)
+}
+
+func closeStmts(stmts map[string]*sql.Stmt) {
+	for _, stmt := range stmts {
+		stmt.Close()
+	}
+}
+
+// setPool applies the pool settings; zero values keep the database/sql defaults.
+func setPool(db *sql.DB, opts storage.Options) {
+	if opts.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(opts.MaxOpenConns)
+	}
+	if opts.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(opts.MaxIdleConns)
+	}
+	if opts.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	}
+	if opts.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
+	}
+}
+
+// Close closes the connection pool once in-flight queries are done.
+func (s *Storage) Close() error {
+	const op = "storage.sqlite.Close"
+	closeStmts(s.stmts)
+	if err := s.db.Close(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// now returns the current time the way it is stored: in UTC, so that stored
+// timestamps compare correctly as text, and at the precision of postgres.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+func isUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
+
+func (s *Storage) SaveUser(ctx context.Context, username, password string) (int, error) {
+	const op = "storage.sqlite.SaveUser"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, fmt.Errorf("%s: hash password: %w", op, err)
+	}
+	var userID int
+	err = s.db.QueryRowContext(ctx,
+		"INSERT INTO users(username, password, created_at) VALUES(?, ?, ?) RETURNING id",
+		username, string(hashedPassword), now(),
+	).Scan(&userID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, storage.ErrUserExists
+		}
+		return 0, fmt.Errorf("%s: insert user: %w", op, err)
+	}
+
+	return userID, nil
+}
+
+func (s *Storage) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	const op = "storage.sqlite.GetUserByUsername"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	var u models.User
+	err := s.queryRow(ctx, getUserByUsernameQuery, username).Scan(&u.ID, &u.Username, &u.Password, &u.Role, &u.LockedAt, &u.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: query row: %w", op, err)
+	}
+	return &u, nil
+}
+
+func (s *Storage) SaveNote(ctx context.Context, userID int, title, content string, tags []string) error {
+	const op = "storage.sqlite.SaveNote"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: begin tx: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	t := now()
+	var noteID int
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO notes(user_id, title, content, created_at, updated_at) VALUES(?, ?, ?, ?, ?) RETURNING id",
+		userID, title, content, t, t,
+	).Scan(&noteID)
+	if err != nil {
+		return fmt.Errorf("%s: insert note: %w", op, err)
+	}
+	if err := setNoteTags(ctx, tx, userID, noteID, tags); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: commit: %w", op, err)
+	}
+	return nil
+}
+
+// noteTagsColumn selects the tag names of the note aliased as n as a JSON array.
+const noteTagsColumn = `(
+		SELECT json_group_array(t.name)
+		FROM note_tags nt JOIN tags t ON t.id = nt.tag_id
+		WHERE nt.note_id = n.id
+	)`
+
+// noteColumns selects a models.Note from the notes table aliased as n.
+const noteColumns = "n.id, n.user_id, n.notebook_id, n.title, n.content, " + noteTagsColumn + ", n.version, n.created_at, n.updated_at"
+
+// tagList scans the JSON array built by noteTagsColumn into sorted tag names.
+type tagList []string
+
+func (l *tagList) Scan(src any) error {
+	var b []byte
+	switch v := src.(type) {
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return fmt.Errorf("scan tags: unexpected type %T", src)
+	}
+	tags := []string{}
+	if err := json.Unmarshal(b, &tags); err != nil {
+		return fmt.Errorf("scan tags: %w", err)
+	}
+	slices.Sort(tags)
+	*l = tags
+	return nil
+}
+
+// jsonArray encodes tag names for json_each.
+func jsonArray(tags []string) string {
+	if tags == nil {
+		tags = []string{}
+	}
+	b, _ := json.Marshal(tags)
+	return string(b)
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanNote(row rowScanner, n *models.Note, extra ...any) error {
+	dest := []any{&n.ID, &n.UserID, &n.NotebookID, &n.Title, &n.Content, (*tagList)(&n.Tags), &n.Version, &n.CreatedAt, &n.UpdatedAt}
+	return row.Scan(append(dest, extra...)...)
+}
+
+func (s *Storage) GetNote(ctx context.Context, userID, noteID int) (*models.Note, error) {
+	const op = "storage.sqlite.GetNote"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	var resNote models.Note
+	err := scanNote(s.queryRow(ctx, getNoteQuery, noteID, userID), &resNote)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrNoteNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: query row: %w", op, err)
+	}
+	return &resNote, nil
+}
+
+// sortColumns whitelists the columns a note listing can be ordered by.
+var sortColumns = map[string]string{
+	storage.SortByCreatedAt: "n.created_at",
+	storage.SortByUpdatedAt: "n.updated_at",
+	storage.SortByTitle:     "n.title",
+}
+
+// queryBuilder collects WHERE conditions with numbered placeholders, so caller
+// input only ever reaches the database as query parameters.
+type queryBuilder struct {
+	conds []string
+	args  []any
+}
+
+// arg registers a parameter and returns its placeholder.
+func (q *queryBuilder) arg(v any) string {
+	q.args = append(q.args, v)
+	return "?" + strconv.Itoa(len(q.args))
+}
+
+func (q *queryBuilder) where(cond string) {
+	q.conds = append(q.conds, cond)
+}
+
+func (q *queryBuilder) whereClause() string {
+	return strings.Join(q.conds, " AND ")
+}
+
+// likeEscaper escapes LIKE wildcards so a title prefix is matched literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func noteFilterQuery(userID int, filter storage.NoteFilter) *queryBuilder {
+	q := &queryBuilder{}
+	q.where("n.user_id = " + q.arg(userID))
+	q.where("n.deleted_at IS NULL")
+	if filter.NotebookID != nil {
+		q.where("n.notebook_id = " + q.arg(*filter.NotebookID))
+	}
+	if len(filter.Tags) > 0 {
+		tags := q.arg(jsonArray(filter.Tags))
+		if filter.MatchAllTags {
+			q.where(`(
+				SELECT COUNT(*) FROM note_tags nt JOIN tags t ON t.id = nt.tag_id
+				WHERE nt.note_id = n.id AND t.name IN (SELECT value FROM json_each(` + tags + `))
+			) = ` + q.arg(len(filter.Tags)))
+		} else {
+			q.where(`EXISTS (
+				SELECT 1 FROM note_tags nt JOIN tags t ON t.id = nt.tag_id
+				WHERE nt.note_id = n.id AND t.name IN (SELECT value FROM json_each(` + tags + `))
+			)`)
+		}
+	}
+	if filter.CreatedAfter != nil {
+		q.where("n.created_at > " + q.arg(filter.CreatedAfter.UTC()))
+	}
+	if filter.CreatedBefore != nil {
+		q.where("n.created_at < " + q.arg(filter.CreatedBefore.UTC()))
+	}
+	if filter.UpdatedSince != nil {
+		q.where("n.updated_at >= " + q.arg(filter.UpdatedSince.UTC()))
+	}
+	if filter.TitlePrefix != "" {
+		// SQLite's LIKE is case-insensitive for ASCII, like ILIKE.
+		q.where("n.title LIKE " + q.arg(likeEscaper.Replace(filter.TitlePrefix)+"%") + ` ESCAPE '\'`)
+	}
+	if filter.HasContent != nil {
+		if *filter.HasContent {
+			q.where("n.content <> ''")
+		} else {
+			q.where("n.content = ''")
+		}
+	}
+	return q
+}
+
+// cursorKey converts the key of a cursor to the type of its sort column.
+func cursorKey(c *storage.Cursor) (any, error) {
+	if c.SortBy == storage.SortByTitle {
+		return c.Key, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, c.Key)
+	if err != nil {
+		return nil, storage.ErrInvalidCursor
+	}
+	return t.UTC(), nil
+}
+
+// GetAllNotes returns one keyset-paginated page of the user's notes ordered by
+// (page.SortBy, id).
+func (s *Storage) GetAllNotes(ctx context.Context, userID int, page storage.PageRequest, filter storage.NoteFilter) (*storage.NotePage, error) {
+	const op = "storage.sqlite.GetAllNotes"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if page.Sort != storage.SortAsc {
+		page.Sort = storage.SortDesc
+	}
+	sortCol, ok := sortColumns[page.SortBy]
+	if !ok {
+		page.SortBy = storage.SortByCreatedAt
+		sortCol = sortColumns[page.SortBy]
+	}
+	q := noteFilterQuery(userID, filter)
+
+	var total *int
+	if page.WithTotal {
+		var count int
+		err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM notes n WHERE "+q.whereClause(), q.args...).Scan(&count)
+		if err != nil {
+			return nil, fmt.Errorf("%s: count: %w", op, err)
+		}
+		total = &count
+	}
+
+	// Walking backward flips both the keyset comparison and the order;
+	// storage.Paginate restores the listing order afterwards.
+	order := page.Sort
+	if page.Backward() {
+		if order == storage.SortAsc {
+			order = storage.SortDesc
+		} else {
+			order = storage.SortAsc
+		}
+	}
+	if page.Cursor != nil {
+		cmp := "<"
+		if order == storage.SortAsc {
+			cmp = ">"
+		}
+		key, err := cursorKey(page.Cursor)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		q.where(fmt.Sprintf("(%s, n.id) %s (%s, %s)", sortCol, cmp, q.arg(key), q.arg(page.Cursor.ID)))
+	}
+	query := `
+		SELECT ` + noteColumns + `
+		FROM notes n
+		WHERE ` + q.whereClause() + `
+		ORDER BY ` + sortCol + ` ` + order + `, n.id ` + order + `
+		LIMIT ` + q.arg(page.Limit+1)
+	rows, err := s.db.QueryContext(ctx, query, q.args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+	notes := []models.Note{}
+	for rows.Next() {
+		var n models.Note
+		if err := scanNote(rows, &n); err != nil {
+			return nil, fmt.Errorf("%s: scan: %w", op, err)
+		}
+		notes = append(notes, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: rows: %w", op, err)
+	}
+	res := storage.Paginate(notes, page)
+	res.Total = total
+	return &res, nil
+}
+
+// UpdateNote overwrites a note if it is still at expectedVersion, or
+// unconditionally when expectedVersion is 0. It returns the version of the note
+// after the call: the new one on success, the current one on
+// storage.ErrVersionMismatch.
+func (s *Storage) UpdateNote(ctx context.Context, noteID int, userID int, title, content string, tags []string, expectedVersion int) (int, error) {
+	const op = "storage.sqlite.UpdateNote"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	patch := storage.NotePatch{Title: &title, Content: &content, Tags: &tags}
+	return s.writeNote(ctx, op, noteID, userID, patch, expectedVersion)
+}
+
+// PatchNote writes only the fields set in the patch. Versions are handled
+// as in UpdateNote.
+func (s *Storage) PatchNote(ctx context.Context, noteID, userID int, patch storage.NotePatch, expectedVersion int) (int, error) {
+	const op = "storage.sqlite.PatchNote"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	return s.writeNote(ctx, op, noteID, userID, patch, expectedVersion)
+}
+
+func (s *Storage) writeNote(ctx context.Context, op string, noteID, userID int, patch storage.NotePatch, expectedVersion int) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: begin tx: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var ownerID, version int
+	err = tx.QueryRowContext(ctx, "SELECT user_id, version FROM notes WHERE id=? AND deleted_at IS NULL", noteID).Scan(&ownerID, &version)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, storage.ErrNoteNotFound
+		}
+		return 0, fmt.Errorf("%s: query row: %w", op, err)
+	}
+	if ownerID != userID {
+		var canWrite bool
+		err := tx.QueryRowContext(ctx,
+			"SELECT EXISTS(SELECT 1 FROM note_shares WHERE note_id=? AND user_id=? AND permission=?)",
+			noteID, userID, models.PermissionWrite,
+		).Scan(&canWrite)
+		if err != nil {
+			return 0, fmt.Errorf("%s: check share: %w", op, err)
+		}
+		if !canWrite {
+			return 0, storage.ErrForbidden
+		}
+	}
+	if expectedVersion != 0 && expectedVersion != version {
+		return version, storage.ErrVersionMismatch
+	}
+
+	args := []any{now()}
+	set := []string{"version=version+1", "updated_at=?1"}
+	if patch.Title != nil {
+		args = append(args, *patch.Title)
+		set = append(set, fmt.Sprintf("title=?%d", len(args)))
+	}
+	if patch.Content != nil {
+		args = append(args, *patch.Content)
+		set = append(set, fmt.Sprintf("content=?%d", len(args)))
+	}
+	if patch.Title != nil || patch.Content != nil {
+		if err := saveRevision(ctx, tx, noteID); err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	args = append(args, noteID)
+	query := fmt.Sprintf("UPDATE notes SET %s WHERE id=?%d RETURNING version", strings.Join(set, ", "), len(args))
+	if err := tx.QueryRowContext(ctx, query, args...).Scan(&version); err != nil {
+		return 0, fmt.Errorf("%s: exec: %w", op, err)
+	}
+	if patch.Tags != nil {
+		// Tags belong to the note owner even when a collaborator edits the note.
+		if err := setNoteTags(ctx, tx, ownerID, noteID, *patch.Tags); err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: commit: %w", op, err)
+	}
+	return version, nil
+}
+
+// saveRevision stores the current title and content of a note as its next revision.
+// The caller must run inside a write transaction.
+func saveRevision(ctx context.Context, tx *sql.Tx, noteID int) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO note_revisions(note_id, revision, title, content, created_at)
+		SELECT n.id,
+			COALESCE((SELECT MAX(revision) FROM note_revisions WHERE note_id = n.id), 0) + 1,
+			n.title, n.content, n.updated_at
+		FROM notes n
+		WHERE n.id = ?
+	`, noteID)
+	if err != nil {
+		return fmt.Errorf("save revision: %w", err)
+	}
+	return nil
+}
+
+// setNoteTags replaces the tags of a note, creating missing tags for the user.
+func setNoteTags(ctx context.Context, tx *sql.Tx, userID, noteID int, tags []string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM note_tags WHERE note_id=?", noteID); err != nil {
+		return fmt.Errorf("clear note tags: %w", err)
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	names := jsonArray(tags)
+	// The WHERE clause tells the parser that ON CONFLICT belongs to the INSERT.
+	_, err := tx.ExecContext(ctx,
+		"INSERT INTO tags(user_id, name, created_at) SELECT ?, value, ? FROM json_each(?) WHERE true ON CONFLICT (user_id, name) DO NOTHING",
+		userID, now(), names,
+	)
+	if err != nil {
+		return fmt.Errorf("insert tags: %w", err)
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO note_tags(note_id, tag_id) SELECT ?, id FROM tags WHERE user_id=? AND name IN (SELECT value FROM json_each(?))",
+		noteID, userID, names,
+	)
+	if err != nil {
+		return fmt.Errorf("link note tags: %w", err)
+	}
+	return nil
+}
+
+func (s *Storage) GetTags(ctx context.Context, userID int) ([]models.Tag, error) {
+	const op = "storage.sqlite.GetTags"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT t.name, COUNT(nt.note_id)
+		FROM tags t
+		JOIN note_tags nt ON nt.tag_id = t.id
+		JOIN notes n ON n.id = nt.note_id AND n.deleted_at IS NULL
+		WHERE t.user_id = ?
+		GROUP BY t.name
+		ORDER BY t.name
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+	tags := []models.Tag{}
+	for rows.Next() {
+		var t models.Tag
+		if err := rows.Scan(&t.Name, &t.NoteCount); err != nil {
+			return nil, fmt.Errorf("%s: scan: %w", op, err)
+		}
+		tags = append(tags, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: rows: %w", op, err)
+	}
+	return tags, nil
+}
+
+func (s *Storage) GetRevisions(ctx context.Context, userID, noteID int) ([]models.Revision, error) {
+	const op = "storage.sqlite.GetRevisions"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.checkNoteOwner(ctx, userID, noteID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT note_id, revision, title, content, created_at
+		FROM note_revisions
+		WHERE note_id = ?
+		ORDER BY revision DESC
+	`, noteID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+	revisions := []models.Revision{}
+	for rows.Next() {
+		var rev models.Revision
+		if err := rows.Scan(&rev.NoteID, &rev.Revision, &rev.Title, &rev.Content, &rev.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: scan: %w", op, err)
+		}
+		revisions = append(revisions, rev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: rows: %w", op, err)
+	}
+	return revisions, nil
+}
+
+func (s *Storage) GetRevision(ctx context.Context, userID, noteID, revision int) (*models.Revision, error) {
+	const op = "storage.sqlite.GetRevision"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.checkNoteOwner(ctx, userID, noteID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	var rev models.Revision
+	err := s.db.QueryRowContext(ctx,
+		"SELECT note_id, revision, title, content, created_at FROM note_revisions WHERE note_id=? AND revision=?",
+		noteID, revision,
+	).Scan(&rev.NoteID, &rev.Revision, &rev.Title, &rev.Content, &rev.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrRevisionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: query row: %w", op, err)
+	}
+	return &rev, nil
+}
+
+func (s *Storage) RestoreRevision(ctx context.Context, userID, noteID, revision int) error {
+	const op = "storage.sqlite.RestoreRevision"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: begin tx: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var ownerID int
+	err = tx.QueryRowContext(ctx, "SELECT user_id FROM notes WHERE id=? AND deleted_at IS NULL", noteID).Scan(&ownerID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return storage.ErrNoteNotFound
+		}
+		return fmt.Errorf("%s: query row: %w", op, err)
+	}
+	if ownerID != userID {
+		return storage.ErrForbidden
+	}
+	var title, content string
+	err = tx.QueryRowContext(ctx,
+		"SELECT title, content FROM note_revisions WHERE note_id=? AND revision=?",
+		noteID, revision,
+	).Scan(&title, &content)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.ErrRevisionNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("%s: query revision: %w", op, err)
+	}
+	if err := saveRevision(ctx, tx, noteID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE notes SET title=?, content=?, version=version+1, updated_at=? WHERE id=?", title, content, now(), noteID)
+	if err != nil {
+		return fmt.Errorf("%s: exec: %w", op, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: commit: %w", op, err)
+	}
+	return nil
+}
+
+// checkNoteOwner returns storage.ErrNoteNotFound unless the note belongs to the user.
+func (s *Storage) checkNoteOwner(ctx context.Context, userID, noteID int) error {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM notes WHERE id=? AND user_id=? AND deleted_at IS NULL)", noteID, userID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("check note owner: %w", err)
+	}
+	if !exists {
+		return storage.ErrNoteNotFound
+	}
+	return nil
+}
+
+// matchQuery turns a search query into an FTS5 expression that matches notes
+// containing every word of it. Words are quoted, so FTS5 syntax in the query is
+// matched literally instead of failing to parse.
+func matchQuery(query string) string {
+	words := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	terms := make([]string, 0, len(words))
+	for _, w := range words {
+		if w != "or" {
+			terms = append(terms, `"`+w+`"`)
+		}
+	}
+	return strings.Join(terms, " ")
+}
+
+// SearchNotes ranks matches with bm25, weighting title matches over content
+// matches like the postgres search vector does.
+func (s *Storage) SearchNotes(ctx context.Context, userID int, query string, limit, offset int) ([]models.SearchResult, error) {
+	const op = "storage.sqlite.SearchNotes"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	results := []models.SearchResult{}
+	match := matchQuery(query)
+	if match == "" {
+		return results, nil
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+noteColumns+`,
+			-bm25(notes_fts, 1.0, 0.4) AS rank,
+			highlight(notes_fts, 0, ?, ?),
+			snippet(notes_fts, 1, ?, ?, '...', 30)
+		FROM notes_fts
+		JOIN notes n ON n.id = notes_fts.rowid
+		WHERE notes_fts MATCH ? AND n.user_id = ? AND n.deleted_at IS NULL
+		ORDER BY rank DESC, n.created_at DESC
+		LIMIT ? OFFSET ?
+	`, storage.MatchStart, storage.MatchStop, storage.MatchStart, storage.MatchStop, match, userID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var res models.SearchResult
+		if err := scanNote(rows, &res.Note, &res.Rank, &res.TitleHighlight, &res.Snippet); err != nil {
+			return nil, fmt.Errorf("%s: scan: %w", op, err)
+		}
+		res.TitleHighlight = storage.MarkMatches(res.TitleHighlight)
+		res.Snippet = storage.MarkMatches(res.Snippet)
+		results = append(results, res)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: rows: %w", op, err)
+	}
+	return results, nil
+}
+
+// DeleteNote moves the note to the trash. Trashed notes are hidden from every
+// other query until restored or purged.
+func (s *Storage) DeleteNote(ctx context.Context, noteID, userID int) error {
+	const op = "storage.sqlite.DeleteNote"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	var ownerID int
+	err := s.db.QueryRowContext(ctx, "SELECT user_id FROM notes WHERE id=? AND deleted_at IS NULL", noteID).Scan(&ownerID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return storage.ErrNoteNotFound
+		}
+		return fmt.Errorf("%s: query row: %w", op, err)
+	}
+	if ownerID != userID {
+		return storage.ErrForbidden
+	}
+	_, err = s.db.ExecContext(ctx, "UPDATE notes SET deleted_at=? WHERE id=?", now(), noteID)
+	if err != nil {
+		return fmt.Errorf("%s: trash exec: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Storage) GetTrash(ctx context.Context, userID int) ([]models.Note, error) {
+	const op = "storage.sqlite.GetTrash"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+noteColumns+`, n.deleted_at
+		FROM notes n
+		WHERE n.user_id = ? AND n.deleted_at IS NOT NULL
+		ORDER BY n.deleted_at DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+	notes := []models.Note{}
+	for rows.Next() {
+		var n models.Note
+		if err := scanNote(rows, &n, &n.DeletedAt); err != nil {
+			return nil, fmt.Errorf("%s: scan: %w", op, err)
+		}
+		notes = append(notes, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: rows: %w", op, err)
+	}
+	return notes, nil
+}
+
+func (s *Storage) RestoreNote(ctx context.Context, userID, noteID int) error {
+	const op = "storage.sqlite.RestoreNote"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE notes SET deleted_at=NULL WHERE id=? AND user_id=? AND deleted_at IS NOT NULL",
+		noteID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: exec: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: rows affected: %w", op, err)
+	}
+	if n == 0 {
+		return storage.ErrNoteNotFound
+	}
+	return nil
+}
+
+// PurgeNote permanently removes a note that is already in the trash.
+func (s *Storage) PurgeNote(ctx context.Context, userID, noteID int) error {
+	const op = "storage.sqlite.PurgeNote"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx,
+		"DELETE FROM notes WHERE id=? AND user_id=? AND deleted_at IS NOT NULL",
+		noteID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: exec: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: rows affected: %w", op, err)
+	}
+	if n == 0 {
+		return storage.ErrNoteNotFound
+	}
+	return nil
+}
+
+// PurgeTrash permanently removes every note trashed before the given time.
+func (s *Storage) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	const op = "storage.sqlite.PurgeTrash"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, "DELETE FROM notes WHERE deleted_at IS NOT NULL AND deleted_at < ?", before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("%s: exec: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: rows affected: %w", op, err)
+	}
+	return n, nil
+}
+
+func (s *Storage) SaveNotebook(ctx context.Context, userID int, name string, parentID *int) (int, error) {
+	const op = "storage.sqlite.SaveNotebook"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if parentID != nil {
+		if err := s.checkNotebookOwner(ctx, s.db, userID, *parentID); err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	t := now()
+	var notebookID int
+	err := s.db.QueryRowContext(ctx,
+		"INSERT INTO notebooks(user_id, parent_id, name, created_at, updated_at) VALUES(?, ?, ?, ?, ?) RETURNING id",
+		userID, parentID, name, t, t,
+	).Scan(&notebookID)
+	if err != nil {
+		return 0, fmt.Errorf("%s: insert notebook: %w", op, err)
+	}
+	return notebookID, nil
+}
+
+func (s *Storage) GetNotebooks(ctx context.Context, userID int) ([]models.Notebook, error) {
+	const op = "storage.sqlite.GetNotebooks"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, user_id, parent_id, name, created_at, updated_at
+		FROM notebooks
+		WHERE user_id = ?
+		ORDER BY name, id
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+	notebooks := []models.Notebook{}
+	for rows.Next() {
+		var nb models.Notebook
+		if err := rows.Scan(&nb.ID, &nb.UserID, &nb.ParentID, &nb.Name, &nb.CreatedAt, &nb.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("%s: scan: %w", op, err)
+		}
+		notebooks = append(notebooks, nb)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: rows: %w", op, err)
+	}
+	return notebooks, nil
+}
+
+func (s *Storage) GetNotebook(ctx context.Context, userID, notebookID int) (*models.Notebook, error) {
+	const op = "storage.sqlite.GetNotebook"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	var nb models.Notebook
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id, user_id, parent_id, name, created_at, updated_at FROM notebooks WHERE id=? AND user_id=?",
+		notebookID, userID,
+	).Scan(&nb.ID, &nb.UserID, &nb.ParentID, &nb.Name, &nb.CreatedAt, &nb.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrNotebookNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: query row: %w", op, err)
+	}
+	return &nb, nil
+}
+
+// subtreeCTE selects the notebook ?1 and all notebooks nested in it.
+const subtreeCTE = `
+	WITH RECURSIVE subtree(id) AS (
+		SELECT id FROM notebooks WHERE id = ?1
+		UNION ALL
+		SELECT nb.id FROM notebooks nb JOIN subtree st ON nb.parent_id = st.id
+	)`
+
+func (s *Storage) UpdateNotebook(ctx context.Context, userID, notebookID int, name string, parentID *int) error {
+	const op = "storage.sqlite.UpdateNotebook"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: begin tx: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if err := s.checkNotebookOwner(ctx, tx, userID, notebookID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if parentID != nil {
+		if err := s.checkNotebookOwner(ctx, tx, userID, *parentID); err != nil {
+			return fmt.Errorf("%s: parent: %w", op, err)
+		}
+		var cycle bool
+		err := tx.QueryRowContext(ctx, subtreeCTE+" SELECT EXISTS(SELECT 1 FROM subtree WHERE id = ?2)", notebookID, *parentID).Scan(&cycle)
+		if err != nil {
+			return fmt.Errorf("%s: check cycle: %w", op, err)
+		}
+		if cycle {
+			return storage.ErrNotebookCycle
+		}
+	}
+	_, err = tx.ExecContext(ctx,
+		"UPDATE notebooks SET name=?, parent_id=?, updated_at=? WHERE id=?",
+		name, parentID, now(), notebookID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: exec: %w", op, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: commit: %w", op, err)
+	}
+	return nil
+}
+
+// DeleteNotebook removes a notebook. With recursive set, nested notebooks are
+// removed as well and all their notes go to the trash; otherwise the notes and
+// child notebooks of the removed notebook are moved to the root.
+func (s *Storage) DeleteNotebook(ctx context.Context, userID, notebookID int, recursive bool) error {
+	const op = "storage.sqlite.DeleteNotebook"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: begin tx: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if err := s.checkNotebookOwner(ctx, tx, userID, notebookID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if recursive {
+		_, err = tx.ExecContext(ctx, subtreeCTE+`
+			UPDATE notes SET deleted_at = ?2
+			WHERE notebook_id IN (SELECT id FROM subtree) AND deleted_at IS NULL
+		`, notebookID, now())
+		if err != nil {
+			return fmt.Errorf("%s: trash notes: %w", op, err)
+		}
+		// Notes left in the removed notebooks go through ON DELETE SET NULL.
+		if _, err := tx.ExecContext(ctx, subtreeCTE+" DELETE FROM notebooks WHERE id IN (SELECT id FROM subtree)", notebookID); err != nil {
+			return fmt.Errorf("%s: delete notebooks: %w", op, err)
+		}
+	} else {
+		if _, err := tx.ExecContext(ctx, "UPDATE notes SET notebook_id=NULL WHERE notebook_id=?", notebookID); err != nil {
+			return fmt.Errorf("%s: move notes: %w", op, err)
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE notebooks SET parent_id=NULL WHERE parent_id=?", notebookID); err != nil {
+			return fmt.Errorf("%s: move notebooks: %w", op, err)
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM notebooks WHERE id=?", notebookID); err != nil {
+			return fmt.Errorf("%s: delete notebook: %w", op, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: commit: %w", op, err)
+	}
+	return nil
+}
+
+// MoveNote puts a note into a notebook, or into the root when notebookID is nil.
+func (s *Storage) MoveNote(ctx context.Context, userID, noteID int, notebookID *int) error {
+	const op = "storage.sqlite.MoveNote"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if notebookID != nil {
+		if err := s.checkNotebookOwner(ctx, s.db, userID, *notebookID); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE notes SET notebook_id=?, version=version+1 WHERE id=? AND user_id=? AND deleted_at IS NULL",
+		notebookID, noteID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: exec: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: rows affected: %w", op, err)
+	}
+	if n == 0 {
+		return storage.ErrNoteNotFound
+	}
+	return nil
+}
+
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// checkNotebookOwner returns storage.ErrNotebookNotFound unless the notebook belongs to the user.
+func (s *Storage) checkNotebookOwner(ctx context.Context, q queryRower, userID, notebookID int) error {
+	var exists bool
+	err := q.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM notebooks WHERE id=? AND user_id=?)", notebookID, userID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("check notebook owner: %w", err)
+	}
+	if !exists {
+		return storage.ErrNotebookNotFound
+	}
+	return nil
+}
+
+// ShareNote grants another user read or write access to a note. Sharing an
+// already shared note again replaces the permission.
+func (s *Storage) ShareNote(ctx context.Context, ownerID, noteID int, username, permission string) error {
+	const op = "storage.sqlite.ShareNote"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.checkShareOwner(ctx, ownerID, noteID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	var targetID int
+	err := s.db.QueryRowContext(ctx, "SELECT id FROM users WHERE username=?", username).Scan(&targetID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("%s: query user: %w", op, err)
+	}
+	if targetID == ownerID {
+		return storage.ErrShareWithOwner
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO note_shares(note_id, user_id, permission, created_at) VALUES(?, ?, ?, ?)
+		ON CONFLICT (note_id, user_id) DO UPDATE SET permission = excluded.permission
+	`, noteID, targetID, permission, now())
+	if err != nil {
+		return fmt.Errorf("%s: insert share: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Storage) UnshareNote(ctx context.Context, ownerID, noteID, userID int) error {
+	const op = "storage.sqlite.UnshareNote"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.checkShareOwner(ctx, ownerID, noteID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	res, err := s.db.ExecContext(ctx, "DELETE FROM note_shares WHERE note_id=? AND user_id=?", noteID, userID)
+	if err != nil {
+		return fmt.Errorf("%s: exec: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: rows affected: %w", op, err)
+	}
+	if n == 0 {
+		return storage.ErrShareNotFound
+	}
+	return nil
+}
+
+func (s *Storage) GetNoteShares(ctx context.Context, ownerID, noteID int) ([]models.NoteShare, error) {
+	const op = "storage.sqlite.GetNoteShares"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.checkShareOwner(ctx, ownerID, noteID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT ns.note_id, ns.user_id, u.username, ns.permission, ns.created_at
+		FROM note_shares ns
+		JOIN users u ON u.id = ns.user_id
+		WHERE ns.note_id = ?
+		ORDER BY u.username
+	`, noteID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+	shares := []models.NoteShare{}
+	for rows.Next() {
+		var sh models.NoteShare
+		if err := rows.Scan(&sh.NoteID, &sh.UserID, &sh.Username, &sh.Permission, &sh.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: scan: %w", op, err)
+		}
+		shares = append(shares, sh)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: rows: %w", op, err)
+	}
+	return shares, nil
+}
+
+func (s *Storage) GetSharedNotes(ctx context.Context, userID int) ([]models.SharedNote, error) {
+	const op = "storage.sqlite.GetSharedNotes"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+noteColumns+`, ns.permission, u.username
+		FROM note_shares ns
+		JOIN notes n ON n.id = ns.note_id AND n.deleted_at IS NULL
+		JOIN users u ON u.id = n.user_id
+		WHERE ns.user_id = ?
+		ORDER BY n.updated_at DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+	notes := []models.SharedNote{}
+	for rows.Next() {
+		var n models.SharedNote
+		if err := scanNote(rows, &n.Note, &n.Permission, &n.OwnerUsername); err != nil {
+			return nil, fmt.Errorf("%s: scan: %w", op, err)
+		}
+		notes = append(notes, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: rows: %w", op, err)
+	}
+	return notes, nil
+}
+
+// checkShareOwner makes sure only the owner manages the shares of a note:
+// collaborators get storage.ErrForbidden, everybody else storage.ErrNoteNotFound.
+func (s *Storage) checkShareOwner(ctx context.Context, ownerID, noteID int) error {
+	var noteOwnerID int
+	err := s.db.QueryRowContext(ctx, "SELECT user_id FROM notes WHERE id=? AND deleted_at IS NULL", noteID).Scan(&noteOwnerID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.ErrNoteNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("check note owner: %w", err)
+	}
+	if noteOwnerID == ownerID {
+		return nil
+	}
+	var shared bool
+	err = s.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM note_shares WHERE note_id=? AND user_id=?)", noteID, ownerID).Scan(&shared)
+	if err != nil {
+		return fmt.Errorf("check note share: %w", err)
+	}
+	if shared {
+		return storage.ErrForbidden
+	}
+	return storage.ErrNoteNotFound
+}
+
+// SaveNoteLink stores a public link to a note. Only the hash of the link token is
+// kept; an empty password leaves the link open to anyone holding the token.
+func (s *Storage) SaveNoteLink(ctx context.Context, ownerID, noteID int, tokenHash, password string, expiresAt *time.Time) (int, error) {
+	const op = "storage.sqlite.SaveNoteLink"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.checkShareOwner(ctx, ownerID, noteID); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	var hashedPassword *string
+	if password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return 0, fmt.Errorf("%s: hash password: %w", op, err)
+		}
+		h := string(hash)
+		hashedPassword = &h
+	}
+	var expires *time.Time
+	if expiresAt != nil {
+		t := expiresAt.UTC()
+		expires = &t
+	}
+	var linkID int
+	err := s.db.QueryRowContext(ctx,
+		"INSERT INTO note_links(note_id, token_hash, password, expires_at, created_at) VALUES(?, ?, ?, ?, ?) RETURNING id",
+		noteID, tokenHash, hashedPassword, expires, now(),
+	).Scan(&linkID)
+	if err != nil {
+		return 0, fmt.Errorf("%s: insert link: %w", op, err)
+	}
+	return linkID, nil
+}
+
+func (s *Storage) GetNoteLinks(ctx context.Context, ownerID, noteID int) ([]models.NoteLink, error) {
+	const op = "storage.sqlite.GetNoteLinks"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.checkShareOwner(ctx, ownerID, noteID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, note_id, password IS NOT NULL, expires_at, view_count, revoked_at, created_at
+		FROM note_links
+		WHERE note_id = ?
+		ORDER BY created_at DESC, id DESC
+	`, noteID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+	links := []models.NoteLink{}
+	for rows.Next() {
+		var l models.NoteLink
+		if err := rows.Scan(&l.ID, &l.NoteID, &l.HasPassword, &l.ExpiresAt, &l.ViewCount, &l.RevokedAt, &l.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: scan: %w", op, err)
+		}
+		links = append(links, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: rows: %w", op, err)
+	}
+	return links, nil
+}
+
+func (s *Storage) RevokeNoteLink(ctx context.Context, ownerID, noteID, linkID int) error {
+	const op = "storage.sqlite.RevokeNoteLink"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.checkShareOwner(ctx, ownerID, noteID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE note_links SET revoked_at=? WHERE id=? AND note_id=? AND revoked_at IS NULL",
+		now(), linkID, noteID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: exec: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: rows affected: %w", op, err)
+	}
+	if n == 0 {
+		return storage.ErrLinkNotFound
+	}
+	return nil
+}
+
+// GetPublicNote resolves a public link token, checks its expiry and password
+// and counts the view.
+func (s *Storage) GetPublicNote(ctx context.Context, tokenHash, password string) (*models.PublicNote, error) {
+	const op = "storage.sqlite.GetPublicNote"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	var (
+		linkID         int
+		hashedPassword sql.NullString
+		expiresAt      sql.NullTime
+		note           models.PublicNote
+	)
+	err := s.db.QueryRowContext(ctx, `
+		SELECT l.id, l.password, l.expires_at, n.title, n.content, `+noteTagsColumn+`, n.updated_at
+		FROM note_links l
+		JOIN notes n ON n.id = l.note_id AND n.deleted_at IS NULL
+		WHERE l.token_hash = ? AND l.revoked_at IS NULL
+	`, tokenHash).Scan(&linkID, &hashedPassword, &expiresAt, &note.Title, &note.Content, (*tagList)(&note.Tags), &note.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrLinkNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: query row: %w", op, err)
+	}
+	if expiresAt.Valid && !expiresAt.Time.After(time.Now()) {
+		return nil, storage.ErrLinkExpired
+	}
+	if hashedPassword.Valid {
+		if password == "" {
+			return nil, storage.ErrLinkPasswordRequired
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword.String), []byte(password)); err != nil {
+			return nil, storage.ErrInvalidLinkPassword
+		}
+	}
+	if _, err := s.db.ExecContext(ctx, "UPDATE note_links SET view_count = view_count + 1 WHERE id=?", linkID); err != nil {
+		return nil, fmt.Errorf("%s: count view: %w", op, err)
+	}
+	return &note, nil
+}
+
+// SaveRefreshToken stores the first refresh token of a new session (token family).
+func (s *Storage) SaveRefreshToken(ctx context.Context, userID int, sessionID, tokenHash string, expiresAt time.Time) error {
+	const op = "storage.sqlite.SaveRefreshToken"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO refresh_tokens(user_id, family_id, token_hash, expires_at, created_at) VALUES(?, ?, ?, ?, ?)",
+		userID, sessionID, tokenHash, expiresAt.UTC(), now(),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: insert token: %w", op, err)
+	}
+	return nil
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one in the same session.
+// Presenting a token that was already exchanged revokes the whole session and
+// returns storage.ErrTokenReused.
+func (s *Storage) RotateRefreshToken(ctx context.Context, oldTokenHash, newTokenHash string, expiresAt time.Time) (*models.Session, error) {
+	const op = "storage.sqlite.RotateRefreshToken"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: begin tx: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var (
+		tokenID   int
+		sess      models.Session
+		expiresOn time.Time
+		usedAt    sql.NullTime
+		revokedAt sql.NullTime
+	)
+	err = tx.QueryRowContext(ctx, `
+		SELECT rt.id, rt.family_id, rt.user_id, u.username, u.role, rt.expires_at, rt.used_at, rt.revoked_at
+		FROM refresh_tokens rt
+		JOIN users u ON u.id = rt.user_id
+		WHERE rt.token_hash = ?
+	`, oldTokenHash).Scan(&tokenID, &sess.ID, &sess.UserID, &sess.Username, &sess.Role, &expiresOn, &usedAt, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: query row: %w", op, err)
+	}
+	if revokedAt.Valid {
+		return nil, storage.ErrTokenRevoked
+	}
+	t := now()
+	if usedAt.Valid {
+		if _, err := tx.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at=? WHERE family_id=? AND revoked_at IS NULL", t, sess.ID); err != nil {
+			return nil, fmt.Errorf("%s: revoke family: %w", op, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("%s: commit: %w", op, err)
+		}
+		return nil, storage.ErrTokenReused
+	}
+	if !expiresOn.After(time.Now()) {
+		return nil, storage.ErrTokenExpired
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE refresh_tokens SET used_at=? WHERE id=?", t, tokenID); err != nil {
+		return nil, fmt.Errorf("%s: mark used: %w", op, err)
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO refresh_tokens(user_id, family_id, token_hash, expires_at, created_at) VALUES(?, ?, ?, ?, ?)",
+		sess.UserID, sess.ID, newTokenHash, expiresAt.UTC(), t,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: insert token: %w", op, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: commit: %w", op, err)
+	}
+	return &sess, nil
+}
+
+func (s *Storage) RevokeSession(ctx context.Context, userID int, sessionID string) error {
+	const op = "storage.sqlite.RevokeSession"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE refresh_tokens SET revoked_at=? WHERE user_id=? AND family_id=? AND revoked_at IS NULL",
+		now(), userID, sessionID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: exec: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Storage) RevokeAllSessions(ctx context.Context, userID int) error {
+	const op = "storage.sqlite.RevokeAllSessions"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at=? WHERE user_id=? AND revoked_at IS NULL", now(), userID)
+	if err != nil {
+		return fmt.Errorf("%s: exec: %w", op, err)
+	}
+	return nil
+}
+
+// IsSessionActive reports whether a session still has refresh tokens that were not revoked.
+func (s *Storage) IsSessionActive(ctx context.Context, sessionID string) (bool, error) {
+	const op = "storage.sqlite.IsSessionActive"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	var active bool
+	err := s.queryRow(ctx, isSessionActiveQuery, sessionID).Scan(&active)
+	if err != nil {
+		return false, fmt.Errorf("%s: query row: %w", op, err)
+	}
+	return active, nil
+}
+
+// GetUsers returns the users whose username contains query, in the order
+// they signed up.
+func (s *Storage) GetUsers(ctx context.Context, query string, limit, offset int) ([]models.UserInfo, error) {
+	const op = "storage.sqlite.GetUsers"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, username, role, locked_at, created_at
+		FROM users
+		WHERE username LIKE ? ESCAPE '\'
+		ORDER BY id
+		LIMIT ? OFFSET ?
+	`, "%"+likeEscaper.Replace(query)+"%", limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+	users := []models.UserInfo{}
+	for rows.Next() {
+		var u models.UserInfo
+		if err := rows.Scan(&u.ID, &u.Username, &u.Role, &u.LockedAt, &u.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: scan: %w", op, err)
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: rows: %w", op, err)
+	}
+	return users, nil
+}
+
+func (s *Storage) SetUserRole(ctx context.Context, userID int, role string) error {
+	const op = "storage.sqlite.SetUserRole"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: begin tx: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var current string
+	err = tx.QueryRowContext(ctx, "SELECT role FROM users WHERE id=?", userID).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("%s: query row: %w", op, err)
+	}
+	if current == role {
+		return nil
+	}
+	last, err := isLastAdmin(ctx, tx, userID)
+	if err != nil {
+		return fmt.Errorf("%s: count admins: %w", op, err)
+	}
+	if last {
+		return storage.ErrLastAdmin
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET role=? WHERE id=?", role, userID); err != nil {
+		return fmt.Errorf("%s: update role: %w", op, err)
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at=? WHERE user_id=? AND revoked_at IS NULL", now(), userID); err != nil {
+		return fmt.Errorf("%s: revoke sessions: %w", op, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: commit: %w", op, err)
+	}
+	return nil
+}
+
+// isLastAdmin reports whether the user is the only admin who can still log
+// in, that is the only one whose account is not locked. Transactions take
+// the write lock when they begin, so the answer cannot change before tx
+// ends.
+func isLastAdmin(ctx context.Context, tx *sql.Tx, userID int) (bool, error) {
+	var last bool
+	err := tx.QueryRowContext(ctx, `
+		SELECT u.role = ? AND u.locked_at IS NULL AND NOT EXISTS (
+			SELECT 1 FROM users o WHERE o.id <> u.id AND o.role = ? AND o.locked_at IS NULL
+		)
+		FROM users u WHERE u.id = ?`,
+		models.RoleAdmin, models.RoleAdmin, userID,
+	).Scan(&last)
+	return last, err
+}
+
+// SetUserLocked locks or unlocks the account of a user. Locked users cannot
+// log in and lose their sessions.
+func (s *Storage) SetUserLocked(ctx context.Context, userID int, locked bool) error {
+	const op = "storage.sqlite.SetUserLocked"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: begin tx: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if locked {
+		last, err := isLastAdmin(ctx, tx, userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.ErrUserNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("%s: count admins: %w", op, err)
+		}
+		if last {
+			return storage.ErrLastAdmin
+		}
+	}
+	res, err := tx.ExecContext(ctx,
+		"UPDATE users SET locked_at = CASE WHEN ? THEN COALESCE(locked_at, ?) END WHERE id=?",
+		locked, now(), userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: update user: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: rows affected: %w", op, err)
+	}
+	if n == 0 {
+		return storage.ErrUserNotFound
+	}
+	if locked {
+		if _, err := tx.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at=? WHERE user_id=? AND revoked_at IS NULL", now(), userID); err != nil {
+			return fmt.Errorf("%s: revoke sessions: %w", op, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: commit: %w", op, err)
+	}
+	return nil
+}
+
+// GetNoteCounts counts the live and trashed notes of a user and the live
+// notes they share with someone.
+func (s *Storage) GetNoteCounts(ctx context.Context, userID int) (*models.NoteCounts, error) {
+	const op = "storage.sqlite.GetNoteCounts"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	counts := models.NoteCounts{UserID: userID}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM notes WHERE user_id = u.id AND deleted_at IS NULL),
+			(SELECT COUNT(*) FROM notes WHERE user_id = u.id AND deleted_at IS NOT NULL),
+			(SELECT COUNT(DISTINCT ns.note_id) FROM note_shares ns JOIN notes n ON n.id = ns.note_id
+				WHERE n.user_id = u.id AND n.deleted_at IS NULL)
+		FROM users u
+		WHERE u.id = ?
+	`, userID).Scan(&counts.Active, &counts.Trashed, &counts.Shared)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: query row: %w", op, err)
+	}
+	return &counts, nil
+}
+
+// DeleteUser deletes a user; the foreign keys cascade to everything they own.
+func (s *Storage) DeleteUser(ctx context.Context, userID int) error {
+	const op = "storage.sqlite.DeleteUser"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: begin tx: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var role string
+	err = tx.QueryRowContext(ctx, "SELECT role FROM users WHERE id=?", userID).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("%s: query row: %w", op, err)
+	}
+	last, err := isLastAdmin(ctx, tx, userID)
+	if err != nil {
+		return fmt.Errorf("%s: count admins: %w", op, err)
+	}
+	if last {
+		return storage.ErrLastAdmin
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM users WHERE id=?", userID); err != nil {
+		return fmt.Errorf("%s: delete user: %w", op, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: commit: %w", op, err)
+	}
+	return nil
+}
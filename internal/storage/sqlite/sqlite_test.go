@@ -0,0 +1,66 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"notes/internal/config"
+	"notes/internal/migrator"
+	"notes/internal/storage"
+	"notes/internal/storage/storagetest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestStore(t testing.TB, opts storage.Options) *Storage {
+	t.Helper()
+	s, err := New(filepath.Join(t.TempDir(), "notes.db"), opts)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	m, err := migrator.New(slog.New(slog.DiscardHandler), s.db, config.StorageDriverSQLite)
+	if err != nil {
+		t.Fatalf("migrator: %v", err)
+	}
+	if err := m.Up(context.Background()); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return s
+}
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		s := newTestStore(t, storage.Options{})
+		if err := s.Prepare(t.Context()); err != nil {
+			t.Fatalf("prepare: %v", err)
+		}
+		return s
+	})
+}
+
+func BenchmarkStore(b *testing.B) {
+	for _, conns := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("conns=%d", conns), func(b *testing.B) {
+			storagetest.Bench(b, func(b *testing.B) storage.Store {
+				return newTestStore(b, storage.Options{MaxOpenConns: conns, MaxIdleConns: conns})
+			})
+		})
+	}
+}
+
+func TestContextCancellation(t *testing.T) {
+	s := newTestStore(t, storage.Options{QueryTimeout: time.Nanosecond})
+	if _, err := s.GetUserByUsername(t.Context(), "alice"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("query timeout: got error %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	s = newTestStore(t, storage.Options{})
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if _, err := s.GetUserByUsername(ctx, "alice"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled context: got error %v, want %v", err, context.Canceled)
+	}
+}
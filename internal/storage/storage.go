@@ -1,6 +1,11 @@
 package storage
 
-import "errors"
+import (
+	"errors"
+	"html"
+	"strings"
+	"time"
+)
 
 var (
 	ErrNoteNotFound = errors.New("note not found")
@@ -8,4 +13,109 @@ var (
 	ErrUserNotFound = errors.New("user not found")
 	ErrUserExists   = errors.New("user already exists")
 	ErrForbidden    = errors.New("forbidden access")
+	ErrLastAdmin    = errors.New("last admin cannot be removed")
+
+	ErrVersionMismatch = errors.New("note version mismatch")
+
+	ErrRevisionNotFound = errors.New("revision not found")
+	ErrNotebookNotFound = errors.New("notebook not found")
+	ErrNotebookCycle    = errors.New("notebook cannot be nested into itself")
+	ErrShareNotFound    = errors.New("share not found")
+	ErrShareWithOwner   = errors.New("note cannot be shared with its owner")
+
+	ErrLinkNotFound         = errors.New("link not found")
+	ErrLinkExpired          = errors.New("link expired")
+	ErrLinkPasswordRequired = errors.New("link password required")
+	ErrInvalidLinkPassword  = errors.New("invalid link password")
+
+	ErrTokenNotFound = errors.New("refresh token not found")
+	ErrTokenExpired  = errors.New("refresh token expired")
+	ErrTokenRevoked  = errors.New("refresh token revoked")
+	ErrTokenReused   = errors.New("refresh token reused")
 )
+
+// Options tune the database-backed stores.
+type Options struct {
+	// QueryTimeout bounds every storage call; zero means no timeout.
+	QueryTimeout time.Duration
+
+	// Connection pool settings; zero values keep the database/sql defaults.
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// NoteFilter narrows down the notes returned by a listing. Zero fields do not filter.
+type NoteFilter struct {
+	NotebookID    *int
+	Tags          []string
+	MatchAllTags  bool
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	UpdatedSince  *time.Time
+	TitlePrefix   string
+	HasContent    *bool
+}
+
+// NotePatch holds the fields of a partial note update; nil fields are left untouched.
+type NotePatch struct {
+	Title   *string
+	Content *string
+	Tags    *[]string
+}
+
+// NormalizeTags trims and lowercases tag names and drops empty and duplicate ones.
+func NormalizeTags(tags []string) []string {
+	res := make([]string, 0, len(tags))
+	seen := make(map[string]struct{}, len(tags))
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" {
+			continue
+		}
+		if _, ok := seen[t]; ok {
+			continue
+		}
+		seen[t] = struct{}{}
+		res = append(res, t)
+	}
+	return res
+}
+
+// The search backends delimit the matches in highlights and snippets with
+// these control characters rather than with HTML, as the note text around
+// them is not escaped yet. MarkMatches turns them into <mark> tags.
+const (
+	MatchStart = "\x02"
+	MatchStop  = "\x03"
+)
+
+// MarkMatches HTML-escapes text delimited with MatchStart and MatchStop and
+// wraps the matches in <mark> tags, so the result is safe to render as HTML
+// whatever the note contains. Unpaired markers are dropped.
+func MarkMatches(text string) string {
+	var b strings.Builder
+	open := false
+	for {
+		i := strings.IndexAny(text, MatchStart+MatchStop)
+		if i < 0 {
+			break
+		}
+		b.WriteString(html.EscapeString(text[:i]))
+		switch {
+		case text[i:i+1] == MatchStart && !open:
+			b.WriteString("<mark>")
+			open = true
+		case text[i:i+1] == MatchStop && open:
+			b.WriteString("</mark>")
+			open = false
+		}
+		text = text[i+1:]
+	}
+	b.WriteString(html.EscapeString(text))
+	if open {
+		b.WriteString("</mark>")
+	}
+	return b.String()
+}
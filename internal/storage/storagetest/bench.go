@@ -0,0 +1,109 @@
+package storagetest
+
+import (
+	"context"
+	"fmt"
+	"notes/internal/storage"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// preparer is implemented by the stores that prepare the statements of their
+// hot queries up front.
+type preparer interface {
+	Prepare(ctx context.Context) error
+}
+
+// Bench measures the hot paths of a store under concurrent load: the reads
+// behind every authenticated request and login, and note creation. Each runs
+// with statements prepared per call (stmts=per-call) and, for stores that
+// can, prepared up front (stmts=prepared); compare the two, or runs before
+// and after a pool change, with benchstat, e.g. benchstat -col /stmts.
+// newStore must return an empty store that was not prepared for every call.
+func Bench(b *testing.B, newStore func(b *testing.B) storage.Store) {
+	b.Run("stmts=per-call", func(b *testing.B) {
+		bench(b, newStore)
+	})
+	b.Run("stmts=prepared", func(b *testing.B) {
+		bench(b, func(b *testing.B) storage.Store {
+			s := newStore(b)
+			p, ok := s.(preparer)
+			if !ok {
+				b.Skip("store has no prepared statements")
+			}
+			if err := p.Prepare(b.Context()); err != nil {
+				b.Fatalf("Prepare: %v", err)
+			}
+			return s
+		})
+	})
+}
+
+func bench(b *testing.B, newStore func(b *testing.B) storage.Store) {
+	b.Run("IsSessionActive", func(b *testing.B) {
+		s := newStore(b)
+		alice := NewUser(b, s, "alice")
+		if err := s.SaveRefreshToken(b.Context(), alice, "session", "token", time.Now().Add(time.Hour)); err != nil {
+			b.Fatalf("SaveRefreshToken: %v", err)
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := s.IsSessionActive(b.Context(), "session"); err != nil {
+					b.Errorf("IsSessionActive: %v", err)
+					return
+				}
+			}
+		})
+	})
+
+	b.Run("GetUserByUsername", func(b *testing.B) {
+		s := newStore(b)
+		NewUser(b, s, "alice")
+		b.ReportAllocs()
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := s.GetUserByUsername(b.Context(), "alice"); err != nil {
+					b.Errorf("GetUserByUsername: %v", err)
+					return
+				}
+			}
+		})
+	})
+
+	b.Run("GetNote", func(b *testing.B) {
+		s := newStore(b)
+		alice := NewUser(b, s, "alice")
+		noteID := NewNote(b, s, alice, "note", "content", "go", "sql")
+		b.ReportAllocs()
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := s.GetNote(b.Context(), alice, noteID); err != nil {
+					b.Errorf("GetNote: %v", err)
+					return
+				}
+			}
+		})
+	})
+
+	b.Run("SaveNote", func(b *testing.B) {
+		s := newStore(b)
+		alice := NewUser(b, s, "alice")
+		var seq atomic.Int64
+		b.ReportAllocs()
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				title := fmt.Sprintf("note %d", seq.Add(1))
+				if err := s.SaveNote(b.Context(), alice, title, "content", []string{"go"}); err != nil {
+					b.Errorf("SaveNote: %v", err)
+					return
+				}
+			}
+		})
+	})
+}
@@ -0,0 +1,894 @@
+// Package storagetest holds the conformance suite every storage.Store
+// implementation has to pass.
+package storagetest
+
+import (
+	"errors"
+	"notes/internal/models"
+	"notes/internal/storage"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Run runs the suite. newStore must return an empty store for every call.
+func Run(t *testing.T, newStore func(t *testing.T) storage.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s storage.Store)
+	}{
+		{"Users", testUsers},
+		{"Notes", testNotes},
+		{"Versions", testVersions},
+		{"Pagination", testPagination},
+		{"Filters", testFilters},
+		{"Tags", testTags},
+		{"Search", testSearch},
+		{"Revisions", testRevisions},
+		{"Trash", testTrash},
+		{"Notebooks", testNotebooks},
+		{"Shares", testShares},
+		{"Links", testLinks},
+		{"RefreshTokens", testRefreshTokens},
+		{"Admin", testAdmin},
+		{"LastAdmin", testLastAdmin},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+// NewUser saves a user with the password "secret" and returns their id.
+func NewUser(t testing.TB, s storage.Store, username string) int {
+	t.Helper()
+	id, err := s.SaveUser(t.Context(), username, "secret")
+	if err != nil {
+		t.Fatalf("SaveUser(%q): %v", username, err)
+	}
+	return id
+}
+
+// NewNote saves a note and returns its id, which SaveNote does not report.
+func NewNote(t testing.TB, s storage.Store, userID int, title, content string, tags ...string) int {
+	t.Helper()
+	if err := s.SaveNote(t.Context(), userID, title, content, tags); err != nil {
+		t.Fatalf("SaveNote(%q): %v", title, err)
+	}
+	page, err := s.GetAllNotes(t.Context(), userID, storage.PageRequest{Limit: 1, SortBy: storage.SortByCreatedAt, Sort: storage.SortDesc}, storage.NoteFilter{})
+	if err != nil {
+		t.Fatalf("GetAllNotes: %v", err)
+	}
+	if len(page.Notes) != 1 || page.Notes[0].Title != title {
+		t.Fatalf("saved note %q not found", title)
+	}
+	return page.Notes[0].ID
+}
+
+func mustGetNote(t *testing.T, s storage.Store, userID, noteID int) *models.Note {
+	t.Helper()
+	n, err := s.GetNote(t.Context(), userID, noteID)
+	if err != nil {
+		t.Fatalf("GetNote(%d): %v", noteID, err)
+	}
+	return n
+}
+
+func wantErr(t *testing.T, what string, got, want error) {
+	t.Helper()
+	if !errors.Is(got, want) {
+		t.Fatalf("%s: got error %v, want %v", what, got, want)
+	}
+}
+
+func noErr(t *testing.T, what string, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %v", what, err)
+	}
+}
+
+func titles(notes []models.Note) []string {
+	res := make([]string, 0, len(notes))
+	for _, n := range notes {
+		res = append(res, n.Title)
+	}
+	return res
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func testUsers(t *testing.T, s storage.Store) {
+	id := NewUser(t, s, "alice")
+	_, err := s.SaveUser(t.Context(), "alice", "other")
+	wantErr(t, "duplicate SaveUser", err, storage.ErrUserExists)
+
+	u, err := s.GetUserByUsername(t.Context(), "alice")
+	noErr(t, "GetUserByUsername", err)
+	if u.ID != id || u.Username != "alice" {
+		t.Fatalf("got user %+v, want id %d", u, id)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte("secret")); err != nil {
+		t.Fatalf("stored password does not match: %v", err)
+	}
+	_, err = s.GetUserByUsername(t.Context(), "nobody")
+	wantErr(t, "GetUserByUsername", err, storage.ErrUserNotFound)
+}
+
+func testNotes(t *testing.T, s storage.Store) {
+	alice := NewUser(t, s, "alice")
+	bob := NewUser(t, s, "bob")
+	id := NewNote(t, s, alice, "groceries", "milk", "home", "errands", "home")
+
+	n := mustGetNote(t, s, alice, id)
+	if n.UserID != alice || n.Content != "milk" || n.Version != 1 || n.NotebookID != nil {
+		t.Fatalf("unexpected note %+v", n)
+	}
+	if !slices.Equal(n.Tags, []string{"errands", "home"}) {
+		t.Fatalf("got tags %v, want sorted distinct tags", n.Tags)
+	}
+
+	_, err := s.GetNote(t.Context(), bob, id)
+	wantErr(t, "GetNote by stranger", err, storage.ErrNoteNotFound)
+	_, err = s.GetNote(t.Context(), alice, id+1000)
+	wantErr(t, "GetNote missing", err, storage.ErrNoteNotFound)
+	_, err = s.UpdateNote(t.Context(), id, bob, "x", "y", nil, 0)
+	wantErr(t, "UpdateNote by stranger", err, storage.ErrForbidden)
+	wantErr(t, "DeleteNote by stranger", s.DeleteNote(t.Context(), id, bob), storage.ErrForbidden)
+
+	version, err := s.UpdateNote(t.Context(), id, alice, "shopping", "eggs", []string{"home"}, 0)
+	noErr(t, "UpdateNote", err)
+	n = mustGetNote(t, s, alice, id)
+	if version != 2 || n.Version != 2 || n.Title != "shopping" || n.Content != "eggs" || !slices.Equal(n.Tags, []string{"home"}) {
+		t.Fatalf("update not applied: version %d, note %+v", version, n)
+	}
+	if n.UpdatedAt.Before(n.CreatedAt) {
+		t.Fatalf("updated_at %v before created_at %v", n.UpdatedAt, n.CreatedAt)
+	}
+
+	version, err = s.PatchNote(t.Context(), id, alice, storage.NotePatch{Content: ptr("bread")}, 0)
+	noErr(t, "PatchNote", err)
+	n = mustGetNote(t, s, alice, id)
+	if version != 3 || n.Title != "shopping" || n.Content != "bread" || !slices.Equal(n.Tags, []string{"home"}) {
+		t.Fatalf("patch not applied to content only: version %d, note %+v", version, n)
+	}
+	_, err = s.PatchNote(t.Context(), id, alice, storage.NotePatch{Tags: &[]string{}}, 0)
+	noErr(t, "PatchNote tags", err)
+	if n := mustGetNote(t, s, alice, id); len(n.Tags) != 0 || n.Content != "bread" {
+		t.Fatalf("tags not cleared: %+v", n)
+	}
+
+	noErr(t, "DeleteNote", s.DeleteNote(t.Context(), id, alice))
+	_, err = s.GetNote(t.Context(), alice, id)
+	wantErr(t, "GetNote trashed", err, storage.ErrNoteNotFound)
+	wantErr(t, "DeleteNote twice", s.DeleteNote(t.Context(), id, alice), storage.ErrNoteNotFound)
+	_, err = s.UpdateNote(t.Context(), id, alice, "x", "y", nil, 0)
+	wantErr(t, "UpdateNote trashed", err, storage.ErrNoteNotFound)
+}
+
+func testVersions(t *testing.T, s storage.Store) {
+	alice := NewUser(t, s, "alice")
+	id := NewNote(t, s, alice, "draft", "v1")
+
+	version, err := s.UpdateNote(t.Context(), id, alice, "draft", "v2", nil, 1)
+	noErr(t, "UpdateNote at version 1", err)
+	if version != 2 {
+		t.Fatalf("got version %d, want 2", version)
+	}
+	version, err = s.UpdateNote(t.Context(), id, alice, "draft", "stale", nil, 1)
+	wantErr(t, "UpdateNote at stale version", err, storage.ErrVersionMismatch)
+	if version != 2 {
+		t.Fatalf("mismatch reported version %d, want current version 2", version)
+	}
+	_, err = s.PatchNote(t.Context(), id, alice, storage.NotePatch{Title: ptr("stale")}, 1)
+	wantErr(t, "PatchNote at stale version", err, storage.ErrVersionMismatch)
+	if n := mustGetNote(t, s, alice, id); n.Content != "v2" || n.Title != "draft" {
+		t.Fatalf("stale write was applied: %+v", n)
+	}
+
+	notebookID, err := s.SaveNotebook(t.Context(), alice, "inbox", nil)
+	noErr(t, "SaveNotebook", err)
+	noErr(t, "MoveNote", s.MoveNote(t.Context(), alice, id, &notebookID))
+	if n := mustGetNote(t, s, alice, id); n.Version != 3 {
+		t.Fatalf("MoveNote left version at %d, want 3", n.Version)
+	}
+}
+
+// collect walks a listing forward from the first page and returns all titles.
+func collect(t *testing.T, s storage.Store, userID int, page storage.PageRequest, filter storage.NoteFilter) []string {
+	t.Helper()
+	var res []string
+	for i := 0; ; i++ {
+		if i > 100 {
+			t.Fatal("pagination does not terminate")
+		}
+		p, err := s.GetAllNotes(t.Context(), userID, page, filter)
+		noErr(t, "GetAllNotes", err)
+		res = append(res, titles(p.Notes)...)
+		if p.Next == nil {
+			return res
+		}
+		page.Cursor = p.Next
+	}
+}
+
+func testPagination(t *testing.T, s storage.Store) {
+	alice := NewUser(t, s, "alice")
+	bob := NewUser(t, s, "bob")
+	NewNote(t, s, bob, "foreign", "")
+
+	page := storage.PageRequest{Limit: 2, SortBy: storage.SortByCreatedAt, Sort: storage.SortDesc, WithTotal: true}
+	empty, err := s.GetAllNotes(t.Context(), alice, page, storage.NoteFilter{})
+	noErr(t, "GetAllNotes empty", err)
+	if empty.Notes == nil || len(empty.Notes) != 0 || empty.Next != nil || empty.Prev != nil || empty.Total == nil || *empty.Total != 0 {
+		t.Fatalf("empty listing: %+v", empty)
+	}
+
+	want := []string{"e", "d", "c", "b", "a"}
+	for i := len(want) - 1; i >= 0; i-- {
+		NewNote(t, s, alice, want[i], "")
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	first, err := s.GetAllNotes(t.Context(), alice, page, storage.NoteFilter{})
+	noErr(t, "GetAllNotes", err)
+	if !slices.Equal(titles(first.Notes), want[:2]) || first.Prev != nil || first.Next == nil {
+		t.Fatalf("first page: %v, prev %v, next %v", titles(first.Notes), first.Prev, first.Next)
+	}
+	if first.Total == nil || *first.Total != 5 {
+		t.Fatalf("total: %v, want 5", first.Total)
+	}
+	if got := collect(t, s, alice, page, storage.NoteFilter{}); !slices.Equal(got, want) {
+		t.Fatalf("desc listing: %v, want %v", got, want)
+	}
+
+	page.Cursor = first.Next
+	second, err := s.GetAllNotes(t.Context(), alice, page, storage.NoteFilter{})
+	noErr(t, "GetAllNotes second page", err)
+	if !slices.Equal(titles(second.Notes), want[2:4]) || second.Prev == nil {
+		t.Fatalf("second page: %v, prev %v", titles(second.Notes), second.Prev)
+	}
+	page.Cursor = second.Prev
+	back, err := s.GetAllNotes(t.Context(), alice, page, storage.NoteFilter{})
+	noErr(t, "GetAllNotes backward", err)
+	if !slices.Equal(titles(back.Notes), want[:2]) || back.Prev != nil || back.Next == nil {
+		t.Fatalf("page before second: %v, prev %v, next %v", titles(back.Notes), back.Prev, back.Next)
+	}
+	for _, key := range []string{"garbage", "", "2025-13-01T00:00:00Z"} {
+		page.Cursor = &storage.Cursor{Key: key, ID: 1, SortBy: page.SortBy, Sort: page.Sort}
+		_, err = s.GetAllNotes(t.Context(), alice, page, storage.NoteFilter{})
+		wantErr(t, "GetAllNotes with cursor key "+strconv.Quote(key), err, storage.ErrInvalidCursor)
+	}
+
+	asc := storage.PageRequest{Limit: 2, SortBy: storage.SortByTitle, Sort: storage.SortAsc}
+	if got := collect(t, s, alice, asc, storage.NoteFilter{}); !slices.Equal(got, []string{"a", "b", "c", "d", "e"}) {
+		t.Fatalf("title listing: %v", got)
+	}
+
+	// Touch "a" so it becomes the most recently updated note.
+	_, err = s.PatchNote(t.Context(), newestByTitle(t, s, alice, "a"), alice, storage.NotePatch{Content: ptr("touched")}, 0)
+	noErr(t, "PatchNote", err)
+	updated := storage.PageRequest{Limit: 1, SortBy: storage.SortByUpdatedAt, Sort: storage.SortDesc}
+	p, err := s.GetAllNotes(t.Context(), alice, updated, storage.NoteFilter{})
+	noErr(t, "GetAllNotes by updated_at", err)
+	if !slices.Equal(titles(p.Notes), []string{"a"}) {
+		t.Fatalf("most recently updated: %v, want [a]", titles(p.Notes))
+	}
+}
+
+func newestByTitle(t *testing.T, s storage.Store, userID int, title string) int {
+	t.Helper()
+	p, err := s.GetAllNotes(t.Context(), userID, storage.PageRequest{Limit: 100, SortBy: storage.SortByCreatedAt, Sort: storage.SortDesc}, storage.NoteFilter{})
+	noErr(t, "GetAllNotes", err)
+	for _, n := range p.Notes {
+		if n.Title == title {
+			return n.ID
+		}
+	}
+	t.Fatalf("note %q not found", title)
+	return 0
+}
+
+func testFilters(t *testing.T, s storage.Store) {
+	alice := NewUser(t, s, "alice")
+	NewNote(t, s, alice, "report q1", "numbers", "work", "finance")
+	NewNote(t, s, alice, "report q2", "", "work")
+	time.Sleep(2 * time.Millisecond)
+	mid := time.Now()
+	time.Sleep(2 * time.Millisecond)
+	NewNote(t, s, alice, "holiday_plan", "beach", "home")
+	trashed := NewNote(t, s, alice, "old report", "x", "work")
+	noErr(t, "DeleteNote", s.DeleteNote(t.Context(), trashed, alice))
+
+	notebookID, err := s.SaveNotebook(t.Context(), alice, "travel", nil)
+	noErr(t, "SaveNotebook", err)
+	noErr(t, "MoveNote", s.MoveNote(t.Context(), alice, newestByTitle(t, s, alice, "holiday_plan"), &notebookID))
+
+	page := storage.PageRequest{Limit: 10, SortBy: storage.SortByTitle, Sort: storage.SortAsc}
+	tests := []struct {
+		name   string
+		filter storage.NoteFilter
+		want   []string
+	}{
+		{"none", storage.NoteFilter{}, []string{"holiday_plan", "report q1", "report q2"}},
+		{"any tag", storage.NoteFilter{Tags: []string{"finance", "home"}}, []string{"holiday_plan", "report q1"}},
+		{"all tags", storage.NoteFilter{Tags: []string{"work", "finance"}, MatchAllTags: true}, []string{"report q1"}},
+		{"notebook", storage.NoteFilter{NotebookID: &notebookID}, []string{"holiday_plan"}},
+		{"created after", storage.NoteFilter{CreatedAfter: &mid}, []string{"holiday_plan"}},
+		{"created before", storage.NoteFilter{CreatedBefore: &mid}, []string{"report q1", "report q2"}},
+		{"updated since", storage.NoteFilter{UpdatedSince: &mid}, []string{"holiday_plan"}},
+		{"title prefix", storage.NoteFilter{TitlePrefix: "REPORT"}, []string{"report q1", "report q2"}},
+		{"title prefix wildcard", storage.NoteFilter{TitlePrefix: "holiday%"}, []string{}},
+		{"title prefix underscore", storage.NoteFilter{TitlePrefix: "holiday_"}, []string{"holiday_plan"}},
+		{"has content", storage.NoteFilter{HasContent: ptr(true)}, []string{"holiday_plan", "report q1"}},
+		{"without content", storage.NoteFilter{HasContent: ptr(false)}, []string{"report q2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := s.GetAllNotes(t.Context(), alice, page, tt.filter)
+			noErr(t, "GetAllNotes", err)
+			if got := titles(p.Notes); !slices.Equal(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func testTags(t *testing.T, s storage.Store) {
+	alice := NewUser(t, s, "alice")
+	bob := NewUser(t, s, "bob")
+	NewNote(t, s, alice, "a", "", "work", "urgent")
+	NewNote(t, s, alice, "b", "", "work")
+	trashed := NewNote(t, s, alice, "c", "", "work", "later")
+	noErr(t, "DeleteNote", s.DeleteNote(t.Context(), trashed, alice))
+	NewNote(t, s, bob, "d", "", "private")
+
+	tags, err := s.GetTags(t.Context(), alice)
+	noErr(t, "GetTags", err)
+	want := []models.Tag{{Name: "urgent", NoteCount: 1}, {Name: "work", NoteCount: 2}}
+	if !slices.Equal(tags, want) {
+		t.Fatalf("got tags %v, want %v", tags, want)
+	}
+	tags, err = s.GetTags(t.Context(), NewUser(t, s, "carol"))
+	noErr(t, "GetTags", err)
+	if tags == nil || len(tags) != 0 {
+		t.Fatalf("got tags %v for a user without notes", tags)
+	}
+}
+
+func testSearch(t *testing.T, s storage.Store) {
+	alice := NewUser(t, s, "alice")
+	bob := NewUser(t, s, "bob")
+	NewNote(t, s, alice, "meeting notes", "discussed the budget for next year")
+	NewNote(t, s, alice, "budget", "budget draft and budget review")
+	NewNote(t, s, alice, "recipes", "pancakes")
+	NewNote(t, s, alice, "<b>snacks</b>", `crisps <img src=x onerror="alert(1)"> & snacks`)
+	NewNote(t, s, bob, "budget", "not visible to alice")
+
+	results, err := s.SearchNotes(t.Context(), alice, "budget", 10, 0)
+	noErr(t, "SearchNotes", err)
+	if len(results) != 2 || results[0].Title != "budget" || results[1].Title != "meeting notes" {
+		t.Fatalf("got results %v", results)
+	}
+	if results[0].Rank < results[1].Rank {
+		t.Fatalf("results not ranked: %v then %v", results[0].Rank, results[1].Rank)
+	}
+	if results[0].TitleHighlight != "<mark>budget</mark>" {
+		t.Fatalf("got title highlight %q", results[0].TitleHighlight)
+	}
+
+	// Highlights are HTML, so the note text around the marks is escaped.
+	results, err = s.SearchNotes(t.Context(), alice, "snacks", 10, 0)
+	noErr(t, "SearchNotes", err)
+	if len(results) != 1 {
+		t.Fatalf("got results %v", results)
+	}
+	for _, h := range []string{results[0].TitleHighlight, results[0].Snippet} {
+		if strings.ContainsAny(strings.NewReplacer("<mark>", "", "</mark>", "").Replace(h), `<>"`) || !strings.Contains(h, "<mark>snacks</mark>") {
+			t.Fatalf("highlight not escaped: %q", h)
+		}
+	}
+
+	results, err = s.SearchNotes(t.Context(), alice, "budget", 1, 1)
+	noErr(t, "SearchNotes with offset", err)
+	if len(results) != 1 || results[0].Title != "meeting notes" {
+		t.Fatalf("second result page: %v", results)
+	}
+	results, err = s.SearchNotes(t.Context(), alice, "budget pancakes", 10, 0)
+	noErr(t, "SearchNotes", err)
+	if len(results) != 0 {
+		t.Fatalf("notes matching only some words were returned: %v", results)
+	}
+}
+
+func testRevisions(t *testing.T, s storage.Store) {
+	alice := NewUser(t, s, "alice")
+	bob := NewUser(t, s, "bob")
+	id := NewNote(t, s, alice, "title", "first")
+
+	revs, err := s.GetRevisions(t.Context(), alice, id)
+	noErr(t, "GetRevisions", err)
+	if revs == nil || len(revs) != 0 {
+		t.Fatalf("new note has revisions %v", revs)
+	}
+
+	_, err = s.UpdateNote(t.Context(), id, alice, "title", "second", nil, 0)
+	noErr(t, "UpdateNote", err)
+	_, err = s.PatchNote(t.Context(), id, alice, storage.NotePatch{Tags: &[]string{"x"}}, 0)
+	noErr(t, "PatchNote tags", err)
+	_, err = s.PatchNote(t.Context(), id, alice, storage.NotePatch{Content: ptr("third")}, 0)
+	noErr(t, "PatchNote", err)
+
+	revs, err = s.GetRevisions(t.Context(), alice, id)
+	noErr(t, "GetRevisions", err)
+	if len(revs) != 2 || revs[0].Revision != 2 || revs[0].Content != "second" || revs[1].Content != "first" {
+		t.Fatalf("got revisions %+v", revs)
+	}
+	rev, err := s.GetRevision(t.Context(), alice, id, 1)
+	noErr(t, "GetRevision", err)
+	if rev.NoteID != id || rev.Content != "first" {
+		t.Fatalf("got revision %+v", rev)
+	}
+	_, err = s.GetRevision(t.Context(), alice, id, 9)
+	wantErr(t, "GetRevision missing", err, storage.ErrRevisionNotFound)
+	_, err = s.GetRevisions(t.Context(), bob, id)
+	wantErr(t, "GetRevisions by stranger", err, storage.ErrNoteNotFound)
+
+	noErr(t, "RestoreRevision", s.RestoreRevision(t.Context(), alice, id, 1))
+	n := mustGetNote(t, s, alice, id)
+	if n.Content != "first" || n.Version != 5 {
+		t.Fatalf("restored note %+v", n)
+	}
+	revs, err = s.GetRevisions(t.Context(), alice, id)
+	noErr(t, "GetRevisions", err)
+	if len(revs) != 3 || revs[0].Content != "third" {
+		t.Fatalf("restore did not keep the replaced content: %+v", revs)
+	}
+	wantErr(t, "RestoreRevision missing", s.RestoreRevision(t.Context(), alice, id, 9), storage.ErrRevisionNotFound)
+	wantErr(t, "RestoreRevision by stranger", s.RestoreRevision(t.Context(), bob, id, 1), storage.ErrForbidden)
+}
+
+func testTrash(t *testing.T, s storage.Store) {
+	alice := NewUser(t, s, "alice")
+	bob := NewUser(t, s, "bob")
+	first := NewNote(t, s, alice, "first", "")
+	second := NewNote(t, s, alice, "second", "")
+	kept := NewNote(t, s, alice, "kept", "")
+
+	noErr(t, "DeleteNote", s.DeleteNote(t.Context(), first, alice))
+	time.Sleep(2 * time.Millisecond)
+	noErr(t, "DeleteNote", s.DeleteNote(t.Context(), second, alice))
+
+	trash, err := s.GetTrash(t.Context(), alice)
+	noErr(t, "GetTrash", err)
+	if !slices.Equal(titles(trash), []string{"second", "first"}) || trash[0].DeletedAt == nil {
+		t.Fatalf("got trash %v", titles(trash))
+	}
+	trash, err = s.GetTrash(t.Context(), bob)
+	noErr(t, "GetTrash", err)
+	if trash == nil || len(trash) != 0 {
+		t.Fatalf("got trash %v for bob", titles(trash))
+	}
+
+	wantErr(t, "RestoreNote by stranger", s.RestoreNote(t.Context(), bob, first), storage.ErrNoteNotFound)
+	wantErr(t, "RestoreNote active", s.RestoreNote(t.Context(), alice, kept), storage.ErrNoteNotFound)
+	noErr(t, "RestoreNote", s.RestoreNote(t.Context(), alice, first))
+	mustGetNote(t, s, alice, first)
+
+	wantErr(t, "PurgeNote active", s.PurgeNote(t.Context(), alice, kept), storage.ErrNoteNotFound)
+	noErr(t, "PurgeNote", s.PurgeNote(t.Context(), alice, second))
+	wantErr(t, "RestoreNote purged", s.RestoreNote(t.Context(), alice, second), storage.ErrNoteNotFound)
+
+	noErr(t, "DeleteNote", s.DeleteNote(t.Context(), kept, alice))
+	n, err := s.PurgeTrash(t.Context(), time.Now().Add(-time.Hour))
+	noErr(t, "PurgeTrash", err)
+	if n != 0 {
+		t.Fatalf("purged %d notes trashed within retention", n)
+	}
+	n, err = s.PurgeTrash(t.Context(), time.Now().Add(time.Hour))
+	noErr(t, "PurgeTrash", err)
+	if n != 1 {
+		t.Fatalf("purged %d notes, want 1", n)
+	}
+	wantErr(t, "RestoreNote purged", s.RestoreNote(t.Context(), alice, kept), storage.ErrNoteNotFound)
+}
+
+func testNotebooks(t *testing.T, s storage.Store) {
+	alice := NewUser(t, s, "alice")
+	bob := NewUser(t, s, "bob")
+
+	root, err := s.SaveNotebook(t.Context(), alice, "work", nil)
+	noErr(t, "SaveNotebook", err)
+	child, err := s.SaveNotebook(t.Context(), alice, "projects", &root)
+	noErr(t, "SaveNotebook child", err)
+	grandchild, err := s.SaveNotebook(t.Context(), alice, "archive", &child)
+	noErr(t, "SaveNotebook grandchild", err)
+	_, err = s.SaveNotebook(t.Context(), bob, "stolen", &root)
+	wantErr(t, "SaveNotebook under foreign parent", err, storage.ErrNotebookNotFound)
+
+	nbs, err := s.GetNotebooks(t.Context(), alice)
+	noErr(t, "GetNotebooks", err)
+	var names []string
+	for _, nb := range nbs {
+		names = append(names, nb.Name)
+	}
+	if !slices.Equal(names, []string{"archive", "projects", "work"}) {
+		t.Fatalf("got notebooks %v", names)
+	}
+	nb, err := s.GetNotebook(t.Context(), alice, child)
+	noErr(t, "GetNotebook", err)
+	if nb.ParentID == nil || *nb.ParentID != root || nb.UserID != alice {
+		t.Fatalf("got notebook %+v", nb)
+	}
+	_, err = s.GetNotebook(t.Context(), bob, child)
+	wantErr(t, "GetNotebook by stranger", err, storage.ErrNotebookNotFound)
+
+	wantErr(t, "UpdateNotebook into itself", s.UpdateNotebook(t.Context(), alice, root, "work", &root), storage.ErrNotebookCycle)
+	wantErr(t, "UpdateNotebook into descendant", s.UpdateNotebook(t.Context(), alice, root, "work", &grandchild), storage.ErrNotebookCycle)
+	wantErr(t, "UpdateNotebook by stranger", s.UpdateNotebook(t.Context(), bob, root, "x", nil), storage.ErrNotebookNotFound)
+	noErr(t, "UpdateNotebook", s.UpdateNotebook(t.Context(), alice, grandchild, "old", &root))
+	nb, err = s.GetNotebook(t.Context(), alice, grandchild)
+	noErr(t, "GetNotebook", err)
+	if nb.Name != "old" || nb.ParentID == nil || *nb.ParentID != root {
+		t.Fatalf("notebook not updated: %+v", nb)
+	}
+
+	inRoot := NewNote(t, s, alice, "in root", "")
+	inChild := NewNote(t, s, alice, "in child", "")
+	noErr(t, "MoveNote", s.MoveNote(t.Context(), alice, inRoot, &root))
+	noErr(t, "MoveNote", s.MoveNote(t.Context(), alice, inChild, &child))
+	wantErr(t, "MoveNote into foreign notebook", s.MoveNote(t.Context(), bob, NewNote(t, s, bob, "b", ""), &root), storage.ErrNotebookNotFound)
+	wantErr(t, "MoveNote foreign note", s.MoveNote(t.Context(), alice, inRoot+1000, &root), storage.ErrNoteNotFound)
+
+	// Moving to the root keeps the notes and lifts the children one level.
+	noErr(t, "DeleteNotebook", s.DeleteNotebook(t.Context(), alice, child, false))
+	if n := mustGetNote(t, s, alice, inChild); n.NotebookID != nil {
+		t.Fatalf("note left in removed notebook %v", *n.NotebookID)
+	}
+	_, err = s.GetNotebook(t.Context(), alice, child)
+	wantErr(t, "GetNotebook removed", err, storage.ErrNotebookNotFound)
+
+	sub, err := s.SaveNotebook(t.Context(), alice, "sub", &root)
+	noErr(t, "SaveNotebook", err)
+	inSub := NewNote(t, s, alice, "in sub", "")
+	noErr(t, "MoveNote", s.MoveNote(t.Context(), alice, inSub, &sub))
+	noErr(t, "DeleteNotebook recursive", s.DeleteNotebook(t.Context(), alice, root, true))
+	for _, id := range []int{root, sub, grandchild} {
+		_, err = s.GetNotebook(t.Context(), alice, id)
+		wantErr(t, "GetNotebook removed recursively", err, storage.ErrNotebookNotFound)
+	}
+	for _, id := range []int{inRoot, inSub} {
+		_, err = s.GetNote(t.Context(), alice, id)
+		wantErr(t, "GetNote in removed notebook", err, storage.ErrNoteNotFound)
+	}
+	trash, err := s.GetTrash(t.Context(), alice)
+	noErr(t, "GetTrash", err)
+	if len(trash) != 2 {
+		t.Fatalf("got trash %v, want the notes of the removed notebooks", titles(trash))
+	}
+	mustGetNote(t, s, alice, inChild)
+	wantErr(t, "DeleteNotebook missing", s.DeleteNotebook(t.Context(), alice, root, false), storage.ErrNotebookNotFound)
+}
+
+func testShares(t *testing.T, s storage.Store) {
+	alice := NewUser(t, s, "alice")
+	bob := NewUser(t, s, "bob")
+	carol := NewUser(t, s, "carol")
+	id := NewNote(t, s, alice, "plan", "draft")
+
+	wantErr(t, "ShareNote unknown user", s.ShareNote(t.Context(), alice, id, "nobody", models.PermissionRead), storage.ErrUserNotFound)
+	wantErr(t, "ShareNote with owner", s.ShareNote(t.Context(), alice, id, "alice", models.PermissionRead), storage.ErrShareWithOwner)
+	wantErr(t, "ShareNote by stranger", s.ShareNote(t.Context(), bob, id, "carol", models.PermissionRead), storage.ErrNoteNotFound)
+	noErr(t, "ShareNote", s.ShareNote(t.Context(), alice, id, "bob", models.PermissionRead))
+	noErr(t, "ShareNote", s.ShareNote(t.Context(), alice, id, "carol", models.PermissionWrite))
+
+	if n := mustGetNote(t, s, bob, id); n.Title != "plan" {
+		t.Fatalf("shared note: %+v", n)
+	}
+	_, err := s.UpdateNote(t.Context(), id, bob, "plan", "bob was here", nil, 0)
+	wantErr(t, "UpdateNote by reader", err, storage.ErrForbidden)
+	_, err = s.UpdateNote(t.Context(), id, carol, "plan", "carol was here", []string{"shared"}, 0)
+	noErr(t, "UpdateNote by writer", err)
+	if n := mustGetNote(t, s, alice, id); n.Content != "carol was here" || !slices.Equal(n.Tags, []string{"shared"}) {
+		t.Fatalf("writer update not applied: %+v", n)
+	}
+	tags, err := s.GetTags(t.Context(), alice)
+	noErr(t, "GetTags", err)
+	if len(tags) != 1 || tags[0].Name != "shared" {
+		t.Fatalf("collaborator tags do not belong to the owner: %v", tags)
+	}
+	wantErr(t, "DeleteNote by writer", s.DeleteNote(t.Context(), id, carol), storage.ErrForbidden)
+	wantErr(t, "ShareNote by collaborator", s.ShareNote(t.Context(), carol, id, "bob", models.PermissionWrite), storage.ErrForbidden)
+
+	shares, err := s.GetNoteShares(t.Context(), alice, id)
+	noErr(t, "GetNoteShares", err)
+	if len(shares) != 2 || shares[0].Username != "bob" || shares[0].UserID != bob || shares[1].Permission != models.PermissionWrite {
+		t.Fatalf("got shares %+v", shares)
+	}
+	_, err = s.GetNoteShares(t.Context(), bob, id)
+	wantErr(t, "GetNoteShares by collaborator", err, storage.ErrForbidden)
+
+	noErr(t, "ShareNote upgrade", s.ShareNote(t.Context(), alice, id, "bob", models.PermissionWrite))
+	received, err := s.GetSharedNotes(t.Context(), bob)
+	noErr(t, "GetSharedNotes", err)
+	if len(received) != 1 || received[0].ID != id || received[0].Permission != models.PermissionWrite || received[0].OwnerUsername != "alice" {
+		t.Fatalf("got shared notes %+v", received)
+	}
+
+	noErr(t, "UnshareNote", s.UnshareNote(t.Context(), alice, id, bob))
+	wantErr(t, "UnshareNote twice", s.UnshareNote(t.Context(), alice, id, bob), storage.ErrShareNotFound)
+	_, err = s.GetNote(t.Context(), bob, id)
+	wantErr(t, "GetNote after unshare", err, storage.ErrNoteNotFound)
+
+	noErr(t, "DeleteNote", s.DeleteNote(t.Context(), id, alice))
+	received, err = s.GetSharedNotes(t.Context(), carol)
+	noErr(t, "GetSharedNotes", err)
+	if received == nil || len(received) != 0 {
+		t.Fatalf("trashed note still shared: %+v", received)
+	}
+}
+
+func testLinks(t *testing.T, s storage.Store) {
+	alice := NewUser(t, s, "alice")
+	bob := NewUser(t, s, "bob")
+	id := NewNote(t, s, alice, "public", "hello", "news")
+
+	open, err := s.SaveNoteLink(t.Context(), alice, id, "hash-open", "", nil)
+	noErr(t, "SaveNoteLink", err)
+	_, err = s.SaveNoteLink(t.Context(), alice, id, "hash-locked", "pw", nil)
+	noErr(t, "SaveNoteLink with password", err)
+	past := time.Now().Add(-time.Minute)
+	_, err = s.SaveNoteLink(t.Context(), alice, id, "hash-expired", "", &past)
+	noErr(t, "SaveNoteLink expired", err)
+	_, err = s.SaveNoteLink(t.Context(), bob, id, "hash-bob", "", nil)
+	wantErr(t, "SaveNoteLink by stranger", err, storage.ErrNoteNotFound)
+
+	note, err := s.GetPublicNote(t.Context(), "hash-open", "")
+	noErr(t, "GetPublicNote", err)
+	if note.Title != "public" || note.Content != "hello" || !slices.Equal(note.Tags, []string{"news"}) {
+		t.Fatalf("got public note %+v", note)
+	}
+	_, err = s.GetPublicNote(t.Context(), "hash-open", "")
+	noErr(t, "GetPublicNote", err)
+	_, err = s.GetPublicNote(t.Context(), "hash-missing", "")
+	wantErr(t, "GetPublicNote unknown", err, storage.ErrLinkNotFound)
+	_, err = s.GetPublicNote(t.Context(), "hash-expired", "")
+	wantErr(t, "GetPublicNote expired", err, storage.ErrLinkExpired)
+	_, err = s.GetPublicNote(t.Context(), "hash-locked", "")
+	wantErr(t, "GetPublicNote without password", err, storage.ErrLinkPasswordRequired)
+	_, err = s.GetPublicNote(t.Context(), "hash-locked", "wrong")
+	wantErr(t, "GetPublicNote wrong password", err, storage.ErrInvalidLinkPassword)
+	_, err = s.GetPublicNote(t.Context(), "hash-locked", "pw")
+	noErr(t, "GetPublicNote with password", err)
+
+	links, err := s.GetNoteLinks(t.Context(), alice, id)
+	noErr(t, "GetNoteLinks", err)
+	if len(links) != 3 {
+		t.Fatalf("got %d links, want 3", len(links))
+	}
+	for _, l := range links {
+		switch l.ID {
+		case open:
+			if l.ViewCount != 2 || l.HasPassword || l.ExpiresAt != nil {
+				t.Fatalf("open link: %+v", l)
+			}
+		default:
+			if l.HasPassword && l.ViewCount != 1 || !l.HasPassword && l.ExpiresAt == nil {
+				t.Fatalf("link: %+v", l)
+			}
+		}
+	}
+
+	noErr(t, "RevokeNoteLink", s.RevokeNoteLink(t.Context(), alice, id, open))
+	wantErr(t, "RevokeNoteLink twice", s.RevokeNoteLink(t.Context(), alice, id, open), storage.ErrLinkNotFound)
+	_, err = s.GetPublicNote(t.Context(), "hash-open", "")
+	wantErr(t, "GetPublicNote revoked", err, storage.ErrLinkNotFound)
+
+	noErr(t, "DeleteNote", s.DeleteNote(t.Context(), id, alice))
+	_, err = s.GetPublicNote(t.Context(), "hash-locked", "pw")
+	wantErr(t, "GetPublicNote of trashed note", err, storage.ErrLinkNotFound)
+}
+
+func testRefreshTokens(t *testing.T, s storage.Store) {
+	alice := NewUser(t, s, "alice")
+	expires := time.Now().Add(time.Hour)
+	const session, expired, second, third = "session-1", "session-2", "session-3", "session-4"
+	noErr(t, "SaveRefreshToken", s.SaveRefreshToken(t.Context(), alice, session, "t1", expires))
+	active, err := s.IsSessionActive(t.Context(), session)
+	noErr(t, "IsSessionActive", err)
+	if !active {
+		t.Fatal("new session is not active")
+	}
+
+	sess, err := s.RotateRefreshToken(t.Context(), "t1", "t2", expires)
+	noErr(t, "RotateRefreshToken", err)
+	if sess.ID != session || sess.UserID != alice || sess.Username != "alice" {
+		t.Fatalf("got session %+v", sess)
+	}
+	_, err = s.RotateRefreshToken(t.Context(), "missing", "t9", expires)
+	wantErr(t, "RotateRefreshToken unknown", err, storage.ErrTokenNotFound)
+
+	// Presenting t1 again means it leaked: the whole family is revoked.
+	_, err = s.RotateRefreshToken(t.Context(), "t1", "t3", expires)
+	wantErr(t, "RotateRefreshToken reused", err, storage.ErrTokenReused)
+	_, err = s.RotateRefreshToken(t.Context(), "t2", "t4", expires)
+	wantErr(t, "RotateRefreshToken after reuse", err, storage.ErrTokenRevoked)
+	active, err = s.IsSessionActive(t.Context(), session)
+	noErr(t, "IsSessionActive", err)
+	if active {
+		t.Fatal("session still active after token reuse")
+	}
+
+	noErr(t, "SaveRefreshToken", s.SaveRefreshToken(t.Context(), alice, expired, "e1", time.Now().Add(-time.Minute)))
+	_, err = s.RotateRefreshToken(t.Context(), "e1", "e2", expires)
+	wantErr(t, "RotateRefreshToken expired", err, storage.ErrTokenExpired)
+
+	noErr(t, "SaveRefreshToken", s.SaveRefreshToken(t.Context(), alice, second, "s2", expires))
+	noErr(t, "SaveRefreshToken", s.SaveRefreshToken(t.Context(), alice, third, "s3", expires))
+	noErr(t, "RevokeSession", s.RevokeSession(t.Context(), alice, second))
+	if active, _ := s.IsSessionActive(t.Context(), second); active {
+		t.Fatal("revoked session still active")
+	}
+	if active, _ := s.IsSessionActive(t.Context(), third); !active {
+		t.Fatal("RevokeSession revoked another session")
+	}
+	noErr(t, "RevokeAllSessions", s.RevokeAllSessions(t.Context(), alice))
+	if active, _ := s.IsSessionActive(t.Context(), third); active {
+		t.Fatal("session still active after RevokeAllSessions")
+	}
+}
+
+func testAdmin(t *testing.T, s storage.Store) {
+	alice := NewUser(t, s, "alice")
+	bob := NewUser(t, s, "bob")
+	NewUser(t, s, "Alicia")
+	expires := time.Now().Add(time.Hour)
+
+	u, err := s.GetUserByUsername(t.Context(), "alice")
+	noErr(t, "GetUserByUsername", err)
+	if u.Role != models.RoleUser || u.LockedAt != nil {
+		t.Fatalf("new user: %+v", u)
+	}
+	users, err := s.GetUsers(t.Context(), "ALI", 10, 0)
+	noErr(t, "GetUsers", err)
+	if len(users) != 2 || users[0].Username != "alice" || users[1].Username != "Alicia" {
+		t.Fatalf("got users %+v", users)
+	}
+	users, err = s.GetUsers(t.Context(), "", 2, 1)
+	noErr(t, "GetUsers page", err)
+	if len(users) != 2 || users[0].ID != bob {
+		t.Fatalf("got page %+v", users)
+	}
+	users, err = s.GetUsers(t.Context(), "100%", 10, 0)
+	noErr(t, "GetUsers wildcard", err)
+	if len(users) != 0 {
+		t.Fatalf("wildcard matched %+v", users)
+	}
+
+	noErr(t, "SaveRefreshToken", s.SaveRefreshToken(t.Context(), alice, "session-1", "t1", expires))
+	noErr(t, "SetUserRole", s.SetUserRole(t.Context(), alice, models.RoleAdmin))
+	if active, _ := s.IsSessionActive(t.Context(), "session-1"); active {
+		t.Fatal("session still active after role change")
+	}
+	noErr(t, "SaveRefreshToken", s.SaveRefreshToken(t.Context(), alice, "session-2", "t2", expires))
+	sess, err := s.RotateRefreshToken(t.Context(), "t2", "t3", expires)
+	noErr(t, "RotateRefreshToken", err)
+	if sess.Role != models.RoleAdmin {
+		t.Fatalf("session role = %q, want %q", sess.Role, models.RoleAdmin)
+	}
+	wantErr(t, "SetUserRole unknown", s.SetUserRole(t.Context(), 999999, models.RoleAdmin), storage.ErrUserNotFound)
+
+	noErr(t, "SaveRefreshToken", s.SaveRefreshToken(t.Context(), bob, "session-3", "b1", expires))
+	noErr(t, "SetUserLocked", s.SetUserLocked(t.Context(), bob, true))
+	if active, _ := s.IsSessionActive(t.Context(), "session-3"); active {
+		t.Fatal("session still active after lock")
+	}
+	u, err = s.GetUserByUsername(t.Context(), "bob")
+	noErr(t, "GetUserByUsername", err)
+	if u.LockedAt == nil {
+		t.Fatal("locked user has no locked_at")
+	}
+	noErr(t, "SetUserLocked again", s.SetUserLocked(t.Context(), bob, true))
+	noErr(t, "SetUserLocked unlock", s.SetUserLocked(t.Context(), bob, false))
+	u, err = s.GetUserByUsername(t.Context(), "bob")
+	noErr(t, "GetUserByUsername", err)
+	if u.LockedAt != nil {
+		t.Fatalf("unlocked user: %+v", u)
+	}
+	wantErr(t, "SetUserLocked unknown", s.SetUserLocked(t.Context(), 999999, true), storage.ErrUserNotFound)
+
+	shared := NewNote(t, s, bob, "shared", "")
+	NewNote(t, s, bob, "private", "")
+	trashed := NewNote(t, s, bob, "old", "")
+	noErr(t, "ShareNote", s.ShareNote(t.Context(), bob, shared, "alice", models.PermissionRead))
+	noErr(t, "DeleteNote", s.DeleteNote(t.Context(), trashed, bob))
+	counts, err := s.GetNoteCounts(t.Context(), bob)
+	noErr(t, "GetNoteCounts", err)
+	if *counts != (models.NoteCounts{UserID: bob, Active: 2, Trashed: 1, Shared: 1}) {
+		t.Fatalf("got counts %+v", counts)
+	}
+	_, err = s.GetNoteCounts(t.Context(), 999999)
+	wantErr(t, "GetNoteCounts unknown", err, storage.ErrUserNotFound)
+
+	noErr(t, "DeleteUser", s.DeleteUser(t.Context(), bob))
+	wantErr(t, "DeleteUser twice", s.DeleteUser(t.Context(), bob), storage.ErrUserNotFound)
+	_, err = s.GetUserByUsername(t.Context(), "bob")
+	wantErr(t, "GetUserByUsername deleted", err, storage.ErrUserNotFound)
+	received, err := s.GetSharedNotes(t.Context(), alice)
+	noErr(t, "GetSharedNotes", err)
+	if len(received) != 0 {
+		t.Fatalf("notes of deleted user still shared: %+v", received)
+	}
+	_, err = s.GetNote(t.Context(), alice, shared)
+	wantErr(t, "GetNote of deleted user", err, storage.ErrNoteNotFound)
+	NewUser(t, s, "bob")
+}
+
+func testLastAdmin(t *testing.T, s storage.Store) {
+	alice := NewUser(t, s, "alice")
+	bob := NewUser(t, s, "bob")
+	noErr(t, "SetUserRole", s.SetUserRole(t.Context(), alice, models.RoleAdmin))
+
+	wantErr(t, "SetUserRole of last admin", s.SetUserRole(t.Context(), alice, models.RoleUser), storage.ErrLastAdmin)
+	wantErr(t, "DeleteUser of last admin", s.DeleteUser(t.Context(), alice), storage.ErrLastAdmin)
+	noErr(t, "SetUserRole of last admin to admin", s.SetUserRole(t.Context(), alice, models.RoleAdmin))
+	noErr(t, "SetUserRole of user", s.SetUserRole(t.Context(), bob, models.RoleReadOnly))
+
+	// A locked admin cannot log in, so it does not count as an admin left.
+	carol := NewUser(t, s, "carol")
+	noErr(t, "SetUserRole", s.SetUserRole(t.Context(), carol, models.RoleAdmin))
+	noErr(t, "SetUserLocked of admin", s.SetUserLocked(t.Context(), carol, true))
+	wantErr(t, "SetUserLocked of last unlocked admin", s.SetUserLocked(t.Context(), alice, true), storage.ErrLastAdmin)
+	wantErr(t, "SetUserRole of last unlocked admin", s.SetUserRole(t.Context(), alice, models.RoleUser), storage.ErrLastAdmin)
+	wantErr(t, "DeleteUser of last unlocked admin", s.DeleteUser(t.Context(), alice), storage.ErrLastAdmin)
+	noErr(t, "SetUserLocked of locked admin", s.SetUserLocked(t.Context(), carol, true))
+	noErr(t, "SetUserRole of locked admin", s.SetUserRole(t.Context(), carol, models.RoleUser))
+	noErr(t, "SetUserLocked of user", s.SetUserLocked(t.Context(), bob, true))
+	wantErr(t, "SetUserLocked of unknown user", s.SetUserLocked(t.Context(), -1, true), storage.ErrUserNotFound)
+
+	// Two admins locking, demoting or deleting each other at the same time
+	// leave one of them.
+	ops := []struct {
+		name string
+		do   func(id int) error
+	}{
+		{"SetUserLocked", func(id int) error { return s.SetUserLocked(t.Context(), id, true) }},
+		{"SetUserRole", func(id int) error { return s.SetUserRole(t.Context(), id, models.RoleUser) }},
+		{"DeleteUser", func(id int) error { return s.DeleteUser(t.Context(), id) }},
+	}
+	admin := alice
+	for i, op1 := range ops {
+		for j, op2 := range ops {
+			other := NewUser(t, s, "admin"+strconv.Itoa(i)+strconv.Itoa(j))
+			noErr(t, "SetUserRole", s.SetUserRole(t.Context(), other, models.RoleAdmin))
+			type result struct {
+				id  int
+				err error
+			}
+			results := make(chan result, 2)
+			go func() { results <- result{admin, op1.do(admin)} }()
+			go func() { results <- result{other, op2.do(other)} }()
+			var left []int
+			for range 2 {
+				r := <-results
+				if errors.Is(r.err, storage.ErrLastAdmin) {
+					left = append(left, r.id)
+				} else {
+					noErr(t, "concurrent "+op1.name+" and "+op2.name, r.err)
+				}
+			}
+			if len(left) != 1 {
+				t.Fatalf("concurrent %s and %s of the two admins left %d of them, want one", op1.name, op2.name, len(left))
+			}
+			admin = left[0]
+		}
+	}
+	wantErr(t, "DeleteUser of last admin", s.DeleteUser(t.Context(), admin), storage.ErrLastAdmin)
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"notes/internal/models"
+	"time"
+)
+
+// Store is the contract every storage backend implements. Handlers keep
+// depending on their own narrow interfaces; Store is what wires a backend
+// into the application and what the conformance suite in storagetest checks.
+type Store interface {
+	// Ping checks that the backend is reachable; Close releases it.
+	Ping(ctx context.Context) error
+	Close() error
+
+	// Users and sessions.
+	SaveUser(ctx context.Context, username, password string) (int, error)
+	GetUserByUsername(ctx context.Context, username string) (*models.User, error)
+	SaveRefreshToken(ctx context.Context, userID int, sessionID, tokenHash string, expiresAt time.Time) error
+	RotateRefreshToken(ctx context.Context, oldTokenHash, newTokenHash string, expiresAt time.Time) (*models.Session, error)
+	RevokeSession(ctx context.Context, userID int, sessionID string) error
+	RevokeAllSessions(ctx context.Context, userID int) error
+	IsSessionActive(ctx context.Context, sessionID string) (bool, error)
+
+	// Administration. Changing the role of a user or locking them revokes
+	// their sessions, so that the change applies to their next token.
+	// Deleting a user deletes everything they own. Neither may remove the
+	// last admin, which fails with ErrLastAdmin.
+	GetUsers(ctx context.Context, query string, limit, offset int) ([]models.UserInfo, error)
+	SetUserRole(ctx context.Context, userID int, role string) error
+	SetUserLocked(ctx context.Context, userID int, locked bool) error
+	GetNoteCounts(ctx context.Context, userID int) (*models.NoteCounts, error)
+	DeleteUser(ctx context.Context, userID int) error
+
+	// Notes.
+	SaveNote(ctx context.Context, userID int, title, content string, tags []string) error
+	GetNote(ctx context.Context, userID, noteID int) (*models.Note, error)
+	GetAllNotes(ctx context.Context, userID int, page PageRequest, filter NoteFilter) (*NotePage, error)
+	UpdateNote(ctx context.Context, noteID int, userID int, title, content string, tags []string, expectedVersion int) (int, error)
+	PatchNote(ctx context.Context, noteID, userID int, patch NotePatch, expectedVersion int) (int, error)
+	DeleteNote(ctx context.Context, noteID, userID int) error
+	SearchNotes(ctx context.Context, userID int, query string, limit, offset int) ([]models.SearchResult, error)
+	GetTags(ctx context.Context, userID int) ([]models.Tag, error)
+
+	// Revisions.
+	GetRevisions(ctx context.Context, userID, noteID int) ([]models.Revision, error)
+	GetRevision(ctx context.Context, userID, noteID, revision int) (*models.Revision, error)
+	RestoreRevision(ctx context.Context, userID, noteID, revision int) error
+
+	// Trash.
+	GetTrash(ctx context.Context, userID int) ([]models.Note, error)
+	RestoreNote(ctx context.Context, userID, noteID int) error
+	PurgeNote(ctx context.Context, userID, noteID int) error
+	PurgeTrash(ctx context.Context, before time.Time) (int64, error)
+
+	// Notebooks.
+	SaveNotebook(ctx context.Context, userID int, name string, parentID *int) (int, error)
+	GetNotebooks(ctx context.Context, userID int) ([]models.Notebook, error)
+	GetNotebook(ctx context.Context, userID, notebookID int) (*models.Notebook, error)
+	UpdateNotebook(ctx context.Context, userID, notebookID int, name string, parentID *int) error
+	DeleteNotebook(ctx context.Context, userID, notebookID int, recursive bool) error
+	MoveNote(ctx context.Context, userID, noteID int, notebookID *int) error
+
+	// Sharing and public links.
+	ShareNote(ctx context.Context, ownerID, noteID int, username, permission string) error
+	UnshareNote(ctx context.Context, ownerID, noteID, userID int) error
+	GetNoteShares(ctx context.Context, ownerID, noteID int) ([]models.NoteShare, error)
+	GetSharedNotes(ctx context.Context, userID int) ([]models.SharedNote, error)
+	SaveNoteLink(ctx context.Context, ownerID, noteID int, tokenHash, password string, expiresAt *time.Time) (int, error)
+	GetNoteLinks(ctx context.Context, ownerID, noteID int) ([]models.NoteLink, error)
+	RevokeNoteLink(ctx context.Context, ownerID, noteID, linkID int) error
+	GetPublicNote(ctx context.Context, tokenHash, password string) (*models.PublicNote, error)
+}
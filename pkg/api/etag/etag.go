@@ -0,0 +1,70 @@
+package etag
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Format renders a note version as a strong entity tag.
+func Format(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// parse extracts the version from a single entity tag and reports whether the
+// tag is weak.
+func parse(tag string) (version int, weak, ok bool) {
+	tag = strings.TrimSpace(tag)
+	if rest, found := strings.CutPrefix(tag, "W/"); found {
+		tag, weak = rest, true
+	}
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, false, false
+	}
+	v, err := strconv.Atoi(tag[1 : len(tag)-1])
+	if err != nil || v <= 0 {
+		return 0, false, false
+	}
+	return v, weak, true
+}
+
+// List parses the comma-separated entity tags of an If-Match or If-None-Match
+// header. It returns the versions listed, or wildcard when the header is "*".
+// With strong set, weak tags are left out, as If-Match compares entity tags
+// strongly (RFC 9110 §13.1.1). Tags that are not note versions are ignored.
+func List(header string, strong bool) (versions []int, wildcard bool) {
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimSpace(tag) == "*" {
+			return nil, true
+		}
+		v, weak, ok := parse(tag)
+		if ok && !(strong && weak) {
+			versions = append(versions, v)
+		}
+	}
+	return versions, false
+}
+
+// Match reports whether an If-None-Match header value lists the version,
+// comparing weakly as RFC 9110 §13.1.2 asks.
+func Match(header string, version int) bool {
+	return match(header, version, false)
+}
+
+// MatchStrong reports whether an If-Match header value lists the version,
+// comparing strongly as RFC 9110 §13.1.1 asks.
+func MatchStrong(header string, version int) bool {
+	return match(header, version, true)
+}
+
+func match(header string, version int, strong bool) bool {
+	versions, wildcard := List(header, strong)
+	if wildcard {
+		return true
+	}
+	for _, v := range versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
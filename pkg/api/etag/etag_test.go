@@ -0,0 +1,57 @@
+package etag
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestList(t *testing.T) {
+	tests := []struct {
+		header   string
+		strong   bool
+		versions []int
+		wildcard bool
+	}{
+		{header: `"3"`, versions: []int{3}},
+		{header: `"3", "4"`, versions: []int{3, 4}},
+		{header: `"3","4" ,"5"`, versions: []int{3, 4, 5}},
+		{header: `*`, wildcard: true},
+		{header: ` * `, strong: true, wildcard: true},
+		{header: `W/"3", "4"`, versions: []int{3, 4}},
+		{header: `W/"3", "4"`, strong: true, versions: []int{4}},
+		{header: `"abc", "0", 3, "7"`, versions: []int{7}},
+		{header: ``},
+	}
+	for _, tt := range tests {
+		versions, wildcard := List(tt.header, tt.strong)
+		if !slices.Equal(versions, tt.versions) || wildcard != tt.wildcard {
+			t.Errorf("List(%q, %v) = %v, %v; want %v, %v", tt.header, tt.strong, versions, wildcard, tt.versions, tt.wildcard)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		header string
+		weak   bool
+		strong bool
+	}{
+		{header: `"3"`, weak: true, strong: true},
+		{header: `"2", "3"`, weak: true, strong: true},
+		{header: `*`, weak: true, strong: true},
+		{header: `W/"3"`, weak: true, strong: false},
+		{header: `"4"`, weak: false, strong: false},
+		{header: `garbage`, weak: false, strong: false},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.header, 3); got != tt.weak {
+			t.Errorf("Match(%q, 3) = %v, want %v", tt.header, got, tt.weak)
+		}
+		if got := MatchStrong(tt.header, 3); got != tt.strong {
+			t.Errorf("MatchStrong(%q, 3) = %v, want %v", tt.header, got, tt.strong)
+		}
+		if Format(3) != `"3"` {
+			t.Fatalf("Format(3) = %s", Format(3))
+		}
+	}
+}
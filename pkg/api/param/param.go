@@ -0,0 +1,39 @@
+package param
+
+import (
+	"net/http"
+	"notes/pkg/api/response"
+	"strconv"
+
+	"github.com/go-chi/chi"
+)
+
+// Int parses the integer path parameter name. The error is a
+// response.FieldError, the same detail the request validator reports for
+// the parameter.
+func Int(r *http.Request, name string) (int, error) {
+	v, err := strconv.Atoi(chi.URLParam(r, name))
+	if err != nil {
+		return 0, response.FieldError{Field: name, Code: "type", Detail: "parameter " + name + " must be an integer"}
+	}
+	return v, nil
+}
+
+// QueryInt parses the integer query parameter name, returning def when the
+// parameter is absent.
+func QueryInt(r *http.Request, name string, def int) (int, error) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return def, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, response.FieldError{Field: name, Code: "type", Detail: "parameter " + name + " must be an integer"}
+	}
+	return v, nil
+}
+
+// Missing returns the error for the required parameter name when it is absent.
+func Missing(name string) error {
+	return response.FieldError{Field: name, Code: "required", Detail: "parameter " + name + " is required"}
+}
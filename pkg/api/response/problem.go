@@ -0,0 +1,89 @@
+package response
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/go-playground/validator/v10"
+)
+
+const ContentTypeProblem = "application/problem+json"
+
+// Problem is an RFC 7807 problem details document. Code is the stable,
+// machine-readable error code clients branch on; Title and Detail are meant
+// for people and may change.
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     string       `json:"code"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError tells why a single request field was rejected. Code is the
+// failed validation rule, such as required or max.
+type FieldError struct {
+	Field  string `json:"field"`
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+}
+
+func (e FieldError) Error() string {
+	return e.Detail
+}
+
+// RenderProblem writes v, a Problem or a struct embedding one to add extension
+// members, as application/problem+json with the given status.
+func RenderProblem(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", ContentTypeProblem)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// ValidationError turns validator errors into per-field details. Fields are
+// named the way they appear in JSON, so Tags[0] becomes tags[0].
+func ValidationError(errs validator.ValidationErrors) []FieldError {
+	res := make([]FieldError, 0, len(errs))
+	for _, err := range errs {
+		field := jsonName(err.Field())
+		var detail string
+		switch err.ActualTag() {
+		case "required":
+			detail = "field " + field + " is a required field"
+		case "url":
+			detail = "field " + field + " is not a valid URL"
+		case "max":
+			detail = "field " + field + " must be at most " + err.Param() + " characters long"
+		case "min":
+			detail = "field " + field + " must be at least " + err.Param() + " characters long"
+		case "oneof":
+			detail = "field " + field + " must be one of " + strings.ReplaceAll(err.Param(), " ", ", ")
+		default:
+			detail = "field " + field + " is not valid"
+		}
+		res = append(res, FieldError{Field: field, Code: err.ActualTag(), Detail: detail})
+	}
+	return res
+}
+
+// jsonName converts a Go field name such as NotebookID to notebook_id.
+func jsonName(field string) string {
+	var b strings.Builder
+	runes := []rune(field)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			prevLower := i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]))
+			nextLower := i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1])
+			if prevLower || nextLower {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
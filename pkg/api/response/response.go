@@ -1,20 +1,12 @@
 package response
 
-import (
-	"fmt"
-	"github.com/go-playground/validator/v10"
-	"strings"
-)
-
 type Response struct {
-	Status string `json:"status"` //Error, Ok
-	Error  string `json:"error,omitempty"`
+	Status string `json:"status"` //Ok
 	Alias  string `json:"alias,omitempty"`
 }
 
 const (
-	StatusOK    = "OK"
-	StatusError = "Error"
+	StatusOK = "OK"
 )
 
 func OK() Response {
@@ -22,30 +14,3 @@ func OK() Response {
 		Status: StatusOK,
 	}
 }
-
-func Error(msg string) Response {
-	return Response{
-		Status: StatusError,
-		Error:  msg,
-	}
-}
-
-func ValidationError(errs validator.ValidationErrors) Response {
-	var errMsgs []string
-
-	for _, err := range errs {
-		switch err.ActualTag() {
-		case "required":
-			errMsgs = append(errMsgs, fmt.Sprintf("field %s is a required field", err.Field()))
-		case "url":
-			errMsgs = append(errMsgs, fmt.Sprintf("field %s is not a valid URL", err.Field()))
-		default:
-			errMsgs = append(errMsgs, fmt.Sprintf("field %s is not valid", err.Field()))
-		}
-	}
-
-	return Response{
-		Status: StatusError,
-		Error:  strings.Join(errMsgs, ", "),
-	}
-}
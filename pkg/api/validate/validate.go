@@ -0,0 +1,13 @@
+package validate
+
+import "github.com/go-playground/validator/v10"
+
+// validate is shared by every handler: a validator caches what it learns
+// about each struct type, so building one per request throws that away.
+var validate = validator.New()
+
+// Struct checks the validate tags of v, which must be a struct, and returns
+// validator.ValidationErrors for the fields that fail them.
+func Struct(v any) error {
+	return validate.Struct(v)
+}
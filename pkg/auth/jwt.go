@@ -11,15 +11,21 @@ import (
 var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
 
 type Claims struct {
-	UserID int `json:"user_id"`
+	UserID    int    `json:"user_id"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(UserID int, username string) (string, error) {
+// GenerateToken issues an access token bound to a refresh token session,
+// so revoking the session also rejects the access token.
+func GenerateToken(UserID int, username, role, sessionID string, ttl time.Duration) (string, error) {
 	claims := &Claims{
-		UserID: UserID,
+		UserID:    UserID,
+		Role:      role,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
@@ -1,6 +1,11 @@
 package sl
 
-import "log/slog"
+import (
+	"context"
+	"log/slog"
+
+	"go.opentelemetry.io/otel/trace"
+)
 
 func Err(err error) slog.Attr {
 	return slog.Attr{
@@ -8,3 +13,40 @@ func Err(err error) slog.Attr {
 		Value: slog.StringValue(err.Error()),
 	}
 }
+
+// TraceID returns the id of the trace carried by ctx, so that log records can
+// be matched with their spans. It is an empty attribute when ctx carries no
+// trace.
+func TraceID(ctx context.Context) slog.Attr {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return slog.Attr{}
+	}
+	return slog.String("trace_id", sc.TraceID().String())
+}
+
+// TraceHandler adds the trace id of the context a record is logged with to
+// the record, so that callers only need to log with the context of their
+// request or job. Records logged without a trace are passed on unchanged.
+type TraceHandler struct {
+	slog.Handler
+}
+
+func NewTraceHandler(h slog.Handler) *TraceHandler {
+	return &TraceHandler{Handler: h}
+}
+
+func (h *TraceHandler) Handle(ctx context.Context, r slog.Record) error {
+	if attr := TraceID(ctx); !attr.Equal(slog.Attr{}) {
+		r.AddAttrs(attr)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *TraceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &TraceHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *TraceHandler) WithGroup(name string) slog.Handler {
+	return &TraceHandler{Handler: h.Handler.WithGroup(name)}
+}